@@ -0,0 +1,339 @@
+// Package client provides a Go client for the Request Raccoon admin API,
+// meant for integration tests asserting which requests a service under test sent.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by the client
+var (
+	// ErrVerificationFailed is wrapped by VerificationError
+	ErrVerificationFailed = errors.New("request verification failed")
+	// ErrTimeout is returned by Wait when no matching request arrived in time
+	ErrTimeout = errors.New("timed out waiting for request")
+)
+
+// Client talks to the admin API of a Request Raccoon server.
+type Client struct {
+	baseURL string
+	// HTTPClient sends the API requests, it defaults to http.DefaultClient
+	HTTPClient *http.Client
+	// Token is sent as bearer token, for servers that set ADMIN_TOKEN
+	Token string
+}
+
+// New creates a client for the server at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/_raccoon/api",
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Filter selects captured requests. Empty fields match everything.
+type Filter struct {
+	Method string
+	// Path is a glob, "*" matches within a path segment and "**" across segments
+	Path   string
+	Prefix string
+	// Headers maps header names to required values, an empty value only requires presence
+	Headers map[string]string
+	Since   time.Time
+	Until   time.Time
+	// Body is a substring of the request body
+	Body string
+	// Provider and Event select webhooks of a known provider, Event is a glob such as "invoice.*"
+	Provider string
+	Event    string
+}
+
+// Values encodes the filter as query parameters of the admin API.
+func (f Filter) Values() url.Values {
+	q := url.Values{}
+	setNonEmpty(q, "method", f.Method)
+	setNonEmpty(q, "path", f.Path)
+	setNonEmpty(q, "prefix", f.Prefix)
+	setNonEmpty(q, "body", f.Body)
+	setNonEmpty(q, "provider", f.Provider)
+	setNonEmpty(q, "event", f.Event)
+	for name, value := range f.Headers {
+		if value == "" {
+			q.Add("header", name)
+		} else {
+			q.Add("header", name+":"+value)
+		}
+	}
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339Nano))
+	}
+	if !f.Until.IsZero() {
+		q.Set("until", f.Until.Format(time.RFC3339Nano))
+	}
+	return q
+}
+
+// Request is a captured request.
+type Request struct {
+	ID            string      `json:"id"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Path          string      `json:"path"`
+	Query         string      `json:"query"`
+	Host          string      `json:"host"`
+	Proto         string      `json:"proto"`
+	RemoteAddr    string      `json:"remote_addr"`
+	Headers       http.Header `json:"headers"`
+	Body          []byte      `json:"body"`
+	BodySize      int64       `json:"body_size"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+	BodySHA256    string      `json:"body_sha256,omitempty"`
+	DecodedBody   []byte      `json:"decoded_body,omitempty"`
+	ReceivedAt    time.Time   `json:"received_at"`
+	CompletedAt   time.Time   `json:"completed_at"`
+	Response      *Response   `json:"response,omitempty"`
+	MockRule      string      `json:"mock_rule,omitempty"`
+	Webhook       *Webhook    `json:"webhook,omitempty"`
+}
+
+// Webhook is the metadata of a webhook from a known provider.
+type Webhook struct {
+	Provider   string `json:"provider"`
+	Event      string `json:"event,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+}
+
+// Response describes what the server answered to a captured request.
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Size    int64       `json:"size"`
+}
+
+// VerificationError reports a request count that did not meet the expectation.
+type VerificationError struct {
+	Filter   Filter
+	Expected int
+	Actual   int
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s: expected %d matching requests, got %d", ErrVerificationFailed, e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrVerificationFailed.
+func (e *VerificationError) Unwrap() error {
+	return ErrVerificationFailed
+}
+
+// Requests returns up to 1000 of the newest captured requests matching the filter.
+func (c *Client) Requests(ctx context.Context, f Filter) ([]Request, error) {
+	q := f.Values()
+	q.Set("limit", "1000")
+
+	var page struct {
+		Requests []Request `json:"requests"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/requests", q, nil, &page, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return page.Requests, nil
+}
+
+// Count returns how many captured requests match the filter.
+func (c *Client) Count(ctx context.Context, f Filter) (int, error) {
+	q := f.Values()
+	q.Set("min", "0")
+
+	var result verification
+	if err := c.do(ctx, http.MethodGet, "/verify", q, nil, &result, http.StatusOK); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// Verify asserts that exactly n captured requests match the filter.
+// A mismatch is reported as a *VerificationError.
+func (c *Client) Verify(ctx context.Context, f Filter, n int) error {
+	q := f.Values()
+	q.Set("count", strconv.Itoa(n))
+
+	var result verification
+	err := c.do(ctx, http.MethodGet, "/verify", q, nil, &result, http.StatusOK, http.StatusExpectationFailed)
+	if err != nil {
+		return err
+	}
+	if !result.OK {
+		return &VerificationError{Filter: f, Expected: n, Actual: result.Count}
+	}
+	return nil
+}
+
+// Wait returns the newest captured request matching the filter, waiting up to timeout for one to arrive.
+// It returns ErrTimeout when none arrived in time. Set Filter.Since to ignore requests captured earlier.
+func (c *Client) Wait(ctx context.Context, f Filter, timeout time.Duration) (*Request, error) {
+	q := f.Values()
+	q.Set("timeout", timeout.String())
+
+	var req Request
+	if err := c.do(ctx, http.MethodGet, "/wait", q, nil, &req, http.StatusOK); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusRequestTimeout {
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, apiErr.Message)
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Clear deletes all captured requests.
+func (c *Client) Clear(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/requests", nil, nil, nil, http.StatusNoContent)
+}
+
+// ReplayOptions configures a replay of captured requests.
+type ReplayOptions struct {
+	// Target is the URL requests are sent to, its path is prepended to the captured paths
+	Target string `json:"target"`
+	// IDs selects the requests to replay, when empty the filter of Replay does
+	IDs []string `json:"ids,omitempty"`
+	// Concurrency is the number of requests in flight, the default of one keeps the original order
+	Concurrency int `json:"concurrency,omitempty"`
+	// Rate limits how many requests are started per second, zero is unlimited
+	Rate float64 `json:"rate,omitempty"`
+	// Timing reproduces the original gaps between the requests
+	Timing bool `json:"timing,omitempty"`
+	// Speed divides the original gaps when Timing is set, 2 replays twice as fast
+	Speed float64 `json:"speed,omitempty"`
+	// Raw sends sensitive headers such as Authorization with their stored values instead of dropping them
+	Raw bool `json:"raw,omitempty"`
+	// Limit is the largest number of requests selected by the filter, the server defaults to 50
+	Limit int `json:"-"`
+}
+
+// ReplayReport summarizes a replay. Requests answered with a status outside 2xx count as failed.
+type ReplayReport struct {
+	Target    string         `json:"target"`
+	Total     int            `json:"total"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []ReplayResult `json:"results"`
+}
+
+// ReplayResult is the outcome of a single replayed request.
+type ReplayResult struct {
+	ID       string        `json:"id"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Replay sends the captured requests selected by opts.IDs, or else by the filter, to opts.Target
+// in the order they were received, and returns once all were sent.
+func (c *Client) Replay(ctx context.Context, opts ReplayOptions, f Filter) (*ReplayReport, error) {
+	q := f.Values()
+	if len(opts.IDs) > 0 {
+		q = nil
+	} else if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var report ReplayReport
+	if err := c.do(ctx, http.MethodPost, "/replay", q, opts, &report, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// APIError is an unexpected response of the admin API.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("admin API returned %d: %s", e.Status, e.Message)
+}
+
+type verification struct {
+	OK    bool `json:"ok"`
+	Count int  `json:"count"`
+}
+
+// do sends an API request with in as JSON body, if set, and decodes the JSON response into out
+// when the status is one of the expected ones
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out any, expected ...int) error {
+	target := c.baseURL + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode %s request: %w", path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(expected, resp.StatusCode) {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+			message = apiErr.Error
+		}
+		return &APIError{Status: resp.StatusCode, Message: message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+func setNonEmpty(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/config"
+	"github.com/czechbol/request-raccoon/internal/middleware"
+	"github.com/czechbol/request-raccoon/internal/replay"
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/stream"
+)
+
+// newTestServer starts a server capturing requests and serving the admin API
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	st := store.NewMemory(100, 1<<20)
+	events := stream.NewHub()
+	manager := middleware.NewManager(config.Config{BodyCaptureMax: 1 << 20}, st)
+	manager.OnCapture(events.Publish)
+	a := api.New(st, events)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_raccoon/api/requests", a.ListRequests)
+	mux.HandleFunc("DELETE /_raccoon/api/requests", a.ClearRequests)
+	mux.HandleFunc("GET /_raccoon/api/verify", a.Verify)
+	mux.HandleFunc("GET /_raccoon/api/wait", a.Wait)
+	mux.HandleFunc("POST /_raccoon/api/replay", replay.NewAPI(st).Replay)
+	mux.Handle("/", manager.Logging(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		events.Close()
+		srv.Close()
+	})
+	return srv
+}
+
+func send(t *testing.T, srv *httptest.Server, method, path, body string, headers map[string]string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestClient_Verify(t *testing.T) {
+	srv := newTestServer(t)
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	send(t, srv, "POST", "/webhooks/github", `{"action":"opened"}`, map[string]string{"X-GitHub-Event": "pull_request"})
+	send(t, srv, "POST", "/webhooks/github", `{"action":"closed"}`, map[string]string{"X-GitHub-Event": "pull_request"})
+	send(t, srv, "GET", "/status", "", nil)
+
+	github := Filter{Method: "POST", Path: "/webhooks/*", Headers: map[string]string{"X-GitHub-Event": "pull_request"}}
+	if err := c.Verify(ctx, github, 2); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	err := c.Verify(ctx, Filter{Body: "opened"}, 2)
+	var verr *VerificationError
+	if !errors.As(err, &verr) || !errors.Is(err, ErrVerificationFailed) {
+		t.Fatalf("Expected VerificationError, got %v", err)
+	}
+	if verr.Expected != 2 || verr.Actual != 1 {
+		t.Errorf("Unexpected verification error %+v", verr)
+	}
+
+	count, err := c.Count(ctx, Filter{})
+	if err != nil || count != 3 {
+		t.Errorf("Expected 3 requests, got %d (%v)", count, err)
+	}
+
+	requests, err := c.Requests(ctx, Filter{Prefix: "/webhooks/"})
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d (%v)", len(requests), err)
+	}
+	if string(requests[0].Body) != `{"action":"closed"}` || requests[0].Response.Status != http.StatusOK {
+		t.Errorf("Unexpected newest request %+v", requests[0])
+	}
+	if hook := requests[0].Webhook; hook == nil || hook.Provider != "github" || hook.Event != "pull_request" {
+		t.Errorf("Expected GitHub webhook metadata, got %+v", hook)
+	}
+	if err := c.Verify(ctx, Filter{Provider: "github", Event: "pull_*"}, 2); err != nil {
+		t.Errorf("Verify by webhook event failed: %v", err)
+	}
+
+	if err := c.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if err := c.Verify(ctx, Filter{}, 0); err != nil {
+		t.Errorf("Expected no requests after clear: %v", err)
+	}
+}
+
+func TestClient_Wait(t *testing.T) {
+	srv := newTestServer(t)
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		resp, err := http.Post(srv.URL+"/callbacks/payment", "application/json", strings.NewReader(`{"status":"paid"}`))
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	req, err := c.Wait(ctx, Filter{Path: "/callbacks/*"}, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if req.Path != "/callbacks/payment" {
+		t.Errorf("Expected /callbacks/payment, got %s", req.Path)
+	}
+
+	_, err = c.Wait(ctx, Filter{Path: "/never"}, 10*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expected ErrTimeout, got %v", err)
+	}
+
+	var apiErr *APIError
+	_, err = c.Wait(ctx, Filter{Since: time.Now()}, -time.Second)
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected bad request error, got %v", err)
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	srv := newTestServer(t)
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	received := make(chan string, 10)
+	consumer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Method + " " + r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer consumer.Close()
+
+	send(t, srv, "POST", "/webhooks/orders", `{"id":1}`, nil)
+	send(t, srv, "POST", "/webhooks/orders", `{"id":2}`, nil)
+	send(t, srv, "GET", "/status", "", nil)
+
+	report, err := c.Replay(ctx, ReplayOptions{Target: consumer.URL}, Filter{Method: "POST"})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if report.Total != 2 || report.Succeeded != 2 || report.Results[0].Status != http.StatusAccepted {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(received) != 2 || <-received != "POST /webhooks/orders" {
+		t.Errorf("Expected 2 replayed webhooks, got %d", len(received))
+	}
+
+	requests, err := c.Requests(ctx, Filter{Method: "GET"})
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("Expected 1 GET request, got %d (%v)", len(requests), err)
+	}
+	report, err = c.Replay(ctx, ReplayOptions{Target: consumer.URL, IDs: []string{requests[0].ID}}, Filter{})
+	if err != nil || report.Total != 1 {
+		t.Errorf("Expected replay by ID, got %+v (%v)", report, err)
+	}
+
+	var apiErr *APIError
+	_, err = c.Replay(ctx, ReplayOptions{Target: "nowhere"}, Filter{})
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Errorf("Expected bad request error, got %v", err)
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	a := api.New(store.NewMemory(10, 1<<20), stream.NewHub())
+	srv := httptest.NewServer(api.RequireToken("s3cret", http.HandlerFunc(a.ListRequests)))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	var apiErr *APIError
+	if _, err := c.Requests(context.Background(), Filter{}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+
+	c.Token = "s3cret"
+	if _, err := c.Requests(context.Background(), Filter{}); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+}
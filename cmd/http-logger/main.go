@@ -13,6 +13,16 @@ import (
 )
 
 func main() {
+	// Subcommands talk to a running server instead of starting one
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(runReplay(os.Args[2:], os.Stdout, os.Stderr))
+		case "pull":
+			os.Exit(runPull(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
@@ -31,7 +41,11 @@ func main() {
 	slog.SetDefault(logger)
 
 	// Create server
-	srv := server.New(cfg)
+	srv, err := server.New(cfg)
+	if err != nil {
+		slog.Error("Failed to create server", "error", err)
+		os.Exit(1)
+	}
 
 	// Set up graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
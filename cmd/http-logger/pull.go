@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/relay"
+)
+
+// runPull delivers the requests held by a relay to a local target until interrupted and returns the exit code
+func runPull(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pull", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: http-logger pull -server URL -target URL [flags]")
+		fmt.Fprintln(stderr, "Fetches requests from a server in relay mode and delivers them to a local target.")
+		fs.PrintDefaults()
+	}
+
+	server := fs.String("server", "", "URL of the relay (required)")
+	target := fs.String("target", "", "URL to deliver the requests to, e.g. http://localhost:3000 (required)")
+	token := fs.String("token", os.Getenv("RELAY_TOKEN"), "relay token, defaults to $RELAY_TOKEN")
+	limit := fs.Int("limit", relay.DefaultPullLimit, "maximum number of requests fetched at once")
+	wait := fs.Duration("wait", relay.DefaultPullWait, "how long each pull waits for requests to arrive")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *server == "" || *target == "" {
+		fmt.Fprintln(stderr, "pull: -server and -target are required")
+		fs.Usage()
+		return 2
+	}
+
+	puller, err := relay.NewPuller(*server, *target, *token)
+	if err != nil {
+		fmt.Fprintf(stderr, "pull: %v\n", err)
+		return 2
+	}
+	puller.Limit = *limit
+	puller.Wait = *wait
+	puller.OnDelivery = func(d relay.Delivery) {
+		fmt.Fprintf(stdout, "%s %s %s ", d.Request.ID, d.Request.Method, d.Request.URL)
+		switch {
+		case errors.Is(d.Err, mirror.ErrTruncated):
+			fmt.Fprintf(stdout, "skipped: %v\n", d.Err)
+		case d.Err != nil:
+			fmt.Fprintf(stdout, "error: %v (will retry)\n", d.Err)
+		default:
+			fmt.Fprintf(stdout, "%d %s\n", d.Status, d.Duration.Round(time.Millisecond))
+		}
+	}
+	puller.OnError = func(err error) {
+		fmt.Fprintf(stderr, "pull: %v\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(stdout, "Relaying requests from %s to %s\n", *server, *target)
+	if err := puller.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(stderr, "pull: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/czechbol/request-raccoon/client"
+)
+
+// runReplay replays captured requests of a running server to a target and returns the exit code
+func runReplay(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: http-logger replay -target URL [flags]")
+		fmt.Fprintln(stderr, "Replays captured requests of a running server to a target URL.")
+		fs.PrintDefaults()
+	}
+
+	server := fs.String("server", "http://localhost:8080", "URL of the server that captured the requests")
+	token := fs.String("token", os.Getenv("ADMIN_TOKEN"), "admin token of the server, defaults to $ADMIN_TOKEN")
+	var opts client.ReplayOptions
+	fs.StringVar(&opts.Target, "target", "", "URL to replay the requests to (required)")
+	ids := fs.String("id", "", "comma separated IDs of the requests to replay, instead of the filter")
+	fs.IntVar(&opts.Concurrency, "concurrency", 1, "number of requests in flight")
+	fs.Float64Var(&opts.Rate, "rate", 0, "maximum requests started per second, 0 is unlimited")
+	fs.BoolVar(&opts.Timing, "timing", false, "reproduce the original gaps between the requests")
+	fs.Float64Var(&opts.Speed, "speed", 1, "speed factor of -timing, 2 replays twice as fast")
+	fs.BoolVar(&opts.Raw, "raw", false, "send sensitive headers such as Authorization with their stored values")
+	fs.IntVar(&opts.Limit, "limit", 50, "maximum number of requests selected by the filter")
+
+	var filter client.Filter
+	fs.StringVar(&filter.Method, "method", "", "filter by request method")
+	fs.StringVar(&filter.Path, "path", "", "filter by path glob")
+	fs.StringVar(&filter.Prefix, "prefix", "", "filter by path prefix")
+	fs.StringVar(&filter.Body, "body", "", "filter by body substring")
+	fs.Func("header", "filter by `Name:value` or just Name, repeatable", func(value string) error {
+		if filter.Headers == nil {
+			filter.Headers = map[string]string{}
+		}
+		name, v, _ := strings.Cut(value, ":")
+		filter.Headers[strings.TrimSpace(name)] = strings.TrimSpace(v)
+		return nil
+	})
+	fs.Func("since", "only requests received at or after this RFC 3339 `time`", parseTime(&filter.Since))
+	fs.Func("until", "only requests received at or before this RFC 3339 `time`", parseTime(&filter.Until))
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.Target == "" {
+		fmt.Fprintln(stderr, "replay: -target is required")
+		fs.Usage()
+		return 2
+	}
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			opts.IDs = append(opts.IDs, id)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(*server)
+	c.Token = *token
+	report, err := c.Replay(ctx, opts, filter)
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return 1
+	}
+
+	for _, r := range report.Results {
+		outcome := fmt.Sprint(r.Status)
+		if r.Error != "" {
+			outcome = "error: " + r.Error
+		}
+		fmt.Fprintf(stdout, "%s %s %s %s %s\n", r.ID, r.Method, r.Path, outcome, r.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(stdout, "Replayed %d requests to %s: %d succeeded, %d failed\n",
+		report.Total, report.Target, report.Succeeded, report.Failed)
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func parseTime(t *time.Time) func(string) error {
+	return func(value string) error {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	}
+}
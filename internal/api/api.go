@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/stream"
+)
+
+// Prefix is the path prefix of all administrative endpoints.
+// Requests below it are served by the API and are never captured.
+const Prefix = "/_raccoon"
+
+// Pagination defaults for list endpoints
+const (
+	DefaultLimit = 50
+	MaxLimit     = 1000
+)
+
+// API contains the handlers of the admin API.
+type API struct {
+	store  store.Store
+	events *stream.Hub
+}
+
+// New creates a new admin API backed by the given store.
+// Requests published to events wake up clients waiting for them.
+func New(st store.Store, events *stream.Hub) *API {
+	return &API{
+		store:  st,
+		events: events,
+	}
+}
+
+// ListRequests returns a page of captured requests matching the query filter.
+func (a *API) ListRequests(w http.ResponseWriter, r *http.Request) {
+	filter, err := store.ParseFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, limit, err := ParsePage(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requests, err := a.store.List(filter)
+	if err != nil {
+		slog.Error("Failed to list captured requests", "error", err)
+		WriteError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+
+	total := len(requests)
+	page := requests[min(offset, total):min(offset+limit, total)]
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"requests": present(page, isRaw(r)),
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+	})
+}
+
+// GetRequest returns a single captured request.
+func (a *API) GetRequest(w http.ResponseWriter, r *http.Request) {
+	req, err := a.store.Get(r.PathValue("id"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, present([]*store.CapturedRequest{req}, isRaw(r))[0])
+}
+
+// DeleteRequest removes a single captured request.
+func (a *API) DeleteRequest(w http.ResponseWriter, r *http.Request) {
+	if err := a.store.Delete(r.PathValue("id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearRequests removes all captured requests.
+func (a *API) ClearRequests(w http.ResponseWriter, _ *http.Request) {
+	if err := a.store.Clear(); err != nil {
+		slog.Error("Failed to clear captured requests", "error", err)
+		WriteError(w, http.StatusInternalServerError, "failed to clear requests")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NotFound answers unknown admin API paths so they are not captured as regular requests.
+func NotFound(w http.ResponseWriter, _ *http.Request) {
+	WriteError(w, http.StatusNotFound, "not found")
+}
+
+// ParsePage reads the offset and limit query parameters.
+func ParsePage(r *http.Request) (int, int, error) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		return 0, 0, errors.New("invalid offset")
+	}
+
+	limit, err := queryInt(r, "limit", DefaultLimit)
+	if err != nil || limit <= 0 {
+		return 0, 0, errors.New("invalid limit")
+	}
+	return offset, min(limit, MaxLimit), nil
+}
+
+// WriteJSON writes v as a JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+// WriteError writes a JSON error response.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, map[string]interface{}{
+		"error": message,
+	})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	slog.Error("Store operation failed", "error", err)
+	WriteError(w, http.StatusInternalServerError, "store operation failed")
+}
+
+// present prepares captured requests for output, redacting sensitive headers unless raw output was requested
+func present(requests []*store.CapturedRequest, raw bool) []*store.CapturedRequest {
+	result := make([]*store.CapturedRequest, 0, len(requests))
+	for _, req := range requests {
+		if raw {
+			result = append(result, req)
+		} else {
+			result = append(result, req.Redacted())
+		}
+	}
+	return result
+}
+
+func isRaw(r *http.Request) bool {
+	raw, _ := strconv.ParseBool(r.URL.Query().Get("raw"))
+	return raw
+}
+
+func queryInt(r *http.Request, key string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/stream"
+)
+
+func newTestAPI(t *testing.T) (*http.ServeMux, store.Store) {
+	t.Helper()
+
+	st := store.NewMemory(100, 1<<20)
+	a := New(st, stream.NewHub())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/requests", a.ListRequests)
+	mux.HandleFunc("DELETE /api/requests", a.ClearRequests)
+	mux.HandleFunc("GET /api/requests/{id}", a.GetRequest)
+	mux.HandleFunc("DELETE /api/requests/{id}", a.DeleteRequest)
+	mux.HandleFunc("GET /api/verify", a.Verify)
+	mux.HandleFunc("GET /api/wait", a.Wait)
+	return mux, st
+}
+
+func addRequest(st store.Store, id, method, path string, receivedAt time.Time) {
+	st.Add(&store.CapturedRequest{
+		ID:         id,
+		Method:     method,
+		Path:       path,
+		Headers:    http.Header{"Authorization": {"Bearer secret"}, "X-Event": {method + path}},
+		Body:       []byte(`{"id":"` + id + `"}`),
+		ReceivedAt: receivedAt,
+	})
+}
+
+type listResponse struct {
+	Requests []*store.CapturedRequest `json:"requests"`
+	Total    int                      `json:"total"`
+	Offset   int                      `json:"offset"`
+	Limit    int                      `json:"limit"`
+}
+
+func TestAPI_ListRequests(t *testing.T) {
+	mux, st := newTestAPI(t)
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	addRequest(st, "a", "POST", "/webhooks/github", base)
+	addRequest(st, "b", "GET", "/status", base.Add(time.Minute))
+	addRequest(st, "c", "POST", "/webhooks/stripe/events", base.Add(2*time.Minute))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+		total    int
+	}{
+		{name: "all newest first", query: "", expected: []string{"c", "b", "a"}, total: 3},
+		{name: "by method", query: "method=post", expected: []string{"c", "a"}, total: 2},
+		{name: "by path glob", query: "path=/webhooks/*", expected: []string{"a"}, total: 1},
+		{name: "by deep path glob", query: "path=/webhooks/**", expected: []string{"c", "a"}, total: 2},
+		{name: "by header", query: "header=X-Event:GET/status", expected: []string{"b"}, total: 1},
+		{name: "by body", query: "body=%22c%22", expected: []string{"c"}, total: 1},
+		{
+			name:     "by time range",
+			query:    "since=2025-06-01T12:00:30Z&until=2025-06-01T12:01:30Z",
+			expected: []string{"b"},
+			total:    1,
+		},
+		{name: "paginated", query: "offset=1&limit=1", expected: []string{"b"}, total: 3},
+		{name: "offset past end", query: "offset=10", expected: []string{}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/requests?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var resp listResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if resp.Total != tt.total {
+				t.Errorf("Expected total %d, got %d", tt.total, resp.Total)
+			}
+			if len(resp.Requests) != len(tt.expected) {
+				t.Fatalf("Expected %d requests, got %d", len(tt.expected), len(resp.Requests))
+			}
+			for i, id := range tt.expected {
+				if resp.Requests[i].ID != id {
+					t.Errorf("Expected request %d to be %s, got %s", i, id, resp.Requests[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestAPI_ListRequests_InvalidParams(t *testing.T) {
+	mux, _ := newTestAPI(t)
+
+	for _, query := range []string{"limit=0", "offset=-1", "since=yesterday", "header=:x"} {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/requests?"+query, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAPI_GetRequest(t *testing.T) {
+	mux, st := newTestAPI(t)
+	addRequest(st, "a", "POST", "/webhook", time.Now())
+
+	req := httptest.NewRequest("GET", "/api/requests/a", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var got store.CapturedRequest
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if got.Headers.Get("Authorization") != "[REDACTED]" {
+		t.Errorf("Expected Authorization to be redacted, got %s", got.Headers.Get("Authorization"))
+	}
+	if string(got.Body) != `{"id":"a"}` {
+		t.Errorf("Expected body to round-trip, got %s", got.Body)
+	}
+
+	// Raw output keeps sensitive headers
+	req = httptest.NewRequest("GET", "/api/requests/a?raw=true", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if got.Headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected raw Authorization header, got %s", got.Headers.Get("Authorization"))
+	}
+
+	// Missing request
+	req = httptest.NewRequest("GET", "/api/requests/missing", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestAPI_DeleteAndClear(t *testing.T) {
+	mux, st := newTestAPI(t)
+	for i := 0; i < 3; i++ {
+		addRequest(st, strconv.Itoa(i), "POST", "/webhook", time.Now())
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/requests/1", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if st.Len() != 2 {
+		t.Errorf("Expected 2 requests after delete, got %d", st.Len())
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/requests/1", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for repeated delete, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/requests", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if st.Len() != 0 {
+		t.Errorf("Expected empty store after clear, got %d", st.Len())
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Wait timeouts
+const (
+	DefaultWaitTimeout = 30 * time.Second
+	MaxWaitTimeout     = 5 * time.Minute
+)
+
+// Verification is the result of a request count assertion.
+type Verification struct {
+	OK    bool `json:"ok"`
+	Count int  `json:"count"`
+	Min   int  `json:"min"`
+	// Max is omitted when the count is unbounded
+	Max *int `json:"max,omitempty"`
+}
+
+// Verify asserts how many captured requests match the query filter.
+// The count parameter requires an exact number, min and max a range; without them at least one request must match.
+// It answers 200 when the assertion holds and 417 when it does not.
+func (a *API) Verify(w http.ResponseWriter, r *http.Request) {
+	filter, err := store.ParseFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	minimum, maximum, err := parseCount(r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requests, err := a.store.List(filter)
+	if err != nil {
+		slog.Error("Failed to list captured requests", "error", err)
+		WriteError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+
+	count := len(requests)
+	result := Verification{
+		OK:    count >= minimum && (maximum == nil || count <= *maximum),
+		Count: count,
+		Min:   minimum,
+		Max:   maximum,
+	}
+
+	status := http.StatusOK
+	if !result.OK {
+		status = http.StatusExpectationFailed
+	}
+	WriteJSON(w, status, result)
+}
+
+// Wait returns the newest captured request matching the query filter, waiting up to the timeout
+// parameter for one to arrive. It answers 408 when no matching request arrived in time.
+func (a *API) Wait(w http.ResponseWriter, r *http.Request) {
+	filter, err := store.ParseFilter(r.URL.Query())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timeout := DefaultWaitTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			WriteError(w, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		timeout = min(timeout, MaxWaitTimeout)
+	}
+
+	// Subscribe before looking at the store so a request captured in between is not missed
+	sub := a.events.Subscribe(filter)
+	defer a.events.Unsubscribe(sub)
+
+	requests, err := a.store.List(filter)
+	if err != nil {
+		slog.Error("Failed to list captured requests", "error", err)
+		WriteError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+	if len(requests) > 0 {
+		WriteJSON(w, http.StatusOK, present(requests[:1], isRaw(r))[0])
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case req, ok := <-sub.C:
+		if !ok {
+			WriteError(w, http.StatusServiceUnavailable, "server is shutting down")
+			return
+		}
+		WriteJSON(w, http.StatusOK, present([]*store.CapturedRequest{req}, isRaw(r))[0])
+	case <-timer.C:
+		WriteError(w, http.StatusRequestTimeout, "no matching request received within "+timeout.String())
+	case <-r.Context().Done():
+	}
+}
+
+// parseCount reads the expected request count from the count, min and max query parameters
+func parseCount(r *http.Request) (int, *int, error) {
+	q := r.URL.Query()
+	if q.Has("count") && (q.Has("min") || q.Has("max")) {
+		return 0, nil, errors.New("count cannot be combined with min or max")
+	}
+
+	if q.Has("count") {
+		count, err := queryInt(r, "count", 0)
+		if err != nil || count < 0 {
+			return 0, nil, errors.New("invalid count")
+		}
+		return count, &count, nil
+	}
+
+	// Without any bounds at least one request must match
+	defaultMin := 1
+	if q.Has("max") {
+		defaultMin = 0
+	}
+	minimum, err := queryInt(r, "min", defaultMin)
+	if err != nil || minimum < 0 {
+		return 0, nil, errors.New("invalid min")
+	}
+	if !q.Has("max") {
+		return minimum, nil, nil
+	}
+
+	maximum, err := queryInt(r, "max", 0)
+	if err != nil || maximum < minimum {
+		return 0, nil, errors.New("invalid max")
+	}
+	return minimum, &maximum, nil
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/stream"
+)
+
+func TestAPI_Verify(t *testing.T) {
+	mux, st := newTestAPI(t)
+	base := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	addRequest(st, "a", "POST", "/webhooks/github", base)
+	addRequest(st, "b", "POST", "/webhooks/github", base.Add(time.Minute))
+	addRequest(st, "c", "GET", "/status", base.Add(2*time.Minute))
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		count  int
+	}{
+		{name: "at least one by default", query: "path=/webhooks/**", status: http.StatusOK, count: 2},
+		{name: "none by default", query: "path=/missing", status: http.StatusExpectationFailed, count: 0},
+		{name: "exact count", query: "method=POST&count=2", status: http.StatusOK, count: 2},
+		{name: "exact count mismatch", query: "method=POST&count=1", status: http.StatusExpectationFailed, count: 2},
+		{name: "exactly zero", query: "method=DELETE&count=0", status: http.StatusOK, count: 0},
+		{name: "range", query: "min=2&max=3", status: http.StatusOK, count: 3},
+		{name: "at most", query: "method=GET&max=0", status: http.StatusExpectationFailed, count: 1},
+		{name: "count and range", query: "count=1&min=1", status: http.StatusBadRequest},
+		{name: "invalid count", query: "count=-1", status: http.StatusBadRequest},
+		{name: "max below min", query: "min=3&max=1", status: http.StatusBadRequest},
+		{name: "invalid filter", query: "since=yesterday", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/verify?"+tt.query, nil))
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.status == http.StatusBadRequest {
+				return
+			}
+
+			var result Verification
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode verification: %v", err)
+			}
+			if result.Count != tt.count || result.OK != (tt.status == http.StatusOK) {
+				t.Errorf("Unexpected verification %+v", result)
+			}
+		})
+	}
+}
+
+func TestAPI_Wait(t *testing.T) {
+	st := store.NewMemory(100, 1<<20)
+	events := stream.NewHub()
+	a := New(st, events)
+
+	// A request captured before the call is returned right away
+	addRequest(st, "a", "POST", "/webhooks/github", time.Now())
+	rr := httptest.NewRecorder()
+	a.Wait(rr, httptest.NewRequest("GET", "/api/wait?path=/webhooks/github&timeout=1s", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	// A request captured while waiting ends the wait
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rr := httptest.NewRecorder()
+		a.Wait(rr, httptest.NewRequest("GET", "/api/wait?path=/webhooks/stripe&timeout=5s", nil))
+		done <- rr
+	}()
+
+	req := &store.CapturedRequest{ID: "b", Method: "POST", Path: "/webhooks/stripe", ReceivedAt: time.Now()}
+	deadline := time.After(2 * time.Second)
+	for events.Subscribers() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Wait did not subscribe")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	_ = st.Add(req)
+	events.Publish(req)
+
+	rr = <-done
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var got store.CapturedRequest
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode request: %v", err)
+	}
+	if got.ID != "b" {
+		t.Errorf("Expected request b, got %s", got.ID)
+	}
+
+	rr = httptest.NewRecorder()
+	a.Wait(rr, httptest.NewRequest("GET", "/api/wait?path=/missing&timeout=10ms", nil))
+	if rr.Code != http.StatusRequestTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestTimeout, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	a.Wait(rr, httptest.NewRequest("GET", "/api/wait?timeout=soon", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	events.Close()
+	rr = httptest.NewRecorder()
+	a.Wait(rr, httptest.NewRequest("GET", "/api/wait?path=/missing&timeout=1s", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d after hub close, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
@@ -0,0 +1,282 @@
+// Package cloudevents parses and validates CloudEvents carried by HTTP requests in binary, structured and batched mode.
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Content modes of the HTTP protocol binding
+const (
+	ModeBinary     = "binary"
+	ModeStructured = "structured"
+	ModeBatch      = "batch"
+)
+
+// Media types of the JSON event format
+const (
+	mediaType      = "application/cloudevents+json"
+	batchMediaType = "application/cloudevents-batch+json"
+)
+
+// headerPrefix marks attribute headers in binary mode
+const headerPrefix = "Ce-"
+
+// SpecVersion is the version of the specification events are validated against
+const SpecVersion = "1.0"
+
+// attributeName matches valid attribute names: lower-case ASCII letters and digits
+var attributeName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Parse returns the events carried by a request, or nil when it carries none.
+// Violations of the specification are reported in the Errors of each event instead of failing the parse.
+func Parse(header http.Header, body []byte) []store.CloudEvent {
+	if header.Get(headerPrefix+"Specversion") != "" {
+		return []store.CloudEvent{parseBinary(header)}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch contentType {
+	case mediaType:
+		return []store.CloudEvent{parseStructured(body, ModeStructured)}
+	case batchMediaType:
+		return parseBatch(body)
+	}
+	return nil
+}
+
+// parseBinary reads the attributes from ce-* headers, with the content type as datacontenttype
+func parseBinary(header http.Header) store.CloudEvent {
+	attributes := make(map[string]string)
+	for name, values := range header {
+		if !strings.HasPrefix(name, headerPrefix) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(name, headerPrefix))
+		// Values are percent-encoded where they are not printable ASCII
+		value, err := url.PathUnescape(values[0])
+		if err != nil {
+			value = values[0]
+		}
+		attributes[key] = value
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		attributes["datacontenttype"] = contentType
+	}
+
+	return newEvent(ModeBinary, attributes)
+}
+
+// parseStructured reads the attributes from a single event in the JSON format
+func parseStructured(data []byte, mode string) store.CloudEvent {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return store.CloudEvent{Mode: mode, Errors: []string{"invalid JSON event: " + err.Error()}}
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		if name != "data" && name != "data_base64" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	attributes := make(map[string]string, len(names))
+	var errs []string
+	for _, name := range names {
+		value := raw[name]
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			attributes[name] = s
+			continue
+		}
+		// Extensions may also be booleans or integers
+		var v any
+		if err := json.Unmarshal(value, &v); err != nil || v == nil {
+			errs = append(errs, fmt.Sprintf("attribute %s must not be null", name))
+			continue
+		}
+		switch v := v.(type) {
+		case bool, float64:
+			if isCoreAttribute(name) {
+				errs = append(errs, fmt.Sprintf("attribute %s must be a string", name))
+			}
+			attributes[name] = fmt.Sprint(v)
+		default:
+			errs = append(errs, fmt.Sprintf("attribute %s must be a string, number or boolean", name))
+		}
+	}
+	if _, ok := raw["data"]; ok {
+		if _, ok := raw["data_base64"]; ok {
+			errs = append(errs, "data and data_base64 are mutually exclusive")
+		}
+	}
+
+	event := newEvent(mode, attributes)
+	event.Errors = append(errs, event.Errors...)
+	return event
+}
+
+// parseBatch reads an array of events in the JSON format
+func parseBatch(data []byte) []store.CloudEvent {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return []store.CloudEvent{{Mode: ModeBatch, Errors: []string{"invalid JSON batch: " + err.Error()}}}
+	}
+
+	events := make([]store.CloudEvent, 0, len(items))
+	for _, item := range items {
+		events = append(events, parseStructured(item, ModeBatch))
+	}
+	return events
+}
+
+// newEvent maps attributes to an event and validates them
+func newEvent(mode string, attributes map[string]string) store.CloudEvent {
+	event := store.CloudEvent{
+		Mode:            mode,
+		SpecVersion:     attributes["specversion"],
+		ID:              attributes["id"],
+		Source:          attributes["source"],
+		Type:            attributes["type"],
+		Subject:         attributes["subject"],
+		Time:            attributes["time"],
+		DataContentType: attributes["datacontenttype"],
+		DataSchema:      attributes["dataschema"],
+	}
+	for name, value := range attributes {
+		if isCoreAttribute(name) {
+			continue
+		}
+		if event.Extensions == nil {
+			event.Extensions = make(map[string]string)
+		}
+		event.Extensions[name] = value
+	}
+	event.Errors = validate(attributes)
+	return event
+}
+
+var coreAttributes = []string{
+	"specversion", "id", "source", "type", "subject", "time", "datacontenttype", "dataschema",
+}
+
+func isCoreAttribute(name string) bool {
+	return slices.Contains(coreAttributes, name)
+}
+
+// validate checks the attributes against the CloudEvents 1.0 specification
+func validate(attributes map[string]string) []string {
+	var errs []string
+	for _, name := range []string{"specversion", "id", "source", "type"} {
+		if attributes[name] == "" {
+			errs = append(errs, "missing required attribute "+name)
+		}
+	}
+
+	if v := attributes["specversion"]; v != "" && v != SpecVersion {
+		errs = append(errs, fmt.Sprintf("unsupported specversion %q", v))
+	}
+	if v := attributes["source"]; v != "" {
+		if _, err := url.Parse(v); err != nil {
+			errs = append(errs, fmt.Sprintf("source %q is not a URI-reference", v))
+		}
+	}
+	if v, ok := attributes["subject"]; ok && v == "" {
+		errs = append(errs, "subject must not be empty")
+	}
+	if v, ok := attributes["time"]; ok {
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			errs = append(errs, fmt.Sprintf("time %q is not an RFC 3339 timestamp", v))
+		}
+	}
+	if v, ok := attributes["datacontenttype"]; ok {
+		if _, _, err := mime.ParseMediaType(v); err != nil {
+			errs = append(errs, fmt.Sprintf("datacontenttype %q is not a media type", v))
+		}
+	}
+	if v, ok := attributes["dataschema"]; ok {
+		if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+			errs = append(errs, fmt.Sprintf("dataschema %q is not an absolute URI", v))
+		}
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !attributeName.MatchString(name) {
+			errs = append(errs, fmt.Sprintf("attribute name %q must consist of lower-case letters and digits", name))
+		}
+	}
+	return errs
+}
+
+// LogFields returns the events as structured log attributes.
+// A single event is logged attribute by attribute, a batch by its size, types and IDs.
+func LogFields(events []store.CloudEvent) []any {
+	if len(events) == 0 {
+		return nil
+	}
+
+	if events[0].Mode != ModeBatch {
+		event := events[0]
+		fields := []any{
+			"ce_mode", event.Mode,
+			"ce_specversion", event.SpecVersion,
+			"ce_id", event.ID,
+			"ce_source", event.Source,
+			"ce_type", event.Type,
+		}
+		if event.Subject != "" {
+			fields = append(fields, "ce_subject", event.Subject)
+		}
+		if event.Time != "" {
+			fields = append(fields, "ce_time", event.Time)
+		}
+		if event.DataContentType != "" {
+			fields = append(fields, "ce_datacontenttype", event.DataContentType)
+		}
+		if len(event.Extensions) > 0 {
+			fields = append(fields, "ce_extensions", event.Extensions)
+		}
+		if len(event.Errors) > 0 {
+			fields = append(fields, "ce_errors", event.Errors)
+		}
+		return fields
+	}
+
+	var types, ids, errs []string
+	for i, event := range events {
+		if !slices.Contains(types, event.Type) {
+			types = append(types, event.Type)
+		}
+		ids = append(ids, event.ID)
+		for _, err := range event.Errors {
+			errs = append(errs, fmt.Sprintf("event %d: %s", i, err))
+		}
+	}
+	fields := []any{
+		"ce_mode", ModeBatch,
+		"ce_count", len(events),
+		"ce_types", types,
+		"ce_ids", ids,
+	}
+	if len(errs) > 0 {
+		fields = append(fields, "ce_errors", errs)
+	}
+	return fields
+}
@@ -0,0 +1,158 @@
+package cloudevents
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func TestParse_Binary(t *testing.T) {
+	header := http.Header{
+		"Ce-Specversion": {"1.0"},
+		"Ce-Id":          {"A234-1234-1234"},
+		"Ce-Source":      {"https://example.com/orders"},
+		"Ce-Type":        {"com.example.order.created"},
+		"Ce-Time":        {"2025-06-05T10:00:00Z"},
+		"Ce-Subject":     {"order%20123"},
+		"Ce-Traceparent": {"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		"Content-Type":   {"application/json"},
+	}
+
+	events := Parse(header, []byte(`{"order":123}`))
+	expected := []store.CloudEvent{{
+		Mode:            ModeBinary,
+		SpecVersion:     "1.0",
+		ID:              "A234-1234-1234",
+		Source:          "https://example.com/orders",
+		Type:            "com.example.order.created",
+		Subject:         "order 123",
+		Time:            "2025-06-05T10:00:00Z",
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+	}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, events)
+	}
+}
+
+func TestParse_Structured(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/cloudevents+json; charset=utf-8"}}
+	body := `{
+		"specversion": "1.0",
+		"id": "A234",
+		"source": "/orders",
+		"type": "com.example.order.created",
+		"datacontenttype": "application/json",
+		"dataschema": "https://example.com/schemas/order.json",
+		"priority": 3,
+		"sampled": true,
+		"data": {"order": 123}
+	}`
+
+	events := Parse(header, []byte(body))
+	if len(events) != 1 {
+		t.Fatalf("Expected one event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Mode != ModeStructured || event.ID != "A234" || event.Source != "/orders" || event.DataSchema == "" {
+		t.Errorf("Unexpected attributes %+v", event)
+	}
+	if !reflect.DeepEqual(event.Extensions, map[string]string{"priority": "3", "sampled": "true"}) {
+		t.Errorf("Expected number and boolean extensions, got %v", event.Extensions)
+	}
+	if len(event.Errors) != 0 {
+		t.Errorf("Expected a valid event, got %v", event.Errors)
+	}
+}
+
+func TestParse_Batch(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/cloudevents-batch+json"}}
+	body := `[
+		{"specversion": "1.0", "id": "1", "source": "/orders", "type": "com.example.order.created"},
+		{"specversion": "1.0", "id": "2", "source": "/orders", "type": "com.example.order.paid", "data_base64": "e30="}
+	]`
+
+	events := Parse(header, []byte(body))
+	if len(events) != 2 || events[0].Mode != ModeBatch || events[1].Type != "com.example.order.paid" {
+		t.Errorf("Expected two batched events, got %+v", events)
+	}
+
+	events = Parse(header, []byte(`{"id": "1"}`))
+	if len(events) != 1 || len(events[0].Errors) != 1 || !strings.HasPrefix(events[0].Errors[0], "invalid JSON batch") {
+		t.Errorf("Expected an invalid batch to be reported, got %+v", events)
+	}
+}
+
+func TestParse_Validation(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/cloudevents+json"}}
+
+	tests := []struct {
+		name  string
+		body  string
+		error string
+	}{
+		{"missing id", `{"specversion":"1.0","source":"/s","type":"t"}`, "missing required attribute id"},
+		{"missing source and type", `{"specversion":"1.0","id":"1"}`, "missing required attribute source"},
+		{"old specversion", `{"specversion":"0.3","id":"1","source":"/s","type":"t"}`, `unsupported specversion "0.3"`},
+		{"invalid time", `{"specversion":"1.0","id":"1","source":"/s","type":"t","time":"yesterday"}`, `time "yesterday" is not an RFC 3339 timestamp`},
+		{"relative dataschema", `{"specversion":"1.0","id":"1","source":"/s","type":"t","dataschema":"/schema"}`, `dataschema "/schema" is not an absolute URI`},
+		{"empty subject", `{"specversion":"1.0","id":"1","source":"/s","type":"t","subject":""}`, "subject must not be empty"},
+		{"numeric id", `{"specversion":"1.0","id":1,"source":"/s","type":"t"}`, "attribute id must be a string"},
+		{"invalid name", `{"specversion":"1.0","id":"1","source":"/s","type":"t","Trace_ID":"x"}`, `attribute name "Trace_ID" must consist of lower-case letters and digits`},
+		{"data and data_base64", `{"specversion":"1.0","id":"1","source":"/s","type":"t","data":{},"data_base64":"e30="}`, "data and data_base64 are mutually exclusive"},
+		{"invalid JSON", `{"specversion":`, "invalid JSON event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := Parse(header, []byte(tt.body))
+			if len(events) != 1 {
+				t.Fatalf("Expected one event, got %d", len(events))
+			}
+			found := false
+			for _, err := range events[0].Errors {
+				if strings.HasPrefix(err, tt.error) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected error %q, got %v", tt.error, events[0].Errors)
+			}
+		})
+	}
+}
+
+func TestParse_NotCloudEvents(t *testing.T) {
+	if events := Parse(http.Header{"Content-Type": {"application/json"}}, []byte(`{"specversion":"1.0"}`)); events != nil {
+		t.Errorf("Expected no events, got %+v", events)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	if fields := LogFields(nil); fields != nil {
+		t.Errorf("Expected no fields, got %v", fields)
+	}
+
+	fields := LogFields([]store.CloudEvent{{Mode: ModeStructured, SpecVersion: "1.0", ID: "1", Source: "/s", Type: "t", Errors: []string{"x"}}})
+	if len(fields) != 12 || fields[len(fields)-2] != "ce_errors" {
+		t.Errorf("Unexpected single event fields %v", fields)
+	}
+
+	fields = LogFields([]store.CloudEvent{
+		{Mode: ModeBatch, ID: "1", Type: "a"},
+		{Mode: ModeBatch, ID: "2", Type: "a", Errors: []string{"missing required attribute source"}},
+	})
+	expected := []any{
+		"ce_mode", ModeBatch,
+		"ce_count", 2,
+		"ce_types", []string{"a"},
+		"ce_ids", []string{"1", "2"},
+		"ce_errors", []string{"event 1: missing required attribute source"},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+}
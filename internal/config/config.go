@@ -1,25 +1,146 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all configuration for the HTTP logger
 type Config struct {
-	Port              string `json:"port"`
-	Host              string `json:"host"`
-	LogLevel          string `json:"log_level"`
-	EnableRequestBody bool   `json:"enable_request_body"`
+	Port                string        `json:"port"`
+	Host                string        `json:"host"`
+	LogLevel            string        `json:"log_level"`
+	EnableRequestBody   bool          `json:"enable_request_body"`
+	BodyMaxSize         int64         `json:"body_max_size"`
+	BodyCaptureMax      int64         `json:"body_capture_max"`
+	BodyLogMax          int           `json:"body_log_max"`
+	BodyLogPretty       bool          `json:"body_log_pretty"`
+	BodySpoolThreshold  int64         `json:"body_spool_threshold"`
+	BodySpoolDir        string        `json:"body_spool_dir"`
+	BodyDecompress      bool          `json:"body_decompress"`
+	BodyDecompressMax   int64         `json:"body_decompress_max"`
+	BodyDecompressRatio int           `json:"body_decompress_ratio"`
+	Store               string        `json:"store"`
+	StorePath           string        `json:"store_path"`
+	StoreMaxRequests    int           `json:"store_max_requests"`
+	StoreMaxBytes       int64         `json:"store_max_bytes"`
+	StoreMaxAge         time.Duration `json:"store_max_age"`
+	StreamOrigins       []string      `json:"stream_allowed_origins"`
+	AdminToken          Secret        `json:"admin_token"`
+	MockRulesFile       string        `json:"mock_rules_file"`
+	SignatureRulesFile  string        `json:"signature_rules_file"`
+	Handshakes          bool          `json:"handshakes"`
+	TwitterSecret       Secret        `json:"twitter_consumer_secret"`
+	ZoomSecret          Secret        `json:"zoom_secret_token"`
+	MetaVerifyToken     Secret        `json:"meta_verify_token"`
+	SNSConfirm          bool          `json:"sns_confirm"`
+	Dedup               bool          `json:"dedup"`
+	DedupWindow         time.Duration `json:"dedup_window"`
+	DedupMaxKeys        int           `json:"dedup_max_keys"`
+	DedupHeaders        []string      `json:"dedup_headers"`
+	UpstreamURL         string        `json:"upstream_url"`
+	UpstreamTimeout     time.Duration `json:"upstream_timeout"`
+	UpstreamRetries     int           `json:"upstream_retries"`
+	RetryStatuses       []int         `json:"retry_statuses"`
+	RetryBackoff        time.Duration `json:"retry_backoff"`
+	RetryMaxBackoff     time.Duration `json:"retry_max_backoff"`
+	DeadLetterSize      int           `json:"dead_letter_size"`
+	RewriteRulesFile    string        `json:"rewrite_rules_file"`
+	MirrorTargets       []string      `json:"mirror_targets"`
+	MirrorTimeout       time.Duration `json:"mirror_timeout"`
+	MirrorConcurrency   int           `json:"mirror_concurrency"`
+	MirrorQueueSize     int           `json:"mirror_queue_size"`
+	DiffTarget          string        `json:"diff_target"`
+	DiffHeaders         []string      `json:"diff_headers"`
+	DiffIgnore          []string      `json:"diff_ignore"`
+	VCRMode             string        `json:"vcr_mode"`
+	VCRCassette         string        `json:"vcr_cassette"`
+	VCRMatch            []string      `json:"vcr_match"`
+	VCRStrict           bool          `json:"vcr_strict"`
+	Relay               bool          `json:"relay"`
+	RelayToken          Secret        `json:"relay_token"`
+	RelayLease          time.Duration `json:"relay_lease"`
+	RelayQueueSize      int           `json:"relay_queue_size"`
+}
+
+// Secret is a configuration value that is redacted when the configuration is logged
+type Secret string
+
+// String returns a placeholder instead of the value
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// MarshalJSON encodes the placeholder instead of the value
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
 }
 
 // Load returns a configuration with values from environment variables or defaults
 func Load() Config {
+	upstreamURL := getEnv("UPSTREAM_URL", "")
+
 	return Config{
-		Port:              getEnv("PORT", "8080"),
-		Host:              getEnv("HOST", "0.0.0.0"),
-		LogLevel:          getEnv("LOG_LEVEL", "info"),
-		EnableRequestBody: getBoolEnv("ENABLE_REQUEST_BODY", true),
+		Port:                getEnv("PORT", "8080"),
+		Host:                getEnv("HOST", "0.0.0.0"),
+		LogLevel:            getEnv("LOG_LEVEL", "info"),
+		EnableRequestBody:   getBoolEnv("ENABLE_REQUEST_BODY", true),
+		BodyMaxSize:         getInt64Env("BODY_MAX_SIZE", 0),
+		BodyCaptureMax:      getInt64Env("BODY_CAPTURE_MAX", 1<<20),
+		BodyLogMax:          getIntEnv("BODY_LOG_MAX", 1024),
+		BodyLogPretty:       getBoolEnv("BODY_LOG_PRETTY", false),
+		BodySpoolThreshold:  getInt64Env("BODY_SPOOL_THRESHOLD", 1<<20),
+		BodySpoolDir:        getEnv("BODY_SPOOL_DIR", ""),
+		BodyDecompress:      getBoolEnv("BODY_DECOMPRESS", true),
+		BodyDecompressMax:   getInt64Env("BODY_DECOMPRESS_MAX", 10<<20),
+		BodyDecompressRatio: getIntEnv("BODY_DECOMPRESS_RATIO", 100),
+		Store:               getEnv("STORE", "memory"),
+		StorePath:           getEnv("STORE_PATH", "data"),
+		StoreMaxRequests:    getIntEnv("STORE_MAX_REQUESTS", 1000),
+		StoreMaxBytes:       getInt64Env("STORE_MAX_BYTES", 64<<20),
+		StoreMaxAge:         getDurationEnv("STORE_MAX_AGE", 0),
+		StreamOrigins:       getListEnv("STREAM_ALLOWED_ORIGINS", nil),
+		AdminToken:          Secret(getEnv("ADMIN_TOKEN", "")),
+		MockRulesFile:       getEnv("MOCK_RULES_FILE", ""),
+		SignatureRulesFile:  getEnv("SIGNATURE_RULES_FILE", ""),
+		Handshakes:          getBoolEnv("HANDSHAKES", upstreamURL == ""),
+		TwitterSecret:       Secret(getEnv("TWITTER_CONSUMER_SECRET", "")),
+		ZoomSecret:          Secret(getEnv("ZOOM_SECRET_TOKEN", "")),
+		MetaVerifyToken:     Secret(getEnv("META_VERIFY_TOKEN", "")),
+		SNSConfirm:          getBoolEnv("SNS_CONFIRM", true),
+		Dedup:               getBoolEnv("DEDUP", true),
+		DedupWindow:         getDurationEnv("DEDUP_WINDOW", 24*time.Hour),
+		DedupMaxKeys:        getIntEnv("DEDUP_MAX_KEYS", 10000),
+		DedupHeaders:        getListEnv("DEDUP_HEADERS", []string{"Idempotency-Key", "X-Idempotency-Key"}),
+		UpstreamURL:         upstreamURL,
+		UpstreamTimeout:     getDurationEnv("UPSTREAM_TIMEOUT", 30*time.Second),
+		UpstreamRetries:     getIntEnv("UPSTREAM_RETRIES", 0),
+		RetryStatuses:       getIntListEnv("UPSTREAM_RETRY_STATUSES", []int{502, 503, 504}),
+		RetryBackoff:        getDurationEnv("UPSTREAM_RETRY_BACKOFF", 500*time.Millisecond),
+		RetryMaxBackoff:     getDurationEnv("UPSTREAM_RETRY_MAX_BACKOFF", 10*time.Second),
+		DeadLetterSize:      getIntEnv("DEAD_LETTER_SIZE", 1000),
+		RewriteRulesFile:    getEnv("REWRITE_RULES_FILE", ""),
+		MirrorTargets:       getListEnv("MIRROR_TARGETS", nil),
+		MirrorTimeout:       getDurationEnv("MIRROR_TIMEOUT", 10*time.Second),
+		MirrorConcurrency:   getIntEnv("MIRROR_CONCURRENCY", 4),
+		MirrorQueueSize:     getIntEnv("MIRROR_QUEUE_SIZE", 100),
+		DiffTarget:          getEnv("DIFF_TARGET", ""),
+		DiffHeaders:         getListEnv("DIFF_HEADERS", []string{"Content-Type"}),
+		DiffIgnore:          getListEnv("DIFF_IGNORE", nil),
+		VCRMode:             getEnv("VCR_MODE", ""),
+		VCRCassette:         getEnv("VCR_CASSETTE", "cassette.json"),
+		VCRMatch:            getListEnv("VCR_MATCH", []string{"method", "path", "query"}),
+		VCRStrict:           getBoolEnv("VCR_STRICT", false),
+		Relay:               getBoolEnv("RELAY", false),
+		RelayToken:          Secret(getEnv("RELAY_TOKEN", "")),
+		RelayLease:          getDurationEnv("RELAY_LEASE", 30*time.Second),
+		RelayQueueSize:      getIntEnv("RELAY_QUEUE_SIZE", 1000),
 	}
 }
 
@@ -38,3 +159,63 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getInt64Env(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getListEnv returns the non-empty comma separated values of an environment variable
+func getListEnv(key string, defaultValue []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// getIntListEnv returns the comma separated integers of an environment variable,
+// or the default when any of them is invalid
+func getIntListEnv(key string, defaultValue []int) []int {
+	values := getListEnv(key, nil)
+	if len(values) == 0 {
+		return defaultValue
+	}
+
+	ints := make([]int, 0, len(values))
+	for _, value := range values {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return defaultValue
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -66,6 +70,39 @@ func TestLoad(t *testing.T) {
 	})
 }
 
+func TestLoad_Handshakes(t *testing.T) {
+	t.Setenv("HANDSHAKES", "")
+	t.Setenv("UPSTREAM_URL", "")
+	if cfg := Load(); !cfg.Handshakes {
+		t.Error("Expected handshakes to be answered by default")
+	}
+
+	// In forwarding mode the upstream answers handshakes unless they are enabled
+	t.Setenv("UPSTREAM_URL", "http://localhost:3000")
+	if cfg := Load(); cfg.Handshakes {
+		t.Error("Expected handshakes to be passed to the upstream by default")
+	}
+	t.Setenv("HANDSHAKES", "true")
+	if cfg := Load(); !cfg.Handshakes {
+		t.Error("Expected handshakes to be answered when enabled")
+	}
+}
+
+func TestLoad_BodyLimits(t *testing.T) {
+	t.Setenv("BODY_CAPTURE_MAX", "")
+	t.Setenv("BODY_LOG_MAX", "")
+	if cfg := Load(); cfg.BodyCaptureMax != 1<<20 || cfg.BodyLogMax != 1024 {
+		t.Errorf("Expected the default body limits, got %d and %d", cfg.BodyCaptureMax, cfg.BodyLogMax)
+	}
+
+	// Zero is kept, it disables capturing and logging bodies
+	t.Setenv("BODY_CAPTURE_MAX", "0")
+	t.Setenv("BODY_LOG_MAX", "0")
+	if cfg := Load(); cfg.BodyCaptureMax != 0 || cfg.BodyLogMax != 0 {
+		t.Errorf("Expected zero body limits, got %d and %d", cfg.BodyCaptureMax, cfg.BodyLogMax)
+	}
+}
+
 func TestGetEnv(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -195,3 +232,148 @@ func TestGetBoolEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestGetIntEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		defaultValue int
+		envValue     string
+		expected     int
+	}{
+		{
+			name:         "valid value",
+			key:          "TEST_INT",
+			defaultValue: 10,
+			envValue:     "42",
+			expected:     42,
+		},
+		{
+			name:         "negative value",
+			key:          "TEST_INT",
+			defaultValue: 10,
+			envValue:     "-1",
+			expected:     -1,
+		},
+		{
+			name:         "invalid value uses default",
+			key:          "TEST_INT",
+			defaultValue: 10,
+			envValue:     "ten",
+			expected:     10,
+		},
+		{
+			name:         "unset value uses default",
+			key:          "NONEXISTENT_INT",
+			defaultValue: 10,
+			envValue:     "",
+			expected:     10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := os.Getenv(tt.key)
+			defer os.Setenv(tt.key, original)
+
+			if tt.envValue != "" {
+				os.Setenv(tt.key, tt.envValue)
+			} else {
+				os.Unsetenv(tt.key)
+			}
+
+			result := getIntEnv(tt.key, tt.defaultValue)
+			if result != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestGetInt64Env(t *testing.T) {
+	original := os.Getenv("TEST_INT64")
+	defer os.Setenv("TEST_INT64", original)
+
+	os.Setenv("TEST_INT64", "68719476736")
+	if result := getInt64Env("TEST_INT64", 1); result != 68719476736 {
+		t.Errorf("Expected 68719476736, got %d", result)
+	}
+
+	os.Setenv("TEST_INT64", "invalid")
+	if result := getInt64Env("TEST_INT64", 1); result != 1 {
+		t.Errorf("Expected default 1, got %d", result)
+	}
+}
+
+func TestGetDurationEnv(t *testing.T) {
+	original := os.Getenv("TEST_DURATION")
+	defer os.Setenv("TEST_DURATION", original)
+
+	os.Setenv("TEST_DURATION", "36h")
+	if result := getDurationEnv("TEST_DURATION", time.Minute); result != 36*time.Hour {
+		t.Errorf("Expected 36h, got %v", result)
+	}
+
+	os.Setenv("TEST_DURATION", "3 days")
+	if result := getDurationEnv("TEST_DURATION", time.Minute); result != time.Minute {
+		t.Errorf("Expected default 1m, got %v", result)
+	}
+
+	os.Unsetenv("TEST_DURATION")
+	if result := getDurationEnv("TEST_DURATION", time.Minute); result != time.Minute {
+		t.Errorf("Expected default 1m, got %v", result)
+	}
+}
+
+func TestGetListEnv(t *testing.T) {
+	os.Setenv("TEST_LIST", " http://a:8080, ,http://b:8080 ")
+	defer os.Unsetenv("TEST_LIST")
+
+	result := getListEnv("TEST_LIST", nil)
+	if len(result) != 2 || result[0] != "http://a:8080" || result[1] != "http://b:8080" {
+		t.Errorf("Expected two trimmed values, got %q", result)
+	}
+
+	os.Unsetenv("TEST_LIST")
+	if result := getListEnv("TEST_LIST", nil); len(result) != 0 {
+		t.Errorf("Expected no values, got %q", result)
+	}
+}
+
+func TestGetIntListEnv(t *testing.T) {
+	defer os.Unsetenv("TEST_INT_LIST")
+	defaultValue := []int{502, 503}
+
+	os.Setenv("TEST_INT_LIST", "429, 503")
+	if result := getIntListEnv("TEST_INT_LIST", defaultValue); len(result) != 2 || result[0] != 429 || result[1] != 503 {
+		t.Errorf("Expected [429 503], got %v", result)
+	}
+
+	os.Setenv("TEST_INT_LIST", "429,unavailable")
+	if result := getIntListEnv("TEST_INT_LIST", defaultValue); len(result) != 2 || result[0] != 502 {
+		t.Errorf("Expected the default for an invalid value, got %v", result)
+	}
+
+	os.Unsetenv("TEST_INT_LIST")
+	if result := getIntListEnv("TEST_INT_LIST", defaultValue); len(result) != 2 || result[0] != 502 {
+		t.Errorf("Expected the default, got %v", result)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	cfg := Config{RelayToken: "hunter2"}
+
+	if text := fmt.Sprintf("%+v", cfg); strings.Contains(text, "hunter2") {
+		t.Errorf("Expected the secret to be redacted, got %s", text)
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), `"relay_token":"[REDACTED]"`) {
+		t.Errorf("Expected the secret to be redacted, got %s", data)
+	}
+	if string(cfg.RelayToken) != "hunter2" {
+		t.Error("Expected the value to be kept")
+	}
+}
@@ -0,0 +1,21 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the embedded dashboard files.
+// It expects the dashboard path prefix to be stripped from the request URL.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is part of the binary, so this cannot happen at runtime
+		panic(err)
+	}
+	return http.FileServerFS(files)
+}
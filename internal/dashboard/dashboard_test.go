@@ -0,0 +1,52 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler()
+
+	tests := []struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		{path: "/", contentType: "text/html", contains: "Request Raccoon"},
+		{path: "/app.js", contentType: "javascript", contains: "renderDetail"},
+		{path: "/style.css", contentType: "text/css", contains: "#requests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); !strings.Contains(ct, tt.contentType) {
+				t.Errorf("Expected Content-Type containing %s, got %s", tt.contentType, ct)
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("Expected body to contain %q", tt.contains)
+			}
+		})
+	}
+}
+
+func TestHandler_NoExternalResources(t *testing.T) {
+	for _, name := range []string{"static/index.html", "static/app.js", "static/style.css"} {
+		content, err := static.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if strings.Contains(string(content), "http://") || strings.Contains(string(content), "https://") {
+			t.Errorf("%s must not load resources from external hosts", name)
+		}
+	}
+}
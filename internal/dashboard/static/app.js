@@ -0,0 +1,307 @@
+"use strict";
+
+// The dashboard is served from <prefix>/ui/, the API lives at <prefix>/api/
+const API = new URL("../api/", window.location.href).pathname;
+const MAX_REQUESTS = 500;
+// TOKEN_KEY names the admin token in the session storage, asked for when the server sets ADMIN_TOKEN
+const TOKEN_KEY = "raccoon-admin-token";
+
+const state = {
+  requests: new Map(),
+  selected: null,
+  filter: "",
+};
+
+const els = {
+  list: document.getElementById("requests"),
+  empty: document.getElementById("empty"),
+  detail: document.getElementById("detail-pane"),
+  filter: document.getElementById("filter"),
+  follow: document.getElementById("follow"),
+  clear: document.getElementById("clear"),
+  status: document.getElementById("status"),
+  template: document.getElementById("detail-template"),
+};
+
+function setStatus(text) {
+  els.status.textContent = text;
+}
+
+// addRequests merges captured requests into the state and re-renders the list
+function addRequests(requests, highlight) {
+  const added = [];
+  for (const req of requests) {
+    if (!state.requests.has(req.id)) {
+      added.push(req.id);
+    }
+    state.requests.set(req.id, req);
+  }
+
+  // Drop the oldest requests to keep the page responsive
+  const sorted = sortedRequests();
+  for (const req of sorted.slice(MAX_REQUESTS)) {
+    state.requests.delete(req.id);
+  }
+
+  renderList(highlight ? new Set(added) : new Set());
+  if (els.follow.checked && added.length > 0) {
+    select(sortedRequests()[0].id);
+  } else if (state.selected && state.requests.has(state.selected)) {
+    renderDetail(state.requests.get(state.selected));
+  }
+}
+
+function sortedRequests() {
+  return [...state.requests.values()].sort((a, b) =>
+    a.received_at < b.received_at ? 1 : a.received_at > b.received_at ? -1 : 0,
+  );
+}
+
+function matchesFilter(req) {
+  if (!state.filter) {
+    return true;
+  }
+  const needle = state.filter.toLowerCase();
+  return req.method.toLowerCase().includes(needle) || req.url.toLowerCase().includes(needle);
+}
+
+function renderList(highlighted) {
+  const visible = sortedRequests().filter(matchesFilter);
+  els.list.replaceChildren(
+    ...visible.map((req) => {
+      const li = document.createElement("li");
+      li.dataset.id = req.id;
+      if (req.id === state.selected) {
+        li.classList.add("selected");
+      }
+      if (highlighted.has(req.id)) {
+        li.classList.add("new");
+      }
+
+      const method = document.createElement("span");
+      method.className = "method";
+      method.textContent = req.method;
+
+      const path = document.createElement("span");
+      path.className = "path";
+      path.textContent = req.url;
+      path.title = req.url;
+
+      const meta = document.createElement("span");
+      meta.className = "time";
+      const status = req.response ? req.response.status + " · " : "";
+      meta.textContent = status + new Date(req.received_at).toLocaleTimeString();
+
+      li.append(method, path, meta);
+      li.addEventListener("click", () => {
+        els.follow.checked = false;
+        select(req.id);
+      });
+      return li;
+    }),
+  );
+  els.empty.hidden = visible.length > 0;
+}
+
+function select(id) {
+  state.selected = id;
+  for (const li of els.list.children) {
+    li.classList.toggle("selected", li.dataset.id === id);
+  }
+  renderDetail(state.requests.get(id));
+}
+
+function row(key, value) {
+  const tr = document.createElement("tr");
+  const k = document.createElement("td");
+  k.textContent = key;
+  const v = document.createElement("td");
+  v.textContent = value;
+  tr.append(k, v);
+  return tr;
+}
+
+function fillTable(table, entries) {
+  table.replaceChildren(...entries.map(([k, v]) => row(k, v)));
+}
+
+function fillList(dl, entries) {
+  dl.replaceChildren(
+    ...entries.flatMap(([k, v]) => {
+      const dt = document.createElement("dt");
+      dt.textContent = k;
+      const dd = document.createElement("dd");
+      dd.textContent = v;
+      return [dt, dd];
+    }),
+  );
+}
+
+function headerEntries(headers) {
+  return Object.entries(headers || {})
+    .sort(([a], [b]) => a.localeCompare(b))
+    .flatMap(([name, values]) => values.map((v) => [name, v]));
+}
+
+// decodeBody turns a base64 body in the given charset into readable text, pretty-printing JSON
+function decodeBody(body, charset = "utf-8") {
+  if (!body) {
+    return "(empty)";
+  }
+
+  const binary = atob(body);
+  const bytes = Uint8Array.from(binary, (c) => c.charCodeAt(0));
+  let text;
+  try {
+    text = new TextDecoder(charset, { fatal: true }).decode(bytes);
+  } catch {
+    return `(${bytes.length} bytes of binary data, base64)\n${body}`;
+  }
+
+  try {
+    return JSON.stringify(JSON.parse(text), null, 2);
+  } catch {
+    return text;
+  }
+}
+
+function renderDetail(req) {
+  if (!req) {
+    const p = document.createElement("p");
+    p.className = "empty";
+    p.textContent = "Select a request to inspect it.";
+    els.detail.replaceChildren(p);
+    return;
+  }
+
+  const node = els.template.content.cloneNode(true);
+  node.querySelector(".method").textContent = req.method;
+  node.querySelector(".url").textContent = req.url;
+
+  const meta = [
+    ["ID", req.id],
+    ["Received", new Date(req.received_at).toLocaleString()],
+    ["Remote address", req.remote_addr],
+    ["Host", req.host],
+    ["Protocol", req.proto],
+  ];
+  if (req.tls) {
+    meta.push(["TLS", `${req.tls.version} ${req.tls.cipher_suite}`]);
+  }
+  if (req.content) {
+    meta.push(["Body", `${req.content.format} (${req.content.sniffed || req.content.media_type})`]);
+  }
+  fillList(node.querySelector(".meta"), meta);
+
+  const query = new URLSearchParams(req.query || "");
+  fillTable(node.querySelector(".query"), [...query.entries()]);
+  fillTable(node.querySelector(".headers"), headerEntries(req.headers));
+  let body = decodeBody(req.decoded_body || req.body, req.content?.charset);
+  if (req.decode_error) {
+    body += `\n(${req.decode_error})`;
+  }
+  if (req.body_truncated) {
+    body += `\n(truncated, ${req.body_size} bytes)`;
+  }
+  node.querySelector(".body").textContent = body;
+
+  if (req.response) {
+    const duration = new Date(req.completed_at) - new Date(req.received_at);
+    const responseMeta = [
+      ["Status", String(req.response.status)],
+      ["Size", `${req.response.size} bytes`],
+      ["Duration", `${duration} ms`],
+    ];
+    if (req.mock_rule) {
+      responseMeta.push(["Mock rule", req.mock_rule]);
+    }
+    fillList(node.querySelector(".response-meta"), responseMeta);
+    fillTable(node.querySelector(".response-headers"), headerEntries(req.response.headers));
+  }
+
+  if (req.upstream) {
+    const upstream = [
+      ["URL", req.upstream.url],
+      ["Latency", `${Math.round(req.upstream.latency / 1e6)} ms`],
+    ];
+    if (req.upstream.status) {
+      upstream.push(["Status", String(req.upstream.status)]);
+    }
+    if (req.upstream.error) {
+      upstream.push(["Error", req.upstream.error]);
+    }
+    node.querySelector(".upstream").hidden = false;
+    fillList(node.querySelector(".upstream-meta"), upstream);
+    fillTable(node.querySelector(".upstream-headers"), headerEntries(req.upstream.headers));
+    node.querySelector(".upstream-body").textContent =
+      decodeBody(req.upstream.body) + (req.upstream.body_truncated ? "\n(truncated)" : "");
+  }
+
+  els.detail.replaceChildren(node);
+}
+
+// apiFetch calls the API with the admin token, asking for it when the server rejects the request
+async function apiFetch(path, init = {}) {
+  const token = sessionStorage.getItem(TOKEN_KEY);
+  const headers = token ? { Authorization: `Bearer ${token}` } : {};
+  const res = await fetch(`${API}${path}`, { ...init, headers });
+  if (res.status === 401) {
+    const entered = window.prompt("Admin token");
+    if (entered) {
+      sessionStorage.setItem(TOKEN_KEY, entered);
+      return apiFetch(path, init);
+    }
+  }
+  return res;
+}
+
+// load fetches the most recent requests, used on start and after reconnecting
+async function load() {
+  try {
+    const res = await apiFetch(`requests?limit=${MAX_REQUESTS}`);
+    if (!res.ok) {
+      throw new Error(`HTTP ${res.status}`);
+    }
+    const data = await res.json();
+    addRequests(data.requests, state.requests.size > 0);
+  } catch (err) {
+    setStatus(`offline (${err.message})`);
+  }
+}
+
+// connect subscribes to the live event stream; EventSource reconnects by itself.
+// It cannot send headers, so the admin token goes in the query.
+function connect() {
+  const token = sessionStorage.getItem(TOKEN_KEY);
+  const query = token ? `?access_token=${encodeURIComponent(token)}` : "";
+  const events = new EventSource(`${API}stream${query}`);
+  events.addEventListener("open", () => {
+    setStatus("live");
+    load();
+  });
+  events.addEventListener("error", () => {
+    setStatus("reconnecting…");
+  });
+  events.addEventListener("request", (e) => {
+    addRequests([JSON.parse(e.data)], true);
+  });
+}
+
+els.filter.addEventListener("input", () => {
+  state.filter = els.filter.value.trim();
+  renderList(new Set());
+});
+
+els.clear.addEventListener("click", async () => {
+  if (!window.confirm("Delete all captured requests?")) {
+    return;
+  }
+  await apiFetch("requests", { method: "DELETE" });
+  state.requests.clear();
+  state.selected = null;
+  renderList(new Set());
+  renderDetail(null);
+});
+
+// The first load asks for the admin token, if needed, before the stream uses it
+load().then(connect);
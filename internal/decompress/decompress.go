@@ -0,0 +1,152 @@
+// Package decompress decodes request bodies according to their Content-Encoding, guarding against
+// decompression bombs.
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Defaults of Options
+const (
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxRatio = 100
+)
+
+// zstdMaxWindow is the largest Zstandard window accepted, the limit RFC 8878 sets for the zstd content coding
+const zstdMaxWindow = 8 << 20
+
+var (
+	// ErrUnsupported is returned for content codings that cannot be decoded
+	ErrUnsupported = errors.New("unsupported content encoding")
+	// ErrTooLarge is returned when a body decompresses beyond the configured limits
+	ErrTooLarge = errors.New("decompressed body too large")
+)
+
+// Options bound how far a body is decompressed
+type Options struct {
+	// MaxSize is the largest decompressed body, DefaultMaxSize when zero
+	MaxSize int64
+	// MaxRatio is the largest ratio of the decompressed to the compressed size, DefaultMaxRatio when zero
+	MaxRatio int
+}
+
+// Encodings returns the content codings of a Content-Encoding header in the order they were applied,
+// leaving out identity.
+func Encodings(contentEncoding string) []string {
+	var encodings []string
+	for _, coding := range strings.Split(contentEncoding, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			encodings = append(encodings, coding)
+		}
+	}
+	return encodings
+}
+
+// Decode undoes the content codings of a Content-Encoding header, the last applied first.
+// When decoding fails, the error is returned with what the failing coding decoded before it failed, if anything.
+func Decode(contentEncoding string, data []byte, opts Options) ([]byte, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxRatio <= 0 {
+		opts.MaxRatio = DefaultMaxRatio
+	}
+	limit := min(opts.MaxSize, int64(len(data))*int64(opts.MaxRatio))
+
+	encodings := Encodings(contentEncoding)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoded, err := decode(encodings[i], data, limit)
+		if err != nil {
+			return decoded, err
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// decode undoes a single content coding, decoding at most limit bytes
+func decode(coding string, data []byte, limit int64) ([]byte, error) {
+	var decoded []byte
+	var err error
+	switch coding {
+	case "gzip", "x-gzip", "deflate":
+		decoded, err = inflate(coding, data, limit+1)
+	case "br":
+		decoded, err = unbrotli(data, limit+1)
+	case "zstd":
+		decoded, err = unzstd(data, limit+1)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupported, coding)
+	}
+	if err != nil {
+		return decoded, fmt.Errorf("decode %s: %w", coding, err)
+	}
+	if int64(len(decoded)) > limit {
+		return decoded[:limit], fmt.Errorf("%w: over %d bytes", ErrTooLarge, limit)
+	}
+	return decoded, nil
+}
+
+// inflate decodes a gzip or deflate body, stopping once limit bytes are decoded
+func inflate(coding string, data []byte, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	if coding == "deflate" {
+		// deflate is zlib-wrapped, but some senders use raw deflate
+		r, err = zlib.NewReader(bytes.NewReader(data))
+		if errors.Is(err, zlib.ErrHeader) {
+			r, err = flate.NewReader(bytes.NewReader(data)), nil
+		}
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readAll(r, limit)
+}
+
+// unbrotli decodes a Brotli body, stopping once limit bytes are decoded.
+// The reader ends a truncated stream like a complete one, without an error.
+func unbrotli(data []byte, limit int64) ([]byte, error) {
+	return readAll(brotli.NewReader(bytes.NewReader(data)), limit)
+}
+
+// unzstd decodes a Zstandard body, stopping once limit bytes are decoded.
+// Frames needing a dictionary are not supported, as senders have no way to name one.
+func unzstd(data []byte, limit int64) ([]byte, error) {
+	r, err := zstd.NewReader(bytes.NewReader(data),
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderLowmem(true),
+		zstd.WithDecoderMaxWindow(zstdMaxWindow))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := readAll(r, limit)
+	if errors.Is(err, zstd.ErrUnknownDictionary) {
+		err = fmt.Errorf("%w: zstd dictionary", ErrUnsupported)
+	}
+	return decoded, err
+}
+
+// readAll reads r up to limit bytes
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, io.LimitReader(r, limit))
+	return buf.Bytes(), err
+}
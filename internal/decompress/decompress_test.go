@@ -0,0 +1,204 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func deflated(t *testing.T, data []byte, raw bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w interface {
+		Write([]byte) (int, error)
+		Close() error
+	}
+	if raw {
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	} else {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func brotlied(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, data []byte) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
+
+var payload = strings.Repeat(`{"event":"push","ref":"refs/heads/main"}`+"\n", 16)
+
+func TestEncodings(t *testing.T) {
+	if got := Encodings(" deflate, identity,GZIP "); !reflect.DeepEqual(got, []string{"deflate", "gzip"}) {
+		t.Errorf("Expected deflate and gzip, got %v", got)
+	}
+	if got := Encodings(""); got != nil {
+		t.Errorf("Expected no encodings, got %v", got)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	body := []byte(`{"event":"push"}`)
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+	}{
+		{"gzip", "gzip", gzipped(t, body)},
+		{"x-gzip", "x-gzip", gzipped(t, body)},
+		{"zlib deflate", "deflate", deflated(t, body, false)},
+		{"raw deflate", "deflate", deflated(t, body, true)},
+		{"stacked", "deflate, gzip", gzipped(t, deflated(t, body, false))},
+		{"identity", "identity", body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.encoding, tt.data, Options{})
+			if err != nil || !bytes.Equal(got, body) {
+				t.Errorf("Expected %s, got %q (%v)", body, got, err)
+			}
+		})
+	}
+}
+
+func TestDecode_BrotliZstd(t *testing.T) {
+	tests := []struct {
+		encoding string
+		data     []byte
+	}{
+		{"br", brotlied(t, []byte(payload))},
+		{"zstd", zstded(t, []byte(payload))},
+		{"br, gzip", gzipped(t, brotlied(t, []byte(payload)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			got, err := Decode(tt.encoding, tt.data, Options{})
+			if err != nil || string(got) != payload {
+				t.Errorf("Expected the payload, got %q (%v)", got, err)
+			}
+		})
+	}
+
+	// Two concatenated Zstandard frames and a skippable frame decode as one body
+	frame := zstded(t, []byte(payload))
+	frames := slices.Concat(frame, []byte("\x50\x2a\x4d\x18\x02\x00\x00\x00hi"), frame)
+	if got, err := Decode("zstd", frames, Options{}); err != nil || string(got) != payload+payload {
+		t.Errorf("Expected the payload twice, got %d bytes (%v)", len(got), err)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	for _, encoding := range []string{"compress", "x-unknown", "gzip, compress"} {
+		if got, err := Decode(encoding, []byte("x"), Options{}); !errors.Is(err, ErrUnsupported) || got != nil {
+			t.Errorf("Expected %s to be unsupported, got %q (%v)", encoding, got, err)
+		}
+	}
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		if _, err := Decode(encoding, []byte("not "+encoding), Options{}); err == nil || !strings.HasPrefix(err.Error(), "decode "+encoding) {
+			t.Errorf("Expected an invalid %s body to fail, got %v", encoding, err)
+		}
+	}
+
+	// Zstandard frames that need a dictionary are not supported
+	if _, err := Decode("zstd", []byte("(\xb5/\xfd\x01\x07\x2a\x01\x00\x00"), Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected a zstd dictionary to be unsupported, got %v", err)
+	}
+
+	// A truncated body decodes as far as it goes
+	var text strings.Builder
+	for i := range 10000 {
+		text.WriteString(strconv.Itoa(i * 7919))
+	}
+	data := gzipped(t, []byte(text.String()))
+	got, err := Decode("gzip", data[:len(data)/2], Options{})
+	if err == nil || len(got) == 0 || !strings.HasPrefix(text.String(), string(got)) {
+		t.Errorf("Expected the start of a truncated body with an error, got %d bytes (%v)", len(got), err)
+	}
+
+	data = zstded(t, []byte(text.String()))
+	if got, err := Decode("zstd", data[:len(data)/2], Options{}); err == nil || !strings.HasPrefix(text.String(), string(got)) {
+		t.Errorf("Expected a truncated zstd body to fail, got %d bytes (%v)", len(got), err)
+	}
+
+	// The Brotli reader cannot tell a truncated stream from a complete one, but only decodes what is there
+	data = brotlied(t, []byte(text.String()))
+	if got, _ := Decode("br", data[:len(data)/2], Options{}); !strings.HasPrefix(text.String(), string(got)) {
+		t.Errorf("Expected the start of a truncated br body, got %d bytes", len(got))
+	}
+}
+
+func TestDecode_Bomb(t *testing.T) {
+	data := gzipped(t, make([]byte, 1<<20))
+
+	got, err := Decode("gzip", data, Options{})
+	if !errors.Is(err, ErrTooLarge) || int64(len(got)) != int64(len(data))*DefaultMaxRatio {
+		t.Errorf("Expected decoding to stop at the ratio, got %d bytes (%v)", len(got), err)
+	}
+
+	got, err = Decode("gzip", data, Options{MaxSize: 100, MaxRatio: 10000})
+	if !errors.Is(err, ErrTooLarge) || len(got) != 100 {
+		t.Errorf("Expected decoding to stop at the size, got %d bytes (%v)", len(got), err)
+	}
+
+	zeros := make([]byte, 1<<20)
+	for encoding, data := range map[string][]byte{"br": brotlied(t, zeros), "zstd": zstded(t, zeros)} {
+		got, err := Decode(encoding, data, Options{})
+		if !errors.Is(err, ErrTooLarge) || len(got) != len(data)*DefaultMaxRatio || bytes.ContainsFunc(got, func(r rune) bool { return r != 0 }) {
+			t.Errorf("Expected %s decoding to stop at the ratio, got %d bytes (%v)", encoding, len(got), err)
+		}
+
+		got, err = Decode(encoding, data, Options{MaxSize: 100, MaxRatio: 1 << 20})
+		if !errors.Is(err, ErrTooLarge) || len(got) != 100 {
+			t.Errorf("Expected %s decoding to stop at the size, got %d bytes (%v)", encoding, len(got), err)
+		}
+	}
+}
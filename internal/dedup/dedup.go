@@ -0,0 +1,250 @@
+// Package dedup recognises repeated deliveries of the same request by their fingerprint.
+package dedup
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Defaults for Options fields left at zero
+const (
+	DefaultWindow  = 24 * time.Hour
+	DefaultMaxKeys = 10000
+)
+
+// DefaultHeaders are the idempotency key headers used when Options sets none
+var DefaultHeaders = []string{"Idempotency-Key", "X-Idempotency-Key"}
+
+// Fingerprint kinds, from the most to the least specific
+const (
+	ByDeliveryID     = "delivery_id"
+	ByIdempotencyKey = "idempotency_key"
+	ByBody           = "body"
+)
+
+// Options configures a Detector.
+type Options struct {
+	// Window is how long a delivery is remembered
+	Window time.Duration
+	// MaxKeys bounds the number of remembered deliveries, the oldest are forgotten first
+	MaxKeys int
+	// Headers are idempotency key headers, checked in order
+	Headers []string
+}
+
+// Group is a fingerprint that was delivered more than once.
+type Group struct {
+	By          string    `json:"by"`
+	Key         string    `json:"key"`
+	Count       int       `json:"count"`
+	FirstID     string    `json:"first_id"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	FirstStatus int       `json:"first_status,omitempty"`
+}
+
+type entry struct {
+	Group
+	element *list.Element
+}
+
+// Detector remembers the fingerprints of captured requests and flags repeated deliveries.
+// Requests are identified by the webhook delivery ID, an idempotency key header or, for requests with a body,
+// the method, path and body hash.
+type Detector struct {
+	window  time.Duration
+	maxKeys int
+	headers []string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// order holds the entries by first delivery, oldest first
+	order *list.List
+}
+
+// New creates a detector with the given options.
+func New(opts Options) *Detector {
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultMaxKeys
+	}
+	if len(opts.Headers) == 0 {
+		opts.Headers = DefaultHeaders
+	}
+	return &Detector{
+		window:  opts.Window,
+		maxKeys: opts.MaxKeys,
+		headers: opts.Headers,
+		entries: make(map[string]*entry),
+		order:   list.New(),
+	}
+}
+
+// Check remembers the request and returns the earlier delivery it repeats, or nil for a first delivery.
+func (d *Detector) Check(rec *store.CapturedRequest) *store.Duplicate {
+	by, key := d.fingerprint(rec)
+	if key == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(rec.ReceivedAt)
+
+	e, ok := d.entries[by+" "+key]
+	if !ok {
+		e = &entry{Group: Group{
+			By:        by,
+			Key:       key,
+			Count:     1,
+			FirstID:   rec.ID,
+			FirstSeen: rec.ReceivedAt,
+			LastSeen:  rec.ReceivedAt,
+		}}
+		e.element = d.order.PushBack(e)
+		d.entries[by+" "+key] = e
+		if oldest, ok := d.order.Front().Value.(*entry); ok && d.order.Len() > d.maxKeys {
+			d.remove(oldest)
+		}
+		return nil
+	}
+
+	e.Count++
+	e.LastSeen = rec.ReceivedAt
+	return &store.Duplicate{
+		By:          by,
+		Key:         key,
+		Count:       e.Count,
+		FirstID:     e.FirstID,
+		FirstSeen:   e.FirstSeen,
+		SinceFirst:  rec.ReceivedAt.Sub(e.FirstSeen),
+		FirstStatus: e.FirstStatus,
+	}
+}
+
+// Complete records the response status of a first delivery once it has been answered.
+func (d *Detector) Complete(rec *store.CapturedRequest) {
+	if rec.Duplicate != nil || rec.Response == nil {
+		return
+	}
+	by, key := d.fingerprint(rec)
+	if key == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[by+" "+key]; ok && e.FirstID == rec.ID {
+		e.FirstStatus = rec.Response.Status
+	}
+}
+
+// Load remembers previously captured requests, for example from a disk store after a restart.
+// Requests are given newest first, as returned by store.Store.List.
+func (d *Detector) Load(requests []*store.CapturedRequest) {
+	for _, rec := range slices.Backward(requests) {
+		if d.Check(rec) == nil {
+			d.Complete(rec)
+		}
+	}
+}
+
+// Duplicates returns the fingerprints delivered more than once, most recently repeated first.
+func (d *Detector) Duplicates() []Group {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var groups []Group
+	for _, e := range d.entries {
+		if e.Count > 1 {
+			groups = append(groups, e.Group)
+		}
+	}
+	slices.SortFunc(groups, func(a, b Group) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return groups
+}
+
+// ListDuplicates returns a page of the fingerprints delivered more than once.
+func (d *Detector) ListDuplicates(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := api.ParsePage(r)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups := d.Duplicates()
+	total := len(groups)
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"duplicates": groups[min(offset, total):min(offset+limit, total)],
+		"total":      total,
+		"offset":     offset,
+		"limit":      limit,
+	})
+}
+
+// LogFields returns the duplicate as structured log attributes.
+func LogFields(dup *store.Duplicate) []any {
+	if dup == nil {
+		return nil
+	}
+
+	fields := []any{
+		"duplicate_of", dup.FirstID,
+		"duplicate_by", dup.By,
+		"delivery_count", dup.Count,
+		"since_first", dup.SinceFirst,
+	}
+	if dup.FirstStatus != 0 {
+		fields = append(fields, "first_status", dup.FirstStatus)
+	}
+	return fields
+}
+
+// fingerprint returns the kind and key identifying the request, or an empty key when nothing identifies it
+func (d *Detector) fingerprint(rec *store.CapturedRequest) (string, string) {
+	if rec.Webhook != nil && rec.Webhook.DeliveryID != "" {
+		return ByDeliveryID, rec.Webhook.Provider + ":" + rec.Webhook.DeliveryID
+	}
+	for _, name := range d.headers {
+		if value := rec.Headers.Get(name); value != "" {
+			return ByIdempotencyKey, http.CanonicalHeaderKey(name) + ": " + value
+		}
+	}
+	// The hash of the whole body is recorded when it is read, older captures only have the body itself
+	if rec.BodySHA256 != "" {
+		return ByBody, rec.Method + " " + rec.Path + " sha256:" + rec.BodySHA256
+	}
+	if len(rec.Body) > 0 {
+		sum := sha256.Sum256(rec.Body)
+		return ByBody, rec.Method + " " + rec.Path + " sha256:" + hex.EncodeToString(sum[:])
+	}
+	return "", ""
+}
+
+// expire forgets deliveries first seen before the window
+func (d *Detector) expire(now time.Time) {
+	for front := d.order.Front(); front != nil; front = d.order.Front() {
+		e, ok := front.Value.(*entry)
+		if !ok || now.Sub(e.FirstSeen) <= d.window {
+			return
+		}
+		d.remove(e)
+	}
+}
+
+func (d *Detector) remove(e *entry) {
+	d.order.Remove(e.element)
+	delete(d.entries, e.By+" "+e.Key)
+}
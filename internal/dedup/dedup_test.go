@@ -0,0 +1,147 @@
+package dedup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+var start = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func request(id string, at time.Duration, body string, header http.Header) *store.CapturedRequest {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &store.CapturedRequest{
+		ID:         id,
+		Method:     "POST",
+		Path:       "/webhooks",
+		Headers:    header,
+		Body:       []byte(body),
+		ReceivedAt: start.Add(at),
+	}
+}
+
+func TestDetector_Check(t *testing.T) {
+	d := New(Options{})
+
+	first := request("1", 0, `{"id":1}`, nil)
+	if dup := d.Check(first); dup != nil {
+		t.Fatalf("Expected the first delivery not to be a duplicate, got %+v", dup)
+	}
+	first.Response = &store.Response{Status: http.StatusOK}
+	d.Complete(first)
+
+	dup := d.Check(request("2", time.Minute, `{"id":1}`, nil))
+	if dup == nil || dup.By != ByBody || dup.Count != 2 || dup.FirstID != "1" || dup.SinceFirst != time.Minute || dup.FirstStatus != http.StatusOK {
+		t.Errorf("Expected a body duplicate of the acknowledged first delivery, got %+v", dup)
+	}
+	if dup := d.Check(request("3", 2*time.Minute, `{"id":1}`, nil)); dup == nil || dup.Count != 3 {
+		t.Errorf("Expected the third delivery to be counted, got %+v", dup)
+	}
+
+	if dup := d.Check(request("4", 0, `{"id":2}`, nil)); dup != nil {
+		t.Errorf("Expected a different body not to be a duplicate, got %+v", dup)
+	}
+	if dup := d.Check(request("5", 0, "", nil)); dup != nil {
+		t.Errorf("Expected requests without a fingerprint to be ignored, got %+v", dup)
+	}
+	if dup := d.Check(request("6", 0, "", nil)); dup != nil {
+		t.Errorf("Expected requests without a fingerprint to be ignored, got %+v", dup)
+	}
+}
+
+func TestDetector_Fingerprints(t *testing.T) {
+	d := New(Options{Headers: []string{"X-Request-Id"}})
+
+	// The delivery ID wins over a changed body
+	hook := &store.Webhook{Provider: "github", DeliveryID: "72d3162e"}
+	first := request("1", 0, `{"attempt":1}`, nil)
+	first.Webhook = hook
+	second := request("2", time.Second, `{"attempt":2}`, nil)
+	second.Webhook = hook
+	d.Check(first)
+	if dup := d.Check(second); dup == nil || dup.By != ByDeliveryID || dup.Key != "github:72d3162e" {
+		t.Errorf("Expected a delivery ID duplicate, got %+v", dup)
+	}
+
+	d.Check(request("3", 0, "a", http.Header{"X-Request-Id": {"abc"}}))
+	if dup := d.Check(request("4", 0, "b", http.Header{"X-Request-Id": {"abc"}})); dup == nil || dup.By != ByIdempotencyKey || dup.Key != "X-Request-Id: abc" {
+		t.Errorf("Expected an idempotency key duplicate, got %+v", dup)
+	}
+
+	// Default idempotency headers are replaced by the configured ones
+	d.Check(request("5", 0, "c", http.Header{"Idempotency-Key": {"k"}}))
+	if dup := d.Check(request("6", 0, "d", http.Header{"Idempotency-Key": {"k"}})); dup != nil {
+		t.Errorf("Expected Idempotency-Key to be ignored, got %+v", dup)
+	}
+}
+
+func TestDetector_Forgets(t *testing.T) {
+	d := New(Options{Window: time.Hour, MaxKeys: 2})
+
+	d.Check(request("1", 0, "a", nil))
+	if dup := d.Check(request("2", 2*time.Hour, "a", nil)); dup != nil {
+		t.Errorf("Expected deliveries outside the window to be forgotten, got %+v", dup)
+	}
+
+	d.Check(request("3", 2*time.Hour, "b", nil))
+	d.Check(request("4", 2*time.Hour, "c", nil))
+	if dup := d.Check(request("5", 2*time.Hour, "a", nil)); dup != nil {
+		t.Errorf("Expected the oldest delivery to be forgotten, got %+v", dup)
+	}
+	if dup := d.Check(request("6", 2*time.Hour, "c", nil)); dup == nil {
+		t.Error("Expected the newest delivery to be remembered")
+	}
+}
+
+func TestDetector_Load(t *testing.T) {
+	first := request("1", 0, "a", nil)
+	first.Response = &store.Response{Status: http.StatusAccepted}
+	d := New(Options{})
+	d.Load([]*store.CapturedRequest{request("2", time.Second, "b", nil), first})
+
+	dup := d.Check(request("3", time.Minute, "a", nil))
+	if dup == nil || dup.FirstID != "1" || dup.FirstStatus != http.StatusAccepted {
+		t.Errorf("Expected a duplicate of the loaded request, got %+v", dup)
+	}
+}
+
+func TestDetector_ListDuplicates(t *testing.T) {
+	d := New(Options{})
+	for i, body := range []string{"a", "a", "b", "c", "c", "c"} {
+		d.Check(request(strconv.Itoa(i), time.Duration(i)*time.Second, body, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	d.ListDuplicates(rr, httptest.NewRequest("GET", "/_raccoon/api/duplicates?limit=1", nil))
+
+	var result struct {
+		Duplicates []Group `json:"duplicates"`
+		Total      int     `json:"total"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 || len(result.Duplicates) != 1 {
+		t.Fatalf("Expected 2 duplicated fingerprints and a page of 1, got %+v", result)
+	}
+	if group := result.Duplicates[0]; group.Count != 3 || group.FirstID != "3" || !group.LastSeen.Equal(start.Add(5*time.Second)) {
+		t.Errorf("Expected the most recently repeated fingerprint first, got %+v", group)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	if fields := LogFields(nil); fields != nil {
+		t.Errorf("Expected no fields for a first delivery, got %v", fields)
+	}
+	fields := LogFields(&store.Duplicate{FirstID: "1", By: ByBody, Count: 2, SinceFirst: time.Minute, FirstStatus: 200})
+	if len(fields) != 10 || fields[len(fields)-1] != 200 {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,202 @@
+// Package diff compares the responses of the primary upstream with those of a candidate shadow upstream.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// MaxDifferences is the largest number of differences recorded per request
+const MaxDifferences = 100
+
+// maxBodyValue is how much of a non-JSON body is kept in a difference
+const maxBodyValue = 256
+
+var errTrailingData = errors.New("trailing data after JSON value")
+
+// Options selects what is compared.
+type Options struct {
+	// Headers are the response headers to compare, all others are ignored
+	Headers []string
+	// Ignore lists JSON paths such as "$.meta.timestamp" or "$.items[*].id" whose values are not compared.
+	// A path also ignores everything below it.
+	Ignore []string
+}
+
+// Response is a response to compare.
+type Response struct {
+	Status  int
+	Headers http.Header
+	Body    []byte
+}
+
+// Compare returns the differences between the primary and the candidate response, in a stable order.
+// JSON bodies are compared value by value, other bodies byte by byte.
+func Compare(primary, candidate Response, opts Options) []store.Difference {
+	c := comparer{ignore: parsePatterns(opts.Ignore)}
+
+	if primary.Status != candidate.Status {
+		c.add("status", primary.Status, candidate.Status)
+	}
+
+	for _, name := range opts.Headers {
+		p := strings.Join(primary.Headers.Values(name), ", ")
+		v := strings.Join(candidate.Headers.Values(name), ", ")
+		if p != v {
+			c.add("header:"+http.CanonicalHeaderKey(name), p, v)
+		}
+	}
+
+	p, pErr := decodeJSON(primary.Body)
+	v, vErr := decodeJSON(candidate.Body)
+	if pErr == nil && vErr == nil {
+		c.compareJSON(nil, p, v)
+	} else if !bytes.Equal(primary.Body, candidate.Body) {
+		c.add("body", truncate(primary.Body), truncate(candidate.Body))
+	}
+
+	return c.differences
+}
+
+type comparer struct {
+	ignore      [][]string
+	differences []store.Difference
+}
+
+func (c *comparer) add(field string, primary, candidate any) {
+	if len(c.differences) < MaxDifferences {
+		c.differences = append(c.differences, store.Difference{Field: field, Primary: primary, Candidate: candidate})
+	}
+}
+
+// compareJSON walks both values, path holds the segments leading to them such as ".items" and "[0]"
+func (c *comparer) compareJSON(path []string, primary, candidate any) {
+	if c.ignored(path) {
+		return
+	}
+
+	switch p := primary.(type) {
+	case map[string]any:
+		v, ok := candidate.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(p)+len(v))
+		for key := range p {
+			keys = append(keys, key)
+		}
+		for key := range v {
+			if _, ok := p[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			c.compareJSON(append(path, "."+key), p[key], v[key])
+		}
+		return
+	case []any:
+		v, ok := candidate.([]any)
+		if !ok {
+			break
+		}
+		for i := range max(len(p), len(v)) {
+			var pv, vv any
+			if i < len(p) {
+				pv = p[i]
+			}
+			if i < len(v) {
+				vv = v[i]
+			}
+			c.compareJSON(append(path, "["+strconv.Itoa(i)+"]"), pv, vv)
+		}
+		return
+	default:
+		if primary == candidate {
+			return
+		}
+	}
+
+	c.add("body:$"+strings.Join(path, ""), primary, candidate)
+}
+
+// ignored reports whether a pattern matches the path or one of its parents
+func (c *comparer) ignored(path []string) bool {
+	for _, pattern := range c.ignore {
+		if len(pattern) > len(path) {
+			continue
+		}
+		match := true
+		for i, segment := range pattern {
+			if !matchSegment(segment, path[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegment reports whether a pattern segment matches a path segment, with ".*" matching any key
+// and "[*]" any index
+func matchSegment(pattern, segment string) bool {
+	switch pattern {
+	case ".*":
+		return segment[0] == '.'
+	case "[*]":
+		return segment[0] == '['
+	default:
+		return pattern == segment
+	}
+}
+
+// parsePatterns splits JSON paths like "$.items[*].id" into the segments ".items", "[*]" and ".id"
+func parsePatterns(paths []string) [][]string {
+	patterns := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+		var segments []string
+		for path != "" {
+			end := strings.IndexAny(path[1:], ".[") + 1
+			if end == 0 {
+				end = len(path)
+			}
+			segments = append(segments, path[:end])
+			path = path[end:]
+		}
+		patterns = append(patterns, segments)
+	}
+	return patterns
+}
+
+// decodeJSON decodes a JSON document keeping numbers exact
+func decodeJSON(body []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+func truncate(body []byte) string {
+	if len(body) > maxBodyValue {
+		return string(body[:maxBodyValue]) + "..."
+	}
+	return string(body)
+}
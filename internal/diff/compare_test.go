@@ -0,0 +1,143 @@
+package diff
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func jsonResponse(status int, body string) Response {
+	return Response{
+		Status:  status,
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    []byte(body),
+	}
+}
+
+func fields(differences []store.Difference) []string {
+	var names []string
+	for _, d := range differences {
+		names = append(names, d.Field)
+	}
+	return names
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name      string
+		primary   Response
+		candidate Response
+		opts      Options
+		want      []string
+	}{
+		{
+			name:      "equal",
+			primary:   jsonResponse(200, `{"id":1,"tags":["a","b"]}`),
+			candidate: jsonResponse(200, `{ "tags": ["a", "b"], "id": 1 }`),
+			want:      nil,
+		},
+		{
+			name:      "status",
+			primary:   jsonResponse(200, `{}`),
+			candidate: jsonResponse(500, `{}`),
+			want:      []string{"status"},
+		},
+		{
+			name:      "nested values",
+			primary:   jsonResponse(200, `{"user":{"id":1,"name":"a"},"items":[{"id":1},{"id":2}]}`),
+			candidate: jsonResponse(200, `{"user":{"id":1,"name":"b"},"items":[{"id":1},{"id":3},{"id":4}],"extra":true}`),
+			want:      []string{"body:$.extra", "body:$.items[1].id", "body:$.items[2]", "body:$.user.name"},
+		},
+		{
+			name:      "number precision",
+			primary:   jsonResponse(200, `{"n":1}`),
+			candidate: jsonResponse(200, `{"n":1.0}`),
+			want:      []string{"body:$.n"},
+		},
+		{
+			name:      "type mismatch",
+			primary:   jsonResponse(200, `{"data":[1]}`),
+			candidate: jsonResponse(200, `{"data":{"0":1}}`),
+			want:      []string{"body:$.data"},
+		},
+		{
+			name:      "ignored paths",
+			primary:   jsonResponse(200, `{"meta":{"at":"1","by":"x"},"items":[{"id":1,"v":1}],"id":"a"}`),
+			candidate: jsonResponse(200, `{"meta":{"at":"2"},"items":[{"id":2,"v":1}],"id":"b"}`),
+			opts:      Options{Ignore: []string{"$.meta", "$.items[*].id", "$.*"}},
+			want:      nil,
+		},
+		{
+			name:      "wildcard kinds",
+			primary:   jsonResponse(200, `{"items":[1],"obj":{"a":1}}`),
+			candidate: jsonResponse(200, `{"items":[2],"obj":{"a":2}}`),
+			opts:      Options{Ignore: []string{"$.items.*", "$.obj[*]"}},
+			want:      []string{"body:$.items[0]", "body:$.obj.a"},
+		},
+		{
+			name:      "headers",
+			primary:   Response{Status: 200, Headers: http.Header{"Content-Type": {"text/plain"}, "X-Id": {"1"}}},
+			candidate: Response{Status: 200, Headers: http.Header{"Content-Type": {"text/html"}, "X-Id": {"2"}}},
+			opts:      Options{Headers: []string{"content-type"}},
+			want:      []string{"header:Content-Type"},
+		},
+		{
+			name:      "text body",
+			primary:   Response{Status: 200, Body: []byte("hello")},
+			candidate: Response{Status: 200, Body: []byte("hello!")},
+			want:      []string{"body"},
+		},
+		{
+			name:      "json and text body",
+			primary:   jsonResponse(200, `{}`),
+			candidate: jsonResponse(200, `{} trailing`),
+			want:      []string{"body"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fields(Compare(tt.primary, tt.candidate, tt.opts))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected differences %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompare_Values(t *testing.T) {
+	got := Compare(
+		jsonResponse(200, `{"a":{"b":"x"},"c":[1]}`),
+		jsonResponse(201, `{"a":{"b":"y"}}`),
+		Options{},
+	)
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `[{"field":"status","primary":200,"candidate":201},` +
+		`{"field":"body:$.a.b","primary":"x","candidate":"y"},` +
+		`{"field":"body:$.c","primary":[1]}]`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestCompare_LimitsDifferences(t *testing.T) {
+	primary := make([]int, MaxDifferences+10)
+	candidate := make([]int, MaxDifferences+10)
+	for i := range candidate {
+		candidate[i] = 1
+	}
+	p, _ := json.Marshal(primary)
+	c, _ := json.Marshal(candidate)
+
+	got := Compare(jsonResponse(200, string(p)), jsonResponse(200, string(c)), Options{})
+	if len(got) != MaxDifferences {
+		t.Errorf("Expected %d differences, got %d", MaxDifferences, len(got))
+	}
+}
@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Differ compares the responses of a candidate mirror target with the upstream responses
+// and records the result on the captured requests.
+type Differ struct {
+	store     store.Store
+	candidate string
+	opts      Options
+}
+
+// Summary counts the recorded diffs.
+type Summary struct {
+	Candidate string `json:"candidate"`
+	Compared  int    `json:"compared"`
+	Equal     int    `json:"equal"`
+	Different int    `json:"different"`
+	Failed    int    `json:"failed"`
+	// Fields counts how many requests differ in each field
+	Fields map[string]int `json:"fields"`
+}
+
+// New creates a differ for the candidate mirror target URL.
+func New(st store.Store, candidate string, opts Options) *Differ {
+	// Mirror results name their target in normalized form
+	if u, err := url.Parse(candidate); err == nil {
+		candidate = u.String()
+	}
+	return &Differ{
+		store:     st,
+		candidate: candidate,
+		opts:      opts,
+	}
+}
+
+// Observe compares a mirror result of the candidate with the upstream response of the mirrored request.
+// Results of other targets and requests that were not forwarded to the upstream are ignored.
+func (d *Differ) Observe(result mirror.Result) {
+	if result.Target != d.candidate || result.Request.Upstream == nil {
+		return
+	}
+
+	diff := d.compare(result)
+	if diff.Equal {
+		slog.Debug("Candidate response matches upstream", "request_id", result.Request.ID)
+	} else {
+		slog.Info("Candidate response differs from upstream",
+			"request_id", result.Request.ID,
+			"candidate", d.candidate,
+			"differences", len(diff.Differences),
+			"error", diff.Error)
+	}
+
+	// Start from the stored version, the request may have been evicted meanwhile
+	current, err := d.store.Get(result.Request.ID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.Error("Failed to load captured request", "error", err, "request_id", result.Request.ID)
+		}
+		return
+	}
+	updated := *current
+	updated.Diff = diff
+	if err := d.store.Update(&updated); err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.Error("Failed to record response diff", "error", err, "request_id", result.Request.ID)
+	}
+}
+
+func (d *Differ) compare(result mirror.Result) *store.Diff {
+	upstream := result.Request.Upstream
+	diff := &store.Diff{
+		Candidate:  d.candidate,
+		Status:     result.Status,
+		ComparedAt: time.Now(),
+	}
+
+	switch {
+	case upstream.Error != "":
+		diff.Error = "upstream: " + upstream.Error
+	case result.Err != nil:
+		diff.Error = "candidate: " + result.Err.Error()
+	default:
+		primary := Response{Status: upstream.Status, Headers: upstream.Headers, Body: upstream.Body}
+		candidate := Response{Status: result.Status, Headers: result.Headers, Body: result.Body}
+		if upstream.BodyTruncated {
+			// Only the start of the upstream body is known, so bodies are not compared
+			primary.Body, candidate.Body = nil, nil
+		}
+		diff.Differences = Compare(primary, candidate, d.opts)
+		diff.Equal = len(diff.Differences) == 0
+	}
+	return diff
+}
+
+// Summarize returns the diff counts of the captured requests matching the query filter.
+func (d *Differ) Summarize(w http.ResponseWriter, r *http.Request) {
+	filter, err := store.ParseFilter(r.URL.Query())
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requests, err := d.store.List(filter)
+	if err != nil {
+		slog.Error("Failed to list captured requests", "error", err)
+		api.WriteError(w, http.StatusInternalServerError, "failed to list requests")
+		return
+	}
+
+	summary := Summary{Candidate: d.candidate, Fields: map[string]int{}}
+	for _, req := range requests {
+		if req.Diff == nil {
+			continue
+		}
+		summary.Compared++
+		switch {
+		case req.Diff.Error != "":
+			summary.Failed++
+		case req.Diff.Equal:
+			summary.Equal++
+		default:
+			summary.Different++
+		}
+		for _, difference := range req.Diff.Differences {
+			summary.Fields[difference.Field]++
+		}
+	}
+	api.WriteJSON(w, http.StatusOK, summary)
+}
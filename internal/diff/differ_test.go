@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+const candidateURL = "http://candidate:8080"
+
+func forwarded(t *testing.T, st store.Store, id, body string) *store.CapturedRequest {
+	t.Helper()
+
+	req := &store.CapturedRequest{
+		ID:     id,
+		Method: "GET",
+		Path:   "/users/1",
+		Upstream: &store.Upstream{
+			URL:     "http://primary:8080/users/1",
+			Status:  http.StatusOK,
+			Headers: http.Header{"Content-Type": {"application/json"}},
+			Body:    []byte(body),
+		},
+	}
+	if err := st.Add(req); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	return req
+}
+
+func candidateResult(req *store.CapturedRequest, status int, body string) mirror.Result {
+	return mirror.Result{
+		Target:  candidateURL,
+		Request: req,
+		Status:  status,
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    []byte(body),
+	}
+}
+
+func TestDiffer_Observe(t *testing.T) {
+	st := store.NewMemory(10, 0)
+	d := New(st, candidateURL, Options{Headers: []string{"Content-Type"}, Ignore: []string{"$.at"}})
+
+	same := forwarded(t, st, "same", `{"id":1,"at":"1"}`)
+	d.Observe(candidateResult(same, http.StatusOK, `{"id":1,"at":"2"}`))
+
+	changed := forwarded(t, st, "changed", `{"id":1}`)
+	d.Observe(candidateResult(changed, http.StatusOK, `{"id":2}`))
+
+	failed := forwarded(t, st, "failed", `{}`)
+	d.Observe(mirror.Result{Target: candidateURL, Request: failed, Err: errors.New("connection refused")})
+
+	got, _ := st.Get("same")
+	if got.Diff == nil || !got.Diff.Equal || got.Diff.Candidate != candidateURL || got.Diff.Status != http.StatusOK {
+		t.Errorf("Expected an equal diff, got %+v", got.Diff)
+	}
+	if same.Diff != nil {
+		t.Error("Expected the captured request not to be modified in place")
+	}
+
+	got, _ = st.Get("changed")
+	if got.Diff == nil || got.Diff.Equal || len(got.Diff.Differences) != 1 || got.Diff.Differences[0].Field != "body:$.id" {
+		t.Errorf("Expected a body difference, got %+v", got.Diff)
+	}
+
+	got, _ = st.Get("failed")
+	if got.Diff == nil || got.Diff.Equal || got.Diff.Error != "candidate: connection refused" {
+		t.Errorf("Expected a failed diff, got %+v", got.Diff)
+	}
+}
+
+func TestDiffer_ObserveSkips(t *testing.T) {
+	st := store.NewMemory(10, 0)
+	d := New(st, candidateURL, Options{})
+
+	other := forwarded(t, st, "other", `{}`)
+	result := candidateResult(other, http.StatusOK, `{"a":1}`)
+	result.Target = "http://other:8080"
+	d.Observe(result)
+
+	mocked := &store.CapturedRequest{ID: "mocked"}
+	_ = st.Add(mocked)
+	d.Observe(candidateResult(mocked, http.StatusOK, `{}`))
+
+	// Evicted requests are not stored again
+	evicted := forwarded(t, st, "evicted", `{}`)
+	_ = st.Delete("evicted")
+	d.Observe(candidateResult(evicted, http.StatusOK, `{}`))
+
+	for _, id := range []string{"other", "mocked"} {
+		if got, _ := st.Get(id); got.Diff != nil {
+			t.Errorf("Expected no diff on %s, got %+v", id, got.Diff)
+		}
+	}
+	if _, err := st.Get("evicted"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected evicted request to stay deleted, got %v", err)
+	}
+}
+
+func TestDiffer_TruncatedBody(t *testing.T) {
+	st := store.NewMemory(10, 0)
+	d := New(st, candidateURL, Options{})
+
+	req := forwarded(t, st, "large", `{"items":[`)
+	req.Upstream.BodyTruncated = true
+	d.Observe(candidateResult(req, http.StatusOK, `{"items":[]}`))
+
+	if got, _ := st.Get("large"); got.Diff == nil || !got.Diff.Equal {
+		t.Errorf("Expected truncated bodies not to be compared, got %+v", got.Diff)
+	}
+}
+
+func TestDiffer_Summarize(t *testing.T) {
+	st := store.NewMemory(10, 0)
+	d := New(st, candidateURL, Options{})
+
+	d.Observe(candidateResult(forwarded(t, st, "a", `{"id":1}`), http.StatusOK, `{"id":1}`))
+	d.Observe(candidateResult(forwarded(t, st, "b", `{"id":1}`), http.StatusOK, `{"id":2}`))
+	d.Observe(candidateResult(forwarded(t, st, "c", `{"id":1}`), http.StatusNotFound, `{"id":2}`))
+	d.Observe(mirror.Result{Target: candidateURL, Request: forwarded(t, st, "d", `{}`), Err: errors.New("timeout")})
+	_ = st.Add(&store.CapturedRequest{ID: "e"})
+
+	rec := httptest.NewRecorder()
+	d.Summarize(rec, httptest.NewRequest(http.MethodGet, "/_raccoon/api/diffs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var got Summary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if got.Candidate != candidateURL || got.Compared != 4 || got.Equal != 1 || got.Different != 2 || got.Failed != 1 {
+		t.Errorf("Unexpected summary %+v", got)
+	}
+	if got.Fields["body:$.id"] != 2 || got.Fields["status"] != 1 {
+		t.Errorf("Unexpected field counts %v", got.Fields)
+	}
+
+	rec = httptest.NewRecorder()
+	d.Summarize(rec, httptest.NewRequest(http.MethodGet, "/_raccoon/api/diffs?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid filter, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,265 @@
+// Package handshake answers the verification requests webhook providers send before they deliver events.
+package handshake
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Providers whose handshakes are answered, recorded on captured requests
+const (
+	Slack          = "slack"
+	Meta           = "meta"
+	MicrosoftGraph = "microsoft-graph"
+	Twitter        = "twitter"
+	SNS            = "sns"
+	Zoom           = "zoom"
+)
+
+// DefaultConfirmTimeout bounds the request confirming an SNS subscription when Options sets none
+const DefaultConfirmTimeout = 10 * time.Second
+
+// maxBody is how much of a request body is read to recognise a handshake
+const maxBody = 64 << 10
+
+// snsHost matches the hosts of SNS endpoints, subscriptions are only confirmed there
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Options configures a Responder. Handshakes needing a secret that is not set are passed on unanswered.
+type Options struct {
+	// TwitterSecret is the consumer secret CRC responses are signed with
+	TwitterSecret string
+	// ZoomSecret is the secret token of the Zoom app URL validation responses are signed with
+	ZoomSecret string
+	// MetaVerifyToken must match hub.verify_token of Meta subscriptions
+	MetaVerifyToken string
+	// ConfirmSNS visits the SubscribeURL of SNS subscription confirmations once their signature is verified
+	ConfirmSNS bool
+	// ConfirmTimeout bounds the request confirming an SNS subscription
+	ConfirmTimeout time.Duration
+}
+
+// Responder recognises provider handshakes and answers them.
+type Responder struct {
+	opts    Options
+	client  *http.Client
+	snsHost *regexp.Regexp
+}
+
+// New creates a responder with the given options.
+func New(opts Options) *Responder {
+	if opts.ConfirmTimeout <= 0 {
+		opts.ConfirmTimeout = DefaultConfirmTimeout
+	}
+	return &Responder{
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.ConfirmTimeout},
+		snsHost: snsHost,
+	}
+}
+
+// Handler answers handshakes and passes all other requests to next.
+// The provider of an answered handshake is recorded on the captured request.
+func (h *Responder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := readBody(r)
+		if err != nil {
+			slog.Error("Failed to read request body for handshake detection", "error", err)
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		provider, answer := h.detect(r, body)
+		if answer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rec := store.FromContext(r.Context()); rec != nil {
+			rec.Handshake = provider
+		}
+		slog.Info("Answering webhook handshake", "provider", provider, "path", r.URL.Path)
+		answer(w, r)
+	})
+}
+
+// detect returns the provider and the answer of a handshake, or a nil answer for other requests
+func (h *Responder) detect(r *http.Request, body []byte) (string, http.HandlerFunc) {
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("hub.mode") == "subscribe" && query.Has("hub.challenge"):
+		return Meta, h.meta(query)
+	case r.Method == http.MethodPost && query.Has("validationToken"):
+		return MicrosoftGraph, text(query.Get("validationToken"))
+	case r.Method == http.MethodGet && query.Has("crc_token"):
+		return Twitter, h.twitter(query.Get("crc_token"))
+	case r.Header.Get("X-Amz-Sns-Message-Type") == "SubscriptionConfirmation":
+		return SNS, h.sns(body)
+	}
+
+	if r.Method != http.MethodPost {
+		return "", nil
+	}
+	var event struct {
+		// Slack
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		// Zoom
+		Event   string `json:"event"`
+		Payload struct {
+			PlainToken string `json:"plainToken"`
+		} `json:"payload"`
+	}
+	if json.Unmarshal(body, &event) != nil {
+		return "", nil
+	}
+	switch {
+	case event.Type == "url_verification":
+		return Slack, func(w http.ResponseWriter, _ *http.Request) {
+			api.WriteJSON(w, http.StatusOK, map[string]string{"challenge": event.Challenge})
+		}
+	case event.Event == "endpoint.url_validation":
+		return Zoom, h.zoom(event.Payload.PlainToken)
+	}
+	return "", nil
+}
+
+// meta echoes hub.challenge of Meta (Facebook, Instagram, WhatsApp) webhook subscriptions
+func (h *Responder) meta(query url.Values) http.HandlerFunc {
+	if h.opts.MetaVerifyToken == "" {
+		slog.Warn("Cannot answer Meta subscription without a verify token")
+		return nil
+	}
+	if !hmac.Equal([]byte(query.Get("hub.verify_token")), []byte(h.opts.MetaVerifyToken)) {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			api.WriteError(w, http.StatusForbidden, "hub.verify_token does not match")
+		}
+	}
+	return text(query.Get("hub.challenge"))
+}
+
+// twitter answers the challenge-response check of the Twitter Account Activity API
+func (h *Responder) twitter(token string) http.HandlerFunc {
+	if h.opts.TwitterSecret == "" {
+		slog.Warn("Cannot answer Twitter CRC without a consumer secret")
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(h.opts.TwitterSecret))
+	mac.Write([]byte(token))
+	response := "sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return func(w http.ResponseWriter, _ *http.Request) {
+		api.WriteJSON(w, http.StatusOK, map[string]string{"response_token": response})
+	}
+}
+
+// zoom answers Zoom endpoint URL validation
+func (h *Responder) zoom(token string) http.HandlerFunc {
+	if h.opts.ZoomSecret == "" {
+		slog.Warn("Cannot answer Zoom URL validation without a secret token")
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(h.opts.ZoomSecret))
+	mac.Write([]byte(token))
+	encrypted := hex.EncodeToString(mac.Sum(nil))
+	return func(w http.ResponseWriter, _ *http.Request) {
+		api.WriteJSON(w, http.StatusOK, map[string]string{"plainToken": token, "encryptedToken": encrypted})
+	}
+}
+
+// sns confirms AWS SNS subscriptions by visiting their SubscribeURL
+func (h *Responder) sns(body []byte) http.HandlerFunc {
+	var message snsMessage
+	if err := json.Unmarshal(body, &message); err != nil || message.SubscribeURL == "" {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			api.WriteError(w, http.StatusBadRequest, "invalid SNS subscription confirmation")
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.opts.ConfirmSNS {
+			slog.Info("SNS subscription not confirmed, visit the subscribe URL to confirm it",
+				"topic", message.TopicArn,
+				"subscribe_url", message.SubscribeURL)
+			api.WriteJSON(w, http.StatusOK, map[string]string{"status": "pending", "topic_arn": message.TopicArn})
+			return
+		}
+
+		if err := h.verify(r.Context(), &message); err != nil {
+			slog.Warn("Refusing SNS subscription confirmation", "topic", message.TopicArn, "error", err)
+			api.WriteError(w, http.StatusForbidden, "verify SNS signature: "+err.Error())
+			return
+		}
+		if err := h.confirm(r.Context(), message.SubscribeURL); err != nil {
+			slog.Error("Failed to confirm SNS subscription", "topic", message.TopicArn, "error", err)
+			api.WriteError(w, http.StatusBadGateway, "confirm SNS subscription: "+err.Error())
+			return
+		}
+		slog.Info("Confirmed SNS subscription", "topic", message.TopicArn)
+		api.WriteJSON(w, http.StatusOK, map[string]string{"status": "confirmed", "topic_arn": message.TopicArn})
+	}
+}
+
+func (h *Responder) confirm(ctx context.Context, subscribeURL string) error {
+	u, err := h.snsURL(subscribeURL)
+	if err != nil {
+		return fmt.Errorf("subscribe URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// text answers with a plain text body
+func text(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+// readBody reads the start of the request body and restores it for the next handler
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, nil
+}
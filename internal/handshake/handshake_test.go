@@ -0,0 +1,288 @@
+package handshake
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func hexHMAC(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func base64HMAC(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serve passes a captured request through the handler, returning the response, the record and whether next was called
+func serve(h *Responder, r *http.Request) (*httptest.ResponseRecorder, *store.CapturedRequest, bool) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	rec := &store.CapturedRequest{ID: "1"}
+	rr := httptest.NewRecorder()
+	h.Handler(next).ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+	return rr, rec, called
+}
+
+func TestHandler_Handshakes(t *testing.T) {
+	h := New(Options{TwitterSecret: "consumer-secret", ZoomSecret: "zoom-secret", MetaVerifyToken: "meta-token"})
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		provider string
+		status   int
+		body     string
+	}{
+		{
+			name:     "slack",
+			request:  httptest.NewRequest("POST", "/slack/events", strings.NewReader(`{"token":"x","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P","type":"url_verification"}`)),
+			provider: Slack,
+			status:   http.StatusOK,
+			body:     `{"challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`,
+		},
+		{
+			name:     "meta",
+			request:  httptest.NewRequest("GET", "/whatsapp?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token=meta-token", nil),
+			provider: Meta,
+			status:   http.StatusOK,
+			body:     "1158201444",
+		},
+		{
+			name:     "meta with wrong verify token",
+			request:  httptest.NewRequest("GET", "/whatsapp?hub.mode=subscribe&hub.challenge=1158201444&hub.verify_token=other", nil),
+			provider: Meta,
+			status:   http.StatusForbidden,
+		},
+		{
+			name:     "microsoft graph",
+			request:  httptest.NewRequest("POST", "/graph?validationToken=Validation%3A%20Testing%20client%20application", nil),
+			provider: MicrosoftGraph,
+			status:   http.StatusOK,
+			body:     "Validation: Testing client application",
+		},
+		{
+			name:     "twitter",
+			request:  httptest.NewRequest("GET", "/twitter?crc_token=challenge", nil),
+			provider: Twitter,
+			status:   http.StatusOK,
+			body:     `{"response_token":"sha256=` + base64HMAC("consumer-secret", "challenge") + `"}`,
+		},
+		{
+			name:     "zoom",
+			request:  httptest.NewRequest("POST", "/zoom", strings.NewReader(`{"payload":{"plainToken":"qgg8vlvZRS6UYooatFL8Aw"},"event_ts":1654503849680,"event":"endpoint.url_validation"}`)),
+			provider: Zoom,
+			status:   http.StatusOK,
+			body:     `{"encryptedToken":"` + hexHMAC("zoom-secret", "qgg8vlvZRS6UYooatFL8Aw") + `","plainToken":"qgg8vlvZRS6UYooatFL8Aw"}`,
+		},
+		{
+			name:    "regular event",
+			request: httptest.NewRequest("POST", "/slack/events", strings.NewReader(`{"type":"event_callback"}`)),
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "subscription without challenge",
+			request: httptest.NewRequest("GET", "/whatsapp?hub.mode=unsubscribe", nil),
+			status:  http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, rec, called := serve(h, tt.request)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if rec.Handshake != tt.provider {
+				t.Errorf("Expected handshake %q, got %q", tt.provider, rec.Handshake)
+			}
+			if called != (tt.provider == "") {
+				t.Errorf("Expected next to be called only for regular requests, called: %v", called)
+			}
+			if tt.body != "" && strings.TrimSpace(rr.Body.String()) != tt.body {
+				t.Errorf("Expected body %s, got %s", tt.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_MissingSecrets(t *testing.T) {
+	h := New(Options{})
+
+	// Without a verify token Meta subscriptions are not accepted, as anyone could subscribe the endpoint
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/twitter?crc_token=challenge", nil),
+		httptest.NewRequest("POST", "/zoom", strings.NewReader(`{"payload":{"plainToken":"abc"},"event":"endpoint.url_validation"}`)),
+		httptest.NewRequest("GET", "/meta?hub.mode=subscribe&hub.challenge=42", nil),
+	} {
+		if rr, rec, called := serve(h, r); !called || rec.Handshake != "" || strings.Contains(rr.Body.String(), "42") {
+			t.Errorf("Expected %s to be passed on without a secret, got %d", r.URL.Path, rr.Code)
+		}
+	}
+}
+
+func TestHandler_BodyPreserved(t *testing.T) {
+	h := New(Options{})
+
+	var got string
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got = string(data)
+	})
+	body := `{"type":"event_callback","event":{"type":"message"}}`
+	h.Handler(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/slack/events", strings.NewReader(body)))
+	if got != body {
+		t.Errorf("Expected the body to reach the next handler, got %q", got)
+	}
+}
+
+// snsConfirmation returns a subscription confirmation signed with key, as SNS signs them
+func snsConfirmation(key *rsa.PrivateKey, version, certURL, subscribeURL string) *snsMessage {
+	m := &snsMessage{
+		Type:             "SubscriptionConfirmation",
+		MessageID:        "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:            "2336412f37",
+		TopicArn:         "arn:aws:sns:us-west-2:123456789012:MyTopic",
+		Message:          "You have chosen to subscribe to the topic arn:aws:sns:us-west-2:123456789012:MyTopic.",
+		SubscribeURL:     subscribeURL,
+		Timestamp:        "2012-04-26T20:45:04.751Z",
+		SignatureVersion: version,
+		SigningCertURL:   certURL,
+	}
+
+	var signature []byte
+	if version == "1" {
+		sum := sha1.Sum([]byte(m.signedString()))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(m.signedString()))
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+	return m
+}
+
+func snsRequest(m *snsMessage) *http.Request {
+	body, _ := json.Marshal(m)
+	r := httptest.NewRequest("POST", "/sns", strings.NewReader(string(body)))
+	r.Header.Set("X-Amz-Sns-Message-Type", "SubscriptionConfirmation")
+	return r
+}
+
+// signingCertificate returns a key and its self-signed certificate in PEM
+func signingCertificate(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestHandler_SNS(t *testing.T) {
+	key, cert := signingCertificate(t)
+
+	var confirmed atomic.Int32
+	aws := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SimpleNotificationService.pem" {
+			_, _ = w.Write(cert)
+			return
+		}
+		if r.URL.Query().Get("Action") == "ConfirmSubscription" {
+			confirmed.Add(1)
+		}
+		_, _ = io.WriteString(w, "<ConfirmSubscriptionResponse/>")
+	}))
+	defer aws.Close()
+	certURL := aws.URL + "/SimpleNotificationService.pem"
+	subscribeURL := aws.URL + "/?Action=ConfirmSubscription&Token=abc"
+
+	h := New(Options{ConfirmSNS: true})
+	h.client = aws.Client()
+	h.snsHost = regexp.MustCompile(`^127\.0\.0\.1$`)
+
+	for _, version := range []string{"1", "2"} {
+		rr, rec, _ := serve(h, snsRequest(snsConfirmation(key, version, certURL, subscribeURL)))
+		if rr.Code != http.StatusOK || rec.Handshake != SNS {
+			t.Errorf("Expected the subscription to be confirmed with signature version %s, got %d %s",
+				version, rr.Code, rr.Body.String())
+		}
+	}
+	if confirmed.Load() != 2 {
+		t.Errorf("Expected two confirmations, got %d", confirmed.Load())
+	}
+
+	// Messages that were not signed by SNS are never confirmed
+	other, _ := signingCertificate(t)
+	tampered := snsConfirmation(key, "2", certURL, subscribeURL)
+	tampered.TopicArn = "arn:aws:sns:us-west-2:123456789012:OtherTopic"
+	foreignCert := snsConfirmation(key, "2", "https://example.com/cert.pem", subscribeURL)
+	for name, m := range map[string]*snsMessage{
+		"tampered":            tampered,
+		"other key":           snsConfirmation(other, "2", certURL, subscribeURL),
+		"foreign certificate": foreignCert,
+		"unsupported version": snsConfirmation(key, "3", certURL, subscribeURL),
+		"missing signature":   {Type: "SubscriptionConfirmation", SubscribeURL: subscribeURL, SigningCertURL: certURL},
+	} {
+		if rr, _, _ := serve(h, snsRequest(m)); rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d for a %s message, got %d", http.StatusForbidden, name, rr.Code)
+		}
+	}
+	if confirmed.Load() != 2 {
+		t.Errorf("Expected unverified subscriptions not to be confirmed, got %d confirmations", confirmed.Load())
+	}
+
+	// Subscribe URLs outside SNS are never visited
+	rr, _, _ := serve(h, snsRequest(snsConfirmation(key, "2", certURL, "https://example.com/?Action=ConfirmSubscription")))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d for a foreign subscribe URL, got %d", http.StatusBadGateway, rr.Code)
+	}
+
+	h.opts.ConfirmSNS = false
+	rr, _, _ = serve(h, snsRequest(snsConfirmation(key, "2", certURL, subscribeURL)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "pending") || confirmed.Load() != 2 {
+		t.Errorf("Expected the subscription to stay pending, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if !snsHost.MatchString("sns.eu-central-1.amazonaws.com") || snsHost.MatchString("sns.eu-central-1.amazonaws.com.example.com") {
+		t.Error("Expected only SNS hosts to match")
+	}
+}
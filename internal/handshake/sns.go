@@ -0,0 +1,144 @@
+package handshake
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SNS signature version 1 is SHA1withRSA
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxCertificate is how much of a signing certificate is read
+const maxCertificate = 64 << 10
+
+var (
+	// ErrInvalidSignature is returned for SNS messages whose signature does not verify
+	ErrInvalidSignature = errors.New("invalid SNS signature")
+	// errNotSNS is returned for URLs that do not point at an SNS endpoint
+	errNotSNS = errors.New("not an SNS endpoint")
+)
+
+// snsMessage is an SNS subscription confirmation with the fields its signature covers
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Message          string `json:"Message"`
+	SubscribeURL     string `json:"SubscribeURL"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+}
+
+// signedString returns the canonical form of the message SNS signs
+func (m *snsMessage) signedString() string {
+	var b strings.Builder
+	for _, field := range [][2]string{
+		{"Message", m.Message},
+		{"MessageId", m.MessageID},
+		{"SubscribeURL", m.SubscribeURL},
+		{"Timestamp", m.Timestamp},
+		{"Token", m.Token},
+		{"TopicArn", m.TopicArn},
+		{"Type", m.Type},
+	} {
+		b.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+	return b.String()
+}
+
+// verify checks the signature of the message against the certificate at its SigningCertURL,
+// which must be served by SNS itself
+func (h *Responder) verify(ctx context.Context, m *snsMessage) error {
+	var hash crypto.Hash
+	switch m.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSignature, m.SignatureVersion)
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	key, err := h.certificate(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	var sum []byte
+	if hash == crypto.SHA1 {
+		s := sha1.Sum([]byte(m.signedString())) //nolint:gosec // mandated by signature version 1
+		sum = s[:]
+	} else {
+		s := sha256.Sum256([]byte(m.signedString()))
+		sum = s[:]
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, sum, signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// certificate fetches the public key of an SNS signing certificate
+func (h *Responder) certificate(ctx context.Context, certURL string) (*rsa.PublicKey, error) {
+	u, err := h.snsURL(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("signing certificate: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch signing certificate: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: signing certificate status %d", ErrInvalidSignature, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCertificate))
+	if err != nil {
+		return nil, fmt.Errorf("fetch signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: signing certificate is not PEM encoded", ErrInvalidSignature)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: signing certificate has no RSA key", ErrInvalidSignature)
+	}
+	return key, nil
+}
+
+// snsURL parses a URL and checks that it points at an SNS endpoint, so captured requests
+// cannot make the server call arbitrary URLs
+func (h *Responder) snsURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || !h.snsHost.MatchString(u.Hostname()) {
+		return nil, fmt.Errorf("%w: %q", errNotSNS, raw)
+	}
+	return u, nil
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultSpoolThreshold is the size above which bodies are spooled to disk when the configuration leaves it at zero
+const DefaultSpoolThreshold = 1 << 20
+
+// errBodyTooLarge is returned when a request body exceeds the hard limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// spooledBody is a request body read ahead of the handlers. It is kept in memory up to a threshold and written
+// to a temporary file beyond it, so large uploads neither stay in memory nor get lost.
+type spooledBody struct {
+	memory []byte
+	file   *os.File
+	size   int64
+	sum    string
+}
+
+// bodyLimits configures how request bodies are read
+type bodyLimits struct {
+	// max is the hard limit of a body, zero for none
+	max int64
+	// spoolThreshold is the size above which a body is written to a file in spoolDir
+	spoolThreshold int64
+	spoolDir       string
+}
+
+// readBody reads r completely, hashing it on the way. It returns errBodyTooLarge, together with what was read,
+// as soon as the body exceeds the hard limit.
+func readBody(r io.Reader, limits bodyLimits) (*spooledBody, error) {
+	if limits.max > 0 {
+		r = io.LimitReader(r, limits.max+1)
+	}
+	h := sha256.New()
+	r = io.TeeReader(r, h)
+
+	b := &spooledBody{}
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, limits.spoolThreshold+1))
+	b.size = n
+	if err == nil && n > limits.spoolThreshold {
+		err = b.spool(&buf, r, limits.spoolDir)
+	}
+	if b.file == nil {
+		b.memory = buf.Bytes()
+	}
+	b.sum = hex.EncodeToString(h.Sum(nil))
+
+	if err != nil {
+		_ = b.Close()
+		return nil, err
+	}
+	if limits.max > 0 && b.size > limits.max {
+		return b, errBodyTooLarge
+	}
+	return b, nil
+}
+
+// spool writes what was read so far and the rest of r to a temporary file
+func (b *spooledBody) spool(head *bytes.Buffer, r io.Reader, dir string) error {
+	f, err := os.CreateTemp(dir, "raccoon-body-*")
+	if err != nil {
+		return fmt.Errorf("spool request body: %w", err)
+	}
+	b.file = f
+
+	if _, err := head.WriteTo(f); err != nil {
+		return fmt.Errorf("spool request body: %w", err)
+	}
+	n, err := io.Copy(f, r)
+	b.size += n
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reader returns a reader over the whole body, independent of the readers returned before
+func (b *spooledBody) Reader() io.Reader {
+	if b.file == nil {
+		return bytes.NewReader(b.memory)
+	}
+	return io.NewSectionReader(b.file, 0, b.size)
+}
+
+// Head returns up to n bytes from the start of the body
+func (b *spooledBody) Head(n int64) ([]byte, error) {
+	n = min(n, b.size)
+	if b.file == nil {
+		return b.memory[:n], nil
+	}
+
+	head := make([]byte, n)
+	if _, err := b.file.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return head, nil
+}
+
+// Spooled reports whether the body was written to a temporary file
+func (b *spooledBody) Spooled() bool {
+	return b.file != nil
+}
+
+// Close removes the temporary file of a spooled body
+func (b *spooledBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	_ = b.file.Close()
+	return os.Remove(b.file.Name())
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	dir := t.TempDir()
+
+	b, err := readBody(strings.NewReader("hello"), bodyLimits{spoolThreshold: 10, spoolDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Spooled() || b.size != 5 || b.sum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Expected a small body to stay in memory, got %+v", b)
+	}
+
+	b, err = readBody(strings.NewReader(strings.Repeat("a", 25)), bodyLimits{spoolThreshold: 10, spoolDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Spooled() || b.size != 25 {
+		t.Fatalf("Expected a large body to be spooled, got %+v", b)
+	}
+	head, err := b.Head(4)
+	if err != nil || string(head) != "aaaa" {
+		t.Errorf("Expected the head of the spooled body, got %q (%v)", head, err)
+	}
+	first, second := b.Reader(), b.Reader()
+	if data, _ := io.ReadAll(first); len(data) != 25 {
+		t.Errorf("Expected the whole spooled body, got %d bytes", len(data))
+	}
+	if data, _ := io.ReadAll(second); len(data) != 25 {
+		t.Errorf("Expected every reader to read the whole spooled body, got %d bytes", len(data))
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the spool file to be removed, got %v", entries)
+	}
+}
+
+func TestReadBody_Limit(t *testing.T) {
+	b, err := readBody(strings.NewReader(strings.Repeat("a", 25)), bodyLimits{max: 20, spoolThreshold: 10, spoolDir: t.TempDir()})
+	if !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("Expected errBodyTooLarge, got %v", err)
+	}
+	defer b.Close()
+	if b.size != 21 {
+		t.Errorf("Expected reading to stop past the limit, got %d bytes", b.size)
+	}
+
+	if _, err := readBody(strings.NewReader(strings.Repeat("a", 20)), bodyLimits{max: 20, spoolThreshold: 10, spoolDir: t.TempDir()}); err != nil {
+		t.Errorf("Expected a body at the limit to be read, got %v", err)
+	}
+}
@@ -1,93 +1,374 @@
 package middleware
 
 import (
-	"bytes"
+	"cmp"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
-	"strings"
+	"time"
 
+	"github.com/czechbol/request-raccoon/internal/cloudevents"
 	"github.com/czechbol/request-raccoon/internal/config"
+	"github.com/czechbol/request-raccoon/internal/decompress"
+	"github.com/czechbol/request-raccoon/internal/dedup"
+	"github.com/czechbol/request-raccoon/internal/render"
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/webhook"
 )
 
 // Manager handles all middleware functionality
 type Manager struct {
-	config config.Config
+	config     config.Config
+	store      store.Store
+	duplicates *dedup.Detector
+	onCapture  []func(*store.CapturedRequest)
+	limits     bodyLimits
+	captureMax int64
+	logMax     int
+	decompress decompress.Options
 }
 
-// NewManager creates a new middleware manager
-func NewManager(cfg config.Config) *Manager {
+// NewManager creates a new middleware manager.
+// Requests are captured into st after they have been handled; st may be nil to disable capturing.
+func NewManager(cfg config.Config, st store.Store) *Manager {
 	return &Manager{
-		config: cfg,
+		config:     cfg,
+		store:      st,
+		captureMax: max(cfg.BodyCaptureMax, 0),
+		logMax:     max(cfg.BodyLogMax, 0),
+		limits: bodyLimits{
+			max:            cfg.BodyMaxSize,
+			spoolThreshold: cmp.Or(cfg.BodySpoolThreshold, DefaultSpoolThreshold),
+			spoolDir:       cfg.BodySpoolDir,
+		},
+		decompress: decompress.Options{
+			MaxSize:  cfg.BodyDecompressMax,
+			MaxRatio: cfg.BodyDecompressRatio,
+		},
 	}
 }
 
+// OnCapture registers fn to be called with every request after it has been stored.
+// Hooks run on the request goroutine, so they must not block.
+func (m *Manager) OnCapture(fn func(*store.CapturedRequest)) {
+	m.onCapture = append(m.onCapture, fn)
+}
+
+// DetectDuplicates flags captured requests that repeat an earlier delivery remembered by d.
+func (m *Manager) DetectDuplicates(d *dedup.Detector) {
+	m.duplicates = d
+}
+
 // Logging logs all HTTP requests with comprehensive details
 func (m *Manager) Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Read and restore request body if enabled
-		var bodyContent string
-		if m.config.EnableRequestBody && r.Body != nil {
-			bodyBytes, err := io.ReadAll(r.Body)
-			if err != nil {
-				slog.Error("Failed to read request body",
-					"error", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
+		receivedAt := time.Now().UTC()
+
+		body, ok := m.readCapture(w, r)
+		if !ok {
+			return
+		}
+		defer body.close()
+
+		// Bodies over the hard limit are still recorded, but answered with 413 instead of being handled
+		handler := next
+		if body.tooLarge {
+			handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Connection", "close")
+				http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			})
+		}
+
+		m.decodeForLog(r, body)
+
+		var rec *store.CapturedRequest
+		if m.store != nil {
+			rec = newCaptureRequest(r, body.head, receivedAt)
+			rec.BodySize = body.size
+			rec.BodyTruncated = body.tooLarge || body.size > int64(len(body.head))
+			rec.BodySHA256 = body.sum
+			rec.DecodedBody = body.decoded
+			if body.decodeErr != nil {
+				rec.DecodeError = body.decodeErr.Error()
 			}
+			rec.Content = body.rendered
+			rec.Webhook = body.hook
+			rec.CloudEvents = body.events
+			m.checkDuplicate(rec)
+		}
 
-			bodyContent = string(bodyBytes)
+		slog.Info("HTTP request received", m.logFields(r, rec, body)...)
 
-			// Restore the request body for downstream handlers
-			r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		if rec == nil {
+			handler.ServeHTTP(w, r)
+			return
 		}
 
-		// Prepare log entry
-		logFields := []any{
-			"method", r.Method,
-			"path", r.URL.Path,
-			"query", r.URL.RawQuery,
-			"remote_addr", r.RemoteAddr,
+		// Call the next handler, recording what it answers
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rw, r.WithContext(store.NewContext(r.Context(), rec)))
+		m.finishCapture(rec, w, rw)
+	})
+}
+
+// capture is what the logging middleware learned about the body of a request
+type capture struct {
+	spooled *spooledBody
+	// head is the start of the body, up to the capture limit
+	head     []byte
+	size     int64
+	sum      string
+	tooLarge bool
+	// complete is set when head and content hold the whole body
+	complete bool
+
+	// content is the decompressed head, or the head itself when it is not compressed
+	content   []byte
+	decoded   []byte
+	decodeErr error
+	encoding  string
+	rendered  *store.Content
+	logged    any
+	hook      *store.Webhook
+	events    []store.CloudEvent
+}
+
+// readCapture reads the request body ahead of the handlers if it is logged, captured or limited. The whole body
+// is restored for downstream handlers. It answers with 500 and returns false when the body cannot be read.
+func (m *Manager) readCapture(w http.ResponseWriter, r *http.Request) (*capture, bool) {
+	c := &capture{tooLarge: m.limits.max > 0 && r.ContentLength > m.limits.max}
+	if (m.config.EnableRequestBody || m.store != nil || m.limits.max > 0) && r.Body != nil && !c.tooLarge {
+		var err error
+		c.spooled, err = readBody(r.Body, m.limits)
+		c.tooLarge = errors.Is(err, errBodyTooLarge)
+		if err != nil && !c.tooLarge {
+			slog.Error("Failed to read request body",
+				"error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return nil, false
 		}
 
-		// Add request body if enabled and not too large
-		if m.config.EnableRequestBody && bodyContent != "" && len(bodyContent) <= 1024 {
-			logFields = append(logFields, "request_body", bodyContent)
+		// Keep the head of the body and restore the whole of it for downstream handlers, which may read it
+		// again through GetBody, like the upstream proxy when it retries
+		spooled := c.spooled
+		c.head, err = spooled.Head(m.captureMax)
+		r.Body = io.NopCloser(spooled.Reader())
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(spooled.Reader()), nil
 		}
+		if err != nil {
+			c.close()
+			slog.Error("Failed to read spooled request body",
+				"error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return nil, false
+		}
+	}
 
-		// Add all headers (except sensitive ones)
-		headers := make(map[string]string)
-		for k, v := range r.Header {
-			if !isSensitiveHeader(k) && len(v) > 0 {
-				headers[k] = v[0]
-			} else {
-				headers[k] = "[REDACTED]"
-			}
+	c.size, c.sum = bodyInfo(c.spooled, r.ContentLength, c.tooLarge)
+	c.complete = !c.tooLarge && c.size == int64(len(c.head))
+	c.content = c.head
+	return c, true
+}
+
+// close removes the spooled body
+func (c *capture) close() {
+	if c.spooled == nil {
+		return
+	}
+	if err := c.spooled.Close(); err != nil {
+		slog.Error("Failed to remove spooled request body",
+			"error", err)
+	}
+}
+
+// decodeForLog decompresses the body so it is recognised and logged by its content, the raw bytes are kept as
+// well. Webhooks of known providers and CloudEvents are recognised, and the body is decoded by its media type.
+func (m *Manager) decodeForLog(r *http.Request, c *capture) {
+	c.encoding = r.Header.Get("Content-Encoding")
+	if m.config.BodyDecompress && len(c.head) > 0 && len(decompress.Encodings(c.encoding)) > 0 {
+		c.decoded, c.decodeErr = decompress.Decode(c.encoding, c.head, m.decompress)
+		if len(c.decoded) > 0 {
+			c.content = c.decoded
+		}
+		c.complete = c.complete && c.decodeErr == nil
+	}
+
+	c.hook = webhook.Detect(r.Header, c.content)
+	c.events = cloudevents.Parse(r.Header, c.content)
+	if len(c.content) > 0 {
+		c.rendered, c.logged = render.Body(r.Header.Get("Content-Type"), c.content, render.Options{
+			Pretty:  m.config.BodyLogPretty,
+			Partial: !c.complete,
+		})
+	}
+}
+
+// checkDuplicate flags a captured request that repeats an earlier delivery
+func (m *Manager) checkDuplicate(rec *store.CapturedRequest) {
+	if m.duplicates != nil {
+		rec.Duplicate = m.duplicates.Check(rec)
+	}
+}
+
+// logFields returns the fields of the log line of a request
+func (m *Manager) logFields(r *http.Request, rec *store.CapturedRequest, c *capture) []any {
+	fields := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"query", r.URL.RawQuery,
+		"remote_addr", r.RemoteAddr,
+	}
+	if rec != nil {
+		fields = append(fields, "request_id", rec.ID)
+		fields = append(fields, dedup.LogFields(rec.Duplicate)...)
+	}
+	fields = append(fields, webhook.LogFields(c.hook)...)
+	fields = append(fields, cloudevents.LogFields(c.events)...)
+	if m.config.EnableRequestBody && c.size > 0 {
+		fields = append(fields, m.bodyLogFields(r, c)...)
+	}
+	if c.tooLarge {
+		fields = append(fields, "request_body_limit", m.limits.max)
+	}
+	if c.decoded != nil || c.decodeErr != nil {
+		fields = append(fields, "request_body_encoding", c.encoding)
+	}
+	if c.decodeErr != nil {
+		fields = append(fields, "request_body_decode_error", c.decodeErr.Error())
+	}
+
+	// Add all headers (except sensitive ones)
+	headers := make(map[string]string)
+	for k, v := range r.Header {
+		if !isSensitiveHeader(k) && len(v) > 0 {
+			headers[k] = v[0]
+		} else {
+			headers[k] = "[REDACTED]"
 		}
-		if len(headers) > 0 {
-			logFields = append(logFields, "headers", headers)
+	}
+	if len(headers) > 0 {
+		fields = append(fields, "headers", headers)
+	}
+	return fields
+}
+
+// bodyLogFields returns the head of the request body for the log line, marking bodies that do not fit
+func (m *Manager) bodyLogFields(r *http.Request, c *capture) []any {
+	var fields []any
+	value := c.logged
+	logged := c.content[:min(len(c.content), m.logMax)]
+	if len(logged) < len(c.content) {
+		_, value = render.Body(r.Header.Get("Content-Type"), logged, render.Options{
+			Pretty:  m.config.BodyLogPretty,
+			Partial: true,
+		})
+	}
+	if len(logged) > 0 {
+		fields = append(fields, "request_body", value)
+		fields = append(fields, render.LogFields(c.rendered)...)
+	}
+	if !c.complete || len(logged) < len(c.content) {
+		fields = append(fields,
+			"request_body_truncated", true,
+			"request_body_size", c.size)
+		if c.sum != "" {
+			fields = append(fields, "request_body_sha256", c.sum)
 		}
+	}
+	return fields
+}
 
-		// Log with appropriate level based on status code
-		slog.Info("HTTP request received", logFields...)
+// finishCapture records the response of a handled request, stores the request and runs the capture hooks
+func (m *Manager) finishCapture(rec *store.CapturedRequest, w http.ResponseWriter, rw *responseRecorder) {
+	rec.CompletedAt = time.Now().UTC()
+	rec.Response = &store.Response{
+		Status:  rw.status,
+		Headers: w.Header().Clone(),
+		Size:    rw.size,
+	}
+	if m.duplicates != nil {
+		m.duplicates.Complete(rec)
+	}
+	if err := m.store.Add(rec); err != nil {
+		slog.Error("Failed to store captured request",
+			"error", err,
+			"id", rec.ID)
+	}
+	for _, fn := range m.onCapture {
+		fn(rec)
+	}
+}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+// bodyInfo returns the size and hex SHA-256 of a request body. The hash of a body over the hard limit is
+// unknown and its size is the announced Content-Length, or a lower bound when none was announced.
+func bodyInfo(body *spooledBody, contentLength int64, tooLarge bool) (int64, string) {
+	switch {
+	case tooLarge && contentLength > 0:
+		return contentLength, ""
+	case body == nil:
+		return 0, ""
+	case tooLarge || body.size == 0:
+		return body.size, ""
+	}
+	return body.size, body.sum
+}
+
+func newCaptureRequest(r *http.Request, body []byte, receivedAt time.Time) *store.CapturedRequest {
+	return &store.CapturedRequest{
+		ID:         store.NewID(),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Host:       r.Host,
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header.Clone(),
+		Body:       body,
+		TLS:        store.NewTLSInfo(r.TLS),
+		ReceivedAt: receivedAt,
+	}
+}
+
+// responseRecorder wraps a ResponseWriter to record the status code and response size
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher so streaming handlers keep working
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
 // Utility functions
 
 func isSensitiveHeader(key string) bool {
-	sensitive := []string{
-		"authorization", "cookie", "set-cookie", "x-api-key", "x-auth-token",
-		"proxy-authorization", "www-authenticate", "proxy-authenticate",
-	}
-	lowerKey := strings.ToLower(key)
-	for _, s := range sensitive {
-		if lowerKey == s {
-			return true
-		}
-	}
-	return false
+	return store.IsSensitiveHeader(key)
 }
@@ -1,13 +1,17 @@
 package middleware
 
 import (
+	"bytes"
+	"compress/gzip"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/czechbol/request-raccoon/internal/config"
+	"github.com/czechbol/request-raccoon/internal/store"
 )
 
 func TestManager_Logging(t *testing.T) {
@@ -72,7 +76,7 @@ func TestManager_Logging(t *testing.T) {
 			cfg := config.Config{
 				EnableRequestBody: tt.enableRequestBody,
 			}
-			manager := NewManager(cfg)
+			manager := NewManager(cfg, nil)
 
 			// Create a test handler that records if it was called
 			var handlerCalled bool
@@ -129,7 +133,7 @@ func TestManager_Logging_LargeBody(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: true,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	// Create a large body (over 1024 bytes)
 	largeBody := strings.Repeat("a", 1500)
@@ -161,7 +165,7 @@ func TestManager_Logging_NilBody(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: true,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	var handlerCalled bool
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -188,7 +192,7 @@ func TestManager_Logging_BodyReadError(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: true,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	var handlerCalled bool
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -271,7 +275,7 @@ func TestManager_Logging_HeaderFiltering(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: false,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	var handlerCalled bool
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -304,7 +308,7 @@ func TestManager_Logging_EmptyHeaders(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: false,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	var handlerCalled bool
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -340,7 +344,7 @@ func TestManager_Logging_MultipleHeaderValues(t *testing.T) {
 	cfg := config.Config{
 		EnableRequestBody: false,
 	}
-	manager := NewManager(cfg)
+	manager := NewManager(cfg, nil)
 
 	var handlerCalled bool
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -366,3 +370,326 @@ func TestManager_Logging_MultipleHeaderValues(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", rr.Code)
 	}
 }
+
+func TestManager_Logging_CapturesRequest(t *testing.T) {
+	cfg := config.Config{
+		EnableRequestBody: false,
+		BodyCaptureMax:    1 << 20,
+	}
+	st := store.NewMemory(10, 1<<20)
+	manager := NewManager(cfg, st)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handled", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("accepted"))
+	})
+
+	handler := manager.Logging(nextHandler)
+	req := httptest.NewRequest("POST", "/webhook?source=test", strings.NewReader(`{"event":"ping"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 captured request, got %d", len(list))
+	}
+
+	rec := list[0]
+	if rec.Method != "POST" || rec.Path != "/webhook" || rec.Query != "source=test" {
+		t.Errorf("Unexpected request line: %s %s?%s", rec.Method, rec.Path, rec.Query)
+	}
+	if string(rec.Body) != `{"event":"ping"}` {
+		t.Errorf("Expected body to be captured even when not logged, got %q", rec.Body)
+	}
+	if rec.Headers.Get("Authorization") != "Bearer secret" {
+		t.Error("Expected all headers to be captured unredacted")
+	}
+	if rec.Response == nil || rec.Response.Status != http.StatusAccepted {
+		t.Fatalf("Expected response status %d, got %+v", http.StatusAccepted, rec.Response)
+	}
+	if rec.Response.Headers.Get("X-Handled") != "yes" {
+		t.Error("Expected response headers to be captured")
+	}
+	if rec.Response.Size != int64(len("accepted")) {
+		t.Errorf("Expected response size %d, got %d", len("accepted"), rec.Response.Size)
+	}
+	if rec.CompletedAt.Before(rec.ReceivedAt) {
+		t.Error("Expected completion time after receive time")
+	}
+}
+
+func TestManager_OnCapture(t *testing.T) {
+	st := store.NewMemory(10, 1<<20)
+	manager := NewManager(config.Config{}, st)
+
+	var captured []*store.CapturedRequest
+	manager.OnCapture(func(rec *store.CapturedRequest) {
+		if _, err := st.Get(rec.ID); err != nil {
+			t.Error("Expected hook to run after the request was stored")
+		}
+		captured = append(captured, rec)
+	})
+
+	handler := manager.Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hook", nil))
+
+	if len(captured) != 1 || captured[0].Path != "/hook" {
+		t.Errorf("Expected hook to receive the captured request, got %v", captured)
+	}
+}
+
+func TestManager_Logging_DetectsWebhook(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{BodyCaptureMax: 1 << 20}
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("POST", "/webhooks/stripe", strings.NewReader(`{"id":"evt_1","object":"event","type":"invoice.paid"}`))
+	req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	list, _ := st.List(store.Filter{Provider: "stripe", Event: "invoice.paid"})
+	if len(list) != 1 || list[0].Webhook.DeliveryID != "evt_1" {
+		t.Fatalf("Expected the Stripe event to be captured with its metadata, got %v", list)
+	}
+	for _, field := range []string{`"webhook_provider":"stripe"`, `"webhook_event":"invoice.paid"`, `"delivery_id":"evt_1"`} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("Expected log line to contain %s, got %s", field, logs.String())
+		}
+	}
+}
+
+func TestManager_Logging_ParsesCloudEvents(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	st := store.NewMemory(10, 1<<20)
+	handler := NewManager(config.Config{}, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(strings.Repeat("x", 4096)))
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", "A234")
+	req.Header.Set("Ce-Type", "com.example.order.created")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	list, _ := st.List(store.Filter{Provider: "cloudevents"})
+	if len(list) != 1 || len(list[0].CloudEvents) != 1 || list[0].CloudEvents[0].ID != "A234" {
+		t.Fatalf("Expected the CloudEvent to be captured with its attributes, got %v", list)
+	}
+	for _, field := range []string{`"ce_type":"com.example.order.created"`, `"ce_errors":["missing required attribute source"]`} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("Expected log line to contain %s, got %s", field, logs.String())
+		}
+	}
+}
+
+func TestManager_Logging_TruncatesLargeBody(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{EnableRequestBody: true, BodyCaptureMax: 100, BodyLogMax: 10, BodySpoolThreshold: 50}
+	body := strings.Repeat("a", 200)
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		if string(received) != body {
+			t.Errorf("Expected the whole spooled body downstream, got %d bytes", len(received))
+		}
+		// Handlers sending the body again, like the retrying upstream proxy, read it through GetBody
+		again, err := r.GetBody()
+		if err != nil {
+			t.Fatalf("GetBody failed: %v", err)
+		}
+		if received, _ = io.ReadAll(again); string(received) != body {
+			t.Errorf("Expected GetBody to return the whole spooled body, got %d bytes", len(received))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/upload", strings.NewReader(body)))
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 1 {
+		t.Fatalf("Expected one captured request, got %d", len(list))
+	}
+	rec := list[0]
+	if len(rec.Body) != 100 || !rec.BodyTruncated || rec.BodySize != 200 || rec.BodySHA256 == "" {
+		t.Errorf("Expected a truncated capture with the size and hash of the whole body, got %d bytes %+v", len(rec.Body), rec)
+	}
+	for _, field := range []string{`"request_body":"aaaaaaaaaa"`, `"request_body_truncated":true`, `"request_body_size":200`, `"request_body_sha256":"` + rec.BodySHA256 + `"`} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("Expected log line to contain %s, got %s", field, logs.String())
+		}
+	}
+}
+
+func TestManager_Logging_ZeroLimits(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	// Zero keeps no body on the captured request and writes none to the log, only its size and hash
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{EnableRequestBody: true, BodyCaptureMax: 0, BodyLogMax: 0}
+	body := `{"id":"evt_1"}`
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received, _ := io.ReadAll(r.Body); string(received) != body {
+			t.Errorf("Expected the whole body downstream, got %q", received)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/hook", strings.NewReader(body)))
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 1 {
+		t.Fatalf("Expected one captured request, got %d", len(list))
+	}
+	rec := list[0]
+	if len(rec.Body) != 0 || !rec.BodyTruncated || rec.BodySize != int64(len(body)) || rec.BodySHA256 == "" {
+		t.Errorf("Expected no captured body with the size and hash of the whole body, got %+v", rec)
+	}
+	if strings.Contains(logs.String(), `"request_body":`) {
+		t.Errorf("Expected no body in the log line, got %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `"request_body_size":14`) {
+		t.Errorf("Expected the body size in the log line, got %s", logs.String())
+	}
+}
+
+func TestManager_Logging_RejectsBodyOverLimit(t *testing.T) {
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{BodyMaxSize: 10, BodyCaptureMax: 1 << 20}
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received, _ := io.ReadAll(r.Body); len(received) > 10 {
+			t.Error("Expected a body over the limit not to be handled")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Without a Content-Length the limit is found while reading
+	req := httptest.NewRequest("POST", "/upload", io.MultiReader(strings.NewReader(strings.Repeat("a", 50))))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", 50)))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rr.Code)
+	}
+
+	// Rejecting a request does not affect the next ones
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/upload", strings.NewReader("small")))
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected a body within the limit to be handled, got %d", rr.Code)
+	}
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 3 {
+		t.Fatalf("Expected rejected requests to be captured, got %d", len(list))
+	}
+	list = list[1:]
+	if rec := list[0]; !rec.BodyTruncated || rec.BodySize != 50 || len(rec.Body) != 0 || rec.Response.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the announced size of an unread body, got %+v", rec)
+	}
+	if rec := list[1]; !rec.BodyTruncated || rec.BodySize != 11 || len(rec.Body) != 11 || rec.BodySHA256 != "" {
+		t.Errorf("Expected the read part of the body without a hash, got %+v", rec)
+	}
+}
+
+func TestManager_Logging_DecompressesBody(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	body := `{"id":"evt_1","object":"event","type":"invoice.paid"}`
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte(body))
+	_ = zw.Close()
+
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{EnableRequestBody: true, BodyCaptureMax: 1 << 20, BodyLogMax: 1024, BodyDecompress: true}
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" && !bytes.Equal(received, compressed.Bytes()) {
+			t.Error("Expected the compressed body to reach the handler unchanged")
+		}
+	}))
+
+	req := httptest.NewRequest("POST", "/webhooks/stripe", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("compressed"))
+	req.Header.Set("Content-Encoding", "compress")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 2 {
+		t.Fatalf("Expected two captured requests, got %d", len(list))
+	}
+	if rec := list[1]; string(rec.DecodedBody) != body || !bytes.Equal(rec.Body, compressed.Bytes()) || rec.Webhook == nil || rec.Webhook.DeliveryID != "evt_1" {
+		t.Errorf("Expected the decoded and raw body with webhook metadata, got %+v", rec)
+	}
+	if rec := list[0]; rec.DecodedBody != nil || rec.DecodeError != `unsupported content encoding "compress"` {
+		t.Errorf("Expected compress to be recorded as unsupported, got %+v", rec)
+	}
+	for _, field := range []string{`"request_body":{"id":"evt_1"`, `"request_body_encoding":"gzip"`, `"request_body_encoding":"compress","request_body_decode_error":"unsupported content encoding \"compress\""`} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("Expected log lines to contain %s, got %s", field, logs.String())
+		}
+	}
+}
+
+func TestManager_Logging_RendersBody(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	st := store.NewMemory(10, 1<<20)
+	cfg := config.Config{EnableRequestBody: true, BodyCaptureMax: 1 << 20, BodyLogMax: 1024}
+	handler := NewManager(cfg, st).Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("POST", "/form", strings.NewReader("name=caf%C3%A9&tag=a&tag=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("POST", "/upload", bytes.NewReader([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	list, _ := st.List(store.Filter{})
+	if len(list) != 2 || list[1].Content == nil || list[1].Content.Format != "form" || list[0].Content.Sniffed != "image/png" {
+		t.Fatalf("Expected the decoded content to be captured, got %v", list)
+	}
+	for _, field := range []string{
+		`"request_body":{"name":"café","tag":["a","b"]}`,
+		`"request_body_format":"form"`,
+		`"request_body":"iVBORw0KGgoAAAANSUhEUg==","request_body_format":"binary","request_body_sniffed":"image/png"`,
+	} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("Expected log lines to contain %s, got %s", field, logs.String())
+		}
+	}
+}
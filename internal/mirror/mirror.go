@@ -0,0 +1,296 @@
+// Package mirror sends copies of captured requests to shadow upstreams without affecting the original exchange.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Defaults for Options fields left at zero
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultConcurrency = 4
+	DefaultQueueSize   = 100
+)
+
+// maxResponseBody is how much of a shadow response is kept for result hooks
+const maxResponseBody = 1 << 20
+
+// ErrTruncated is returned for captured requests whose body exceeded the capture limit, since sending the
+// stored head would deliver a different request than the one received.
+var ErrTruncated = errors.New("captured body is truncated")
+
+// hopHeaders are connection specific and not copied to mirrored requests
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Options configures a Mirror.
+type Options struct {
+	// Timeout bounds each mirrored request
+	Timeout time.Duration
+	// Concurrency is the number of requests in flight per target
+	Concurrency int
+	// QueueSize is how many requests may wait per target before new ones are dropped
+	QueueSize int
+}
+
+// Mirror sends captured requests to shadow targets asynchronously.
+// Each target has its own queue and workers, so a slow target does not hold back the others.
+type Mirror struct {
+	targets []*target
+	client  *http.Client
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	closed   bool
+	wg       sync.WaitGroup
+	onResult []func(Result)
+}
+
+type target struct {
+	url   *url.URL
+	queue chan *store.CapturedRequest
+
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+}
+
+// Result is the outcome of a mirrored request.
+type Result struct {
+	Target   string
+	Request  *store.CapturedRequest
+	Status   int
+	Headers  http.Header
+	Body     []byte
+	Duration time.Duration
+	// Err is set when no response was received
+	Err error
+}
+
+// Stats counts the mirrored requests of a target.
+type Stats struct {
+	Target  string `json:"target"`
+	Sent    int64  `json:"sent"`
+	Failed  int64  `json:"failed"`
+	Dropped int64  `json:"dropped"`
+	Queued  int    `json:"queued"`
+}
+
+// New creates a mirror for the given target URLs and starts its workers.
+func New(targets []string, opts Options) (*Mirror, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+
+	m := &Mirror{
+		client: &http.Client{
+			// Redirects are answers to compare, not to follow
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		timeout: opts.Timeout,
+	}
+	for _, raw := range targets {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse mirror target: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("mirror target %q must be an absolute http or https URL", raw)
+		}
+		m.targets = append(m.targets, &target{
+			url:   u,
+			queue: make(chan *store.CapturedRequest, opts.QueueSize),
+		})
+	}
+
+	for _, t := range m.targets {
+		for range opts.Concurrency {
+			m.wg.Add(1)
+			go m.worker(t)
+		}
+	}
+	return m, nil
+}
+
+// OnResult registers fn to be called with the result of every mirrored request.
+// Hooks run on the mirror workers and must be registered before requests are mirrored.
+func (m *Mirror) OnResult(fn func(Result)) {
+	m.onResult = append(m.onResult, fn)
+}
+
+// Mirror queues a captured request for all targets. It never blocks;
+// requests are dropped for targets whose queue is full.
+func (m *Mirror) Mirror(req *store.CapturedRequest) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return
+	}
+	for _, t := range m.targets {
+		select {
+		case t.queue <- req:
+		default:
+			t.dropped.Add(1)
+			slog.Warn("Mirror queue full, dropping request",
+				"target", t.url.String(),
+				"request_id", req.ID)
+		}
+	}
+}
+
+// Stats returns the counters of every target.
+func (m *Mirror) Stats() []Stats {
+	stats := make([]Stats, 0, len(m.targets))
+	for _, t := range m.targets {
+		stats = append(stats, Stats{
+			Target:  t.url.String(),
+			Sent:    t.sent.Load(),
+			Failed:  t.failed.Load(),
+			Dropped: t.dropped.Load(),
+			Queued:  len(t.queue),
+		})
+	}
+	return stats
+}
+
+// ListTargets returns the mirror targets with their counters.
+func (m *Mirror) ListTargets(w http.ResponseWriter, _ *http.Request) {
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"targets": m.Stats(),
+	})
+}
+
+// Close stops accepting requests and waits until queued requests are sent or ctx is done.
+func (m *Mirror) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for _, t := range m.targets {
+			close(t.queue)
+		}
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Mirror) worker(t *target) {
+	defer m.wg.Done()
+
+	for req := range t.queue {
+		m.send(t, req)
+	}
+}
+
+func (m *Mirror) send(t *target, captured *store.CapturedRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	result := m.do(ctx, t.url, captured)
+	result.Target = t.url.String()
+	result.Request = captured
+
+	if result.Err != nil {
+		t.failed.Add(1)
+		slog.Warn("Mirrored request failed",
+			"target", result.Target,
+			"request_id", captured.ID,
+			"duration", result.Duration,
+			"error", result.Err)
+	} else {
+		t.sent.Add(1)
+		slog.Info("Mirrored request",
+			"target", result.Target,
+			"request_id", captured.ID,
+			"status", result.Status,
+			"duration", result.Duration)
+	}
+
+	for _, fn := range m.onResult {
+		fn(result)
+	}
+}
+
+func (m *Mirror) do(ctx context.Context, base *url.URL, captured *store.CapturedRequest) Result {
+	start := time.Now()
+	req, err := NewRequest(ctx, base, captured)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+
+	result := Result{Status: resp.StatusCode, Headers: resp.Header}
+	result.Body, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = fmt.Errorf("read response: %w", err)
+	}
+	return result
+}
+
+// NewRequest rebuilds a captured request for the given target, keeping method, path, query, headers and body.
+// The target path is prepended to the captured path. Requests with a truncated body fail with ErrTruncated.
+func NewRequest(ctx context.Context, base *url.URL, captured *store.CapturedRequest) (*http.Request, error) {
+	if captured.BodyTruncated {
+		return nil, fmt.Errorf("%w: %d of %d bytes kept", ErrTruncated, len(captured.Body), captured.BodySize)
+	}
+
+	u := base.JoinPath(captured.Path)
+	u.RawQuery = captured.Query
+
+	req, err := http.NewRequestWithContext(ctx, captured.Method, u.String(), bytes.NewReader(captured.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = captured.Headers.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Del("Content-Length")
+	req.Header.Set("X-Raccoon-Request-Id", captured.ID)
+	return req, nil
+}
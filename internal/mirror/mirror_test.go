@@ -0,0 +1,238 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+type received struct {
+	method string
+	uri    string
+	header http.Header
+	body   string
+}
+
+// newShadow starts a target recording the requests it receives
+func newShadow(t *testing.T, status int, delay time.Duration) (*httptest.Server, func() []received) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{method: r.Method, uri: r.RequestURI, header: r.Header, body: string(body)})
+		mu.Unlock()
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), requests...)
+	}
+}
+
+func capturedRequest(id string) *store.CapturedRequest {
+	return &store.CapturedRequest{
+		ID:     id,
+		Method: "POST",
+		Path:   "/webhooks/github",
+		Query:  "delivery=1",
+		Headers: http.Header{
+			"Content-Type":    {"application/json"},
+			"X-Hub-Signature": {"sha256=abc"},
+			"Connection":      {"keep-alive"},
+		},
+		Body: []byte(`{"action":"opened"}`),
+	}
+}
+
+func TestMirror_SendsToAllTargets(t *testing.T) {
+	first, firstRequests := newShadow(t, http.StatusOK, 0)
+	second, secondRequests := newShadow(t, http.StatusInternalServerError, 0)
+
+	m, err := New([]string{first.URL + "/shadow", second.URL}, Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	m.Mirror(capturedRequest("r1"))
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := firstRequests()
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 request at first target, got %d", len(got))
+	}
+	r := got[0]
+	if r.method != "POST" || r.uri != "/shadow/webhooks/github?delivery=1" || r.body != `{"action":"opened"}` {
+		t.Errorf("Unexpected mirrored request %+v", r)
+	}
+	if r.header.Get("X-Hub-Signature") != "sha256=abc" || r.header.Get("X-Raccoon-Request-Id") != "r1" {
+		t.Errorf("Expected headers to be copied, got %v", r.header)
+	}
+	if len(secondRequests()) != 1 {
+		t.Errorf("Expected 1 request at second target, got %d", len(secondRequests()))
+	}
+
+	stats := m.Stats()
+	if stats[0].Sent != 1 || stats[1].Sent != 1 || stats[0].Failed != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Requests after Close are ignored
+	m.Mirror(capturedRequest("r2"))
+	if len(firstRequests()) != 1 {
+		t.Error("Expected no requests after Close")
+	}
+}
+
+func TestMirror_DropsWhenQueueFull(t *testing.T) {
+	slow, slowRequests := newShadow(t, http.StatusOK, 100*time.Millisecond)
+
+	m, err := New([]string{slow.URL}, Options{Timeout: time.Second, Concurrency: 1, QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One request in flight and one queued, the rest is dropped
+	m.Mirror(capturedRequest("r1"))
+	deadline := time.Now().Add(time.Second)
+	for len(slowRequests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := range 3 {
+		m.Mirror(capturedRequest("r" + strconv.Itoa(i+2)))
+	}
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := m.Stats()[0]
+	if stats.Sent != 2 || stats.Dropped != 2 {
+		t.Errorf("Expected 2 sent and 2 dropped, got %+v", stats)
+	}
+}
+
+func TestMirror_Timeout(t *testing.T) {
+	slow, _ := newShadow(t, http.StatusOK, 200*time.Millisecond)
+
+	m, err := New([]string{slow.URL}, Options{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Mirror(capturedRequest("r1"))
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := m.Stats()[0]; stats.Failed != 1 || stats.Sent != 0 {
+		t.Errorf("Expected 1 failed request, got %+v", stats)
+	}
+}
+
+func TestMirror_ListTargets(t *testing.T) {
+	m, err := New([]string{"http://shadow.internal:8080"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close(context.Background())
+
+	rr := httptest.NewRecorder()
+	m.ListTargets(rr, httptest.NewRequest("GET", "/api/mirrors", nil))
+
+	var body struct {
+		Targets []Stats `json:"targets"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode targets: %v", err)
+	}
+	if len(body.Targets) != 1 || body.Targets[0].Target != "http://shadow.internal:8080" {
+		t.Errorf("Unexpected targets %+v", body.Targets)
+	}
+}
+
+func TestNew_InvalidTarget(t *testing.T) {
+	if _, err := New([]string{"shadow:8080"}, Options{}); err == nil {
+		t.Error("Expected error for relative target")
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	base, _ := url.Parse("http://shadow:8080/v2")
+	req, err := NewRequest(context.Background(), base, capturedRequest("r1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "http://shadow:8080/v2/webhooks/github?delivery=1" {
+		t.Errorf("Unexpected URL %s", req.URL)
+	}
+	if req.Header.Get("Connection") != "" {
+		t.Error("Expected hop-by-hop headers to be removed")
+	}
+}
+
+func TestNewRequest_Truncated(t *testing.T) {
+	captured := capturedRequest("r1")
+	captured.BodySize = int64(len(captured.Body)) + 100
+	captured.BodyTruncated = true
+
+	base, _ := url.Parse("http://shadow:8080")
+	if req, err := NewRequest(context.Background(), base, captured); !errors.Is(err, ErrTruncated) || req != nil {
+		t.Errorf("Expected a truncated body to be refused, got %v", err)
+	}
+}
+
+func TestMirror_OnResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	m, err := New([]string{srv.URL, "http://127.0.0.1:1"}, Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	results := map[string]Result{}
+	m.OnResult(func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[r.Target] = r
+	})
+
+	req := capturedRequest("r1")
+	m.Mirror(req)
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	ok := results[srv.URL]
+	if ok.Request != req || ok.Err != nil {
+		t.Fatalf("Unexpected result %+v", ok)
+	}
+	if ok.Status != http.StatusAccepted || ok.Headers.Get("Content-Type") != "application/json" || string(ok.Body) != `{"ok":true}` {
+		t.Errorf("Unexpected response %d %v %q", ok.Status, ok.Headers, ok.Body)
+	}
+
+	if failed := results["http://127.0.0.1:1"]; failed.Err == nil || failed.Status != 0 {
+		t.Errorf("Expected an error for unreachable target, got %+v", failed)
+	}
+}
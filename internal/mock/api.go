@@ -0,0 +1,156 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+)
+
+// API contains the admin API handlers managing mock rules.
+// Changes made through the API are kept in memory until the rules file is reloaded.
+type API struct {
+	engine *Engine
+}
+
+// NewAPI creates the mock rule API for the given engine.
+func NewAPI(e *Engine) *API {
+	return &API{
+		engine: e,
+	}
+}
+
+// ListRules returns all rules in evaluation order.
+func (a *API) ListRules(w http.ResponseWriter, _ *http.Request) {
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": a.engine.Rules(),
+	})
+}
+
+// ReplaceRules replaces all rules with the JSON array in the request body.
+func (a *API) ReplaceRules(w http.ResponseWriter, r *http.Request) {
+	var rules []Rule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		api.WriteError(w, http.StatusBadRequest, "invalid rules: "+err.Error())
+		return
+	}
+	if err := a.engine.SetRules(rules); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+
+	a.ListRules(w, r)
+}
+
+// CreateRule adds a single rule.
+func (a *API) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		api.WriteError(w, http.StatusBadRequest, "invalid rule: "+err.Error())
+		return
+	}
+
+	created, err := a.engine.Add(rule)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GetRule returns a single rule.
+func (a *API) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := a.engine.Get(r.PathValue("id"))
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, rule)
+}
+
+// UpdateRule replaces a single rule.
+func (a *API) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	var rule Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		api.WriteError(w, http.StatusBadRequest, "invalid rule: "+err.Error())
+		return
+	}
+
+	updated, err := a.engine.Update(r.PathValue("id"), rule)
+	if err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, updated)
+}
+
+// DeleteRule removes a single rule.
+func (a *API) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	if err := a.engine.Delete(r.PathValue("id")); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReloadRules loads the rules file again.
+func (a *API) ReloadRules(w http.ResponseWriter, r *http.Request) {
+	if err := a.engine.Reload(); err != nil {
+		slog.Error("Failed to reload mock rules", "error", err)
+		api.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	a.ListRules(w, r)
+}
+
+// ListScenarios returns all scenarios with their current state.
+func (a *API) ListScenarios(w http.ResponseWriter, _ *http.Request) {
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"scenarios": a.engine.Scenarios(),
+	})
+}
+
+// SetScenarioState moves a scenario to the state in the request body.
+func (a *API) SetScenarioState(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, "invalid state: "+err.Error())
+		return
+	}
+
+	if err := a.engine.SetScenarioState(r.PathValue("name"), body.State); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetScenario moves a scenario back to its initial state.
+func (a *API) ResetScenario(w http.ResponseWriter, r *http.Request) {
+	if err := a.engine.ResetScenario(r.PathValue("name")); err != nil {
+		writeRuleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetScenarios moves all scenarios back to their initial state.
+func (a *API) ResetScenarios(w http.ResponseWriter, _ *http.Request) {
+	a.engine.ResetScenarios()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRuleNotFound), errors.Is(err, ErrScenarioNotFound):
+		api.WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrDuplicateID):
+		api.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		api.WriteError(w, http.StatusBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,138 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestAPI(t *testing.T) (*http.ServeMux, *Engine) {
+	t.Helper()
+
+	e := NewEngine()
+	a := NewAPI(e)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/mocks", a.ListRules)
+	mux.HandleFunc("POST /api/mocks", a.CreateRule)
+	mux.HandleFunc("PUT /api/mocks", a.ReplaceRules)
+	mux.HandleFunc("POST /api/mocks/reload", a.ReloadRules)
+	mux.HandleFunc("GET /api/mocks/{id}", a.GetRule)
+	mux.HandleFunc("PUT /api/mocks/{id}", a.UpdateRule)
+	mux.HandleFunc("DELETE /api/mocks/{id}", a.DeleteRule)
+	mux.HandleFunc("GET /api/scenarios", a.ListScenarios)
+	mux.HandleFunc("DELETE /api/scenarios", a.ResetScenarios)
+	mux.HandleFunc("PUT /api/scenarios/{name}", a.SetScenarioState)
+	mux.HandleFunc("DELETE /api/scenarios/{name}", a.ResetScenario)
+	return mux, e
+}
+
+func serve(mux http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rr
+}
+
+func TestAPI_Rules(t *testing.T) {
+	mux, e := newTestAPI(t)
+
+	rr := serve(mux, "POST", "/api/mocks", `{"id":"ping","match":{"path":"/ping"},"response":{"body":"pong"}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	rr = serve(mux, "POST", "/api/mocks", `{"id":"ping"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for duplicate, got %d", http.StatusConflict, rr.Code)
+	}
+
+	rr = serve(mux, "POST", "/api/mocks", `{"match":{"path_regex":"("}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid rule, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = serve(mux, "PUT", "/api/mocks/ping", `{"match":{"path":"/ping"},"response":{"status":204}}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	rr = serve(mux, "GET", "/api/mocks/ping", "")
+	var rule Rule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil {
+		t.Fatalf("Failed to decode rule: %v", err)
+	}
+	if rule.ID != "ping" || rule.Response.Status != http.StatusNoContent {
+		t.Errorf("Expected updated rule, got %+v", rule)
+	}
+
+	rr = serve(mux, "DELETE", "/api/mocks/ping", "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	rr = serve(mux, "GET", "/api/mocks/ping", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	rr = serve(mux, "PUT", "/api/mocks", `[{"id":"a"},{"id":"b","priority":1}]`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var list struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode rules: %v", err)
+	}
+	if len(list.Rules) != 2 || list.Rules[0].ID != "b" {
+		t.Errorf("Expected rules in priority order, got %+v", list.Rules)
+	}
+	if len(e.Rules()) != 2 {
+		t.Errorf("Expected engine to hold 2 rules, got %d", len(e.Rules()))
+	}
+
+	rr = serve(mux, "POST", "/api/mocks/reload", "")
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d without rules file, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestAPI_Scenarios(t *testing.T) {
+	mux, e := newTestAPI(t)
+	if err := e.SetRules(retryScenario()); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serve(mux, "PUT", "/api/scenarios/job", `{"state":"retried"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	rr = serve(mux, "GET", "/api/scenarios", "")
+	var list struct {
+		Scenarios []Scenario `json:"scenarios"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode scenarios: %v", err)
+	}
+	if len(list.Scenarios) != 1 || list.Scenarios[0].State != "retried" {
+		t.Errorf("Expected job scenario in state retried, got %+v", list.Scenarios)
+	}
+
+	rr = serve(mux, "DELETE", "/api/scenarios/job", "")
+	if rr.Code != http.StatusNoContent || e.Scenarios()[0].State != StartedState {
+		t.Errorf("Expected scenario reset, got %d %+v", rr.Code, e.Scenarios())
+	}
+
+	rr = serve(mux, "PUT", "/api/scenarios/missing", `{"state":"x"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	rr = serve(mux, "DELETE", "/api/scenarios", "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+}
@@ -0,0 +1,350 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// maxMatchBody is the largest request body inspected by body conditions
+const maxMatchBody = 10 << 20
+
+// Errors returned by rule management
+var (
+	ErrRuleNotFound = errors.New("rule not found")
+	ErrDuplicateID  = errors.New("duplicate rule id")
+)
+
+// Engine answers requests with the first matching mock rule.
+// It is safe for concurrent use.
+type Engine struct {
+	mu    sync.RWMutex
+	rules []*compiledRule
+	// states holds the current state of scenarios that left StartedState
+	states map[string]string
+	// file is the rules file the rules were loaded from, used by Reload
+	file string
+}
+
+// NewEngine creates an engine without any rules.
+func NewEngine() *Engine {
+	return &Engine{
+		states: make(map[string]string),
+	}
+}
+
+// LoadFile replaces the rules with the JSON array of rules in the given file
+// and remembers the file for Reload.
+func (e *Engine) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read rules file: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse rules file %s: %w", path, err)
+	}
+
+	// Body files are resolved against the rules file directory
+	dir := filepath.Dir(path)
+	for i := range rules {
+		if f := rules[i].Response.BodyFile; f != "" && !filepath.IsAbs(f) {
+			rules[i].Response.BodyFile = filepath.Join(dir, f)
+		}
+	}
+
+	if err := e.SetRules(rules); err != nil {
+		return fmt.Errorf("load rules file %s: %w", path, err)
+	}
+
+	e.mu.Lock()
+	e.file = path
+	e.mu.Unlock()
+	return nil
+}
+
+// Reload loads the rules file again, discarding changes made through the API.
+func (e *Engine) Reload() error {
+	e.mu.RLock()
+	path := e.file
+	e.mu.RUnlock()
+
+	if path == "" {
+		return errors.New("no rules file configured")
+	}
+	return e.LoadFile(path)
+}
+
+// SetRules replaces all rules and resets all scenarios. Rules without an ID get one assigned.
+// Nothing is changed when any of the rules is invalid.
+func (e *Engine) SetRules(rules []Rule) error {
+	compiled := make([]*compiledRule, 0, len(rules))
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.ID == "" {
+			rule.ID = store.NewID()
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("%w: %s", ErrDuplicateID, rule.ID)
+		}
+		seen[rule.ID] = true
+
+		c, err := compileRule(rule)
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i, rule.ID, err)
+		}
+		compiled = append(compiled, c)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = sortRules(compiled)
+	clear(e.states)
+	return nil
+}
+
+// Rules returns all rules in evaluation order.
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(e.rules))
+	for _, c := range e.rules {
+		rules = append(rules, c.Rule)
+	}
+	return rules
+}
+
+// Get returns the rule with the given ID.
+func (e *Engine) Get(id string) (Rule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if i := e.index(id); i >= 0 {
+		return e.rules[i].Rule, nil
+	}
+	return Rule{}, ErrRuleNotFound
+}
+
+// Add adds a rule and returns it with its assigned ID.
+func (e *Engine) Add(rule Rule) (Rule, error) {
+	if rule.ID == "" {
+		rule.ID = store.NewID()
+	}
+	c, err := compileRule(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.index(rule.ID) >= 0 {
+		return Rule{}, fmt.Errorf("%w: %s", ErrDuplicateID, rule.ID)
+	}
+	e.rules = sortRules(append(slices.Clone(e.rules), c))
+	return c.Rule, nil
+}
+
+// Update replaces the rule with the given ID.
+func (e *Engine) Update(id string, rule Rule) (Rule, error) {
+	rule.ID = id
+	c, err := compileRule(rule)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(id)
+	if i < 0 {
+		return Rule{}, ErrRuleNotFound
+	}
+	rules := slices.Clone(e.rules)
+	rules[i] = c
+	e.rules = sortRules(rules)
+	return c.Rule, nil
+}
+
+// Delete removes the rule with the given ID.
+func (e *Engine) Delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := e.index(id)
+	if i < 0 {
+		return ErrRuleNotFound
+	}
+	e.rules = slices.Delete(slices.Clone(e.rules), i, i+1)
+	return nil
+}
+
+// Match returns the first rule matching the request and its body in the current scenario states.
+// The scenario of the matching rule moves to the rule's new state.
+func (e *Engine) Match(r *http.Request, body []byte) (Rule, bool) {
+	if c := e.match(r, body); c != nil {
+		return c.Rule, true
+	}
+	return Rule{}, false
+}
+
+func (e *Engine) match(r *http.Request, body []byte) *compiledRule {
+	// Matching and the state transition happen under one lock so concurrent requests see every state
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, c := range e.rules {
+		if c.RequiredState != "" && c.RequiredState != e.state(c.Scenario) {
+			continue
+		}
+		if c.matches(r, body) {
+			if c.NewState != "" {
+				e.states[c.Scenario] = c.NewState
+			}
+			return c
+		}
+	}
+	return nil
+}
+
+// Handler answers requests matching a rule and passes all other requests to fallback.
+// The ID of the matching rule is recorded on the captured request.
+func (e *Engine) Handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := readBody(r)
+		if err != nil {
+			slog.Error("Failed to read request body for mock matching", "error", err)
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		rule := e.match(r, body)
+		if rule == nil {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		if rec := store.FromContext(r.Context()); rec != nil {
+			rec.MockRule = rule.ID
+		}
+		respond(w, r, rule, body)
+	})
+}
+
+func respond(w http.ResponseWriter, r *http.Request, rule *compiledRule, reqBody []byte) {
+	resp := rule.Response
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(time.Duration(resp.Delay))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	body, headers, err := renderResponse(r, rule, reqBody)
+	if err != nil {
+		slog.Error("Failed to render mock response", "error", err, "rule", rule.ID)
+		http.Error(w, "failed to render mock response", http.StatusInternalServerError)
+		return
+	}
+
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		slog.Error("Failed to write mock response", "error", err, "rule", rule.ID)
+	}
+}
+
+// renderResponse returns the response body and headers, rendering templates with the request data
+func renderResponse(r *http.Request, rule *compiledRule, reqBody []byte) ([]byte, map[string]string, error) {
+	resp := rule.Response
+	body := []byte(resp.Body)
+	if resp.BodyFile != "" {
+		data, err := os.ReadFile(resp.BodyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read body file: %w", err)
+		}
+		body = data
+	}
+	if !resp.Template {
+		return body, resp.Headers, nil
+	}
+
+	bodyTemplate := rule.bodyTemplate
+	if resp.BodyFile != "" {
+		var err error
+		if bodyTemplate, err = parseTemplate("body", string(body)); err != nil {
+			return nil, nil, fmt.Errorf("parse body file template: %w", err)
+		}
+	}
+
+	data := newTemplateData(r, reqBody)
+	body, err := renderTemplate(bodyTemplate, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("render body: %w", err)
+	}
+
+	headers := make(map[string]string, len(rule.headerTemplates))
+	for name, tmpl := range rule.headerTemplates {
+		value, err := renderTemplate(tmpl, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("render header %s: %w", name, err)
+		}
+		headers[name] = string(value)
+	}
+	return body, headers, nil
+}
+
+// index returns the position of the rule with the given ID or -1, callers must hold the lock
+func (e *Engine) index(id string) int {
+	return slices.IndexFunc(e.rules, func(c *compiledRule) bool {
+		return c.ID == id
+	})
+}
+
+// sortRules orders rules by descending priority, keeping the order of equal priorities
+func sortRules(rules []*compiledRule) []*compiledRule {
+	slices.SortStableFunc(rules, func(a, b *compiledRule) int {
+		return b.Priority - a.Priority
+	})
+	return rules
+}
+
+// readBody reads the request body for matching and restores it for the next handler
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMatchBody))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	return body, nil
+}
@@ -0,0 +1,215 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+var fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.WriteHeader(http.StatusTeapot)
+	_, _ = w.Write(body)
+})
+
+func TestEngine_Priority(t *testing.T) {
+	e := NewEngine()
+	err := e.SetRules([]Rule{
+		{ID: "catch-all", Match: Match{Path: "/**"}},
+		{ID: "specific", Priority: 10, Match: Match{Path: "/users/*"}},
+		{ID: "second-catch-all", Match: Match{Path: "/**"}},
+	})
+	if err != nil {
+		t.Fatalf("SetRules failed: %v", err)
+	}
+
+	rule, ok := e.Match(httptest.NewRequest("GET", "/users/1", nil), nil)
+	if !ok || rule.ID != "specific" {
+		t.Errorf("Expected specific rule, got %q", rule.ID)
+	}
+
+	// Equal priorities keep their definition order
+	rule, ok = e.Match(httptest.NewRequest("GET", "/orders", nil), nil)
+	if !ok || rule.ID != "catch-all" {
+		t.Errorf("Expected catch-all rule, got %q", rule.ID)
+	}
+}
+
+func TestEngine_SetRulesInvalid(t *testing.T) {
+	e := NewEngine()
+	if err := e.SetRules([]Rule{{ID: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.SetRules([]Rule{{ID: "b"}, {ID: "b"}}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+	if err := e.SetRules([]Rule{{ID: "c", Match: Match{PathRegex: "("}}}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Expected ErrInvalidRule, got %v", err)
+	}
+
+	// Failed replacements keep the previous rules
+	if rules := e.Rules(); len(rules) != 1 || rules[0].ID != "a" {
+		t.Errorf("Expected previous rules to be kept, got %v", rules)
+	}
+}
+
+func TestEngine_CRUD(t *testing.T) {
+	e := NewEngine()
+
+	rule, err := e.Add(Rule{Match: Match{Path: "/a"}})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if rule.ID == "" {
+		t.Fatal("Expected an assigned ID")
+	}
+	if _, err := e.Add(Rule{ID: rule.ID}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Expected ErrDuplicateID, got %v", err)
+	}
+
+	if _, err := e.Update(rule.ID, Rule{Match: Match{Path: "/b"}}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	got, err := e.Get(rule.ID)
+	if err != nil || got.Match.Path != "/b" {
+		t.Errorf("Expected updated rule, got %+v (%v)", got, err)
+	}
+	if _, err := e.Update("missing", Rule{}); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+
+	if err := e.Delete(rule.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := e.Get(rule.ID); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+	if err := e.Delete(rule.ID); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+}
+
+func TestEngine_Handler(t *testing.T) {
+	e := NewEngine()
+	err := e.SetRules([]Rule{{
+		ID:    "refund",
+		Match: Match{Method: "POST", Body: &BodyMatch{JSON: map[string]any{"type": "refund"}}},
+		Response: Response{
+			Status:  http.StatusAccepted,
+			Headers: map[string]string{"Content-Type": "application/json", "X-Mock": "yes"},
+			Body:    `{"queued":true}`,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := e.Handler(fallback)
+
+	rec := &store.CapturedRequest{ID: "1"}
+	req := httptest.NewRequest("POST", "/payments", strings.NewReader(`{"type":"refund"}`))
+	req = req.WithContext(store.NewContext(req.Context(), rec))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	if rr.Header().Get("X-Mock") != "yes" {
+		t.Errorf("Expected mock header, got %v", rr.Header())
+	}
+	if rr.Body.String() != `{"queued":true}` {
+		t.Errorf("Unexpected body %s", rr.Body.String())
+	}
+	if rec.MockRule != "refund" {
+		t.Errorf("Expected mock rule to be recorded, got %q", rec.MockRule)
+	}
+
+	// Unmatched requests reach the fallback with their body intact
+	req = httptest.NewRequest("POST", "/payments", strings.NewReader(`{"type":"charge"}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTeapot || rr.Body.String() != `{"type":"charge"}` {
+		t.Errorf("Expected fallback with body, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEngine_HandlerDelay(t *testing.T) {
+	e := NewEngine()
+	if err := e.SetRules([]Rule{{ID: "slow", Response: Response{Delay: Duration(50 * time.Millisecond)}}}); err != nil {
+		t.Fatal(err)
+	}
+	handler := e.Handler(fallback)
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected response to be delayed, took %v", elapsed)
+	}
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected default status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	// A cancelled request does not wait for the delay
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Expected cancelled request to return early, took %v", elapsed)
+	}
+}
+
+func TestEngine_LoadFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"name":"raccoon"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rulesFile := filepath.Join(dir, "rules.json")
+	rules := `[{"id":"user","match":{"path":"/users/*"},"response":{"body_file":"user.json"}}]`
+	if err := os.WriteFile(rulesFile, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine()
+	if err := e.LoadFile(rulesFile); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	e.Handler(fallback).ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Body.String() != `{"name":"raccoon"}` {
+		t.Errorf("Expected body from file, got %s", rr.Body.String())
+	}
+
+	// Reload discards changes made in the meantime
+	if err := e.Delete("user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(e.Rules()) != 1 {
+		t.Errorf("Expected 1 rule after reload, got %d", len(e.Rules()))
+	}
+
+	if err := NewEngine().Reload(); err == nil {
+		t.Error("Expected error reloading without a rules file")
+	}
+	if err := os.WriteFile(rulesFile, []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadFile(rulesFile); err == nil {
+		t.Error("Expected error for malformed rules file")
+	}
+}
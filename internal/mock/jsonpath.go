@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LookupJSON resolves a simple JSON path in a decoded JSON document.
+// Paths use dot notation with optional array indexes, for example
+// "$.data.items[0].id" or "data.items.0.id". The leading "$" is optional.
+func LookupJSON(doc any, path string) (any, bool) {
+	for _, key := range splitJSONPath(path) {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil
+	}
+
+	// Treat "a[0]" as "a.0"
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(strings.TrimPrefix(path, "."), ".")
+}
@@ -0,0 +1,40 @@
+package mock
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupJSON(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"data":{"items":[{"id":"a"},{"id":"b"}],"count":2},"ok":true}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected any
+		found    bool
+	}{
+		{path: "$.data.items[1].id", expected: "b", found: true},
+		{path: "data.items.0.id", expected: "a", found: true},
+		{path: "$.data.count", expected: float64(2), found: true},
+		{path: "ok", expected: true, found: true},
+		{path: "$.data.items[2].id", found: false},
+		{path: "$.data.missing", found: false},
+		{path: "$.ok.nested", found: false},
+		{path: "$.data.items.x", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, found := LookupJSON(doc, tt.path)
+			if found != tt.found {
+				t.Fatalf("Expected found %v, got %v", tt.found, found)
+			}
+			if found && got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// ErrInvalidRule is returned for rules that cannot be compiled
+var ErrInvalidRule = errors.New("invalid rule")
+
+// Rule describes a mock response returned for matching requests.
+type Rule struct {
+	ID string `json:"id"`
+	// Name is a human readable description
+	Name string `json:"name,omitempty"`
+	// Priority orders rules; higher priorities are evaluated first, ties keep their definition order
+	Priority int `json:"priority,omitempty"`
+	// Scenario names the state machine the rule belongs to, see StartedState
+	Scenario string `json:"scenario,omitempty"`
+	// RequiredState limits the rule to a state of its scenario, empty matches in any state
+	RequiredState string `json:"required_state,omitempty"`
+	// NewState is the state the scenario moves to when the rule matches
+	NewState string   `json:"new_state,omitempty"`
+	Match    Match    `json:"match"`
+	Response Response `json:"response"`
+}
+
+// Match holds the conditions a request must meet. Empty conditions match everything.
+type Match struct {
+	Method string `json:"method,omitempty"`
+	// Path is a glob, see store.MatchGlob
+	Path string `json:"path,omitempty"`
+	// PathRegex is a regular expression the whole path must match
+	PathRegex string `json:"path_regex,omitempty"`
+	// Headers and Query map names to required values; an empty value only requires presence
+	Headers map[string]string `json:"headers,omitempty"`
+	Query   map[string]string `json:"query,omitempty"`
+	Body    *BodyMatch        `json:"body,omitempty"`
+}
+
+// BodyMatch holds conditions on the request body.
+type BodyMatch struct {
+	Contains string `json:"contains,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	// JSON maps JSON paths (see LookupJSON) to the value expected at that path
+	JSON map[string]any `json:"json,omitempty"`
+}
+
+// Response describes what a rule answers.
+type Response struct {
+	// Status defaults to 200
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// BodyFile is read on every response, relative paths are resolved against the rules file directory
+	BodyFile string   `json:"body_file,omitempty"`
+	Delay    Duration `json:"delay,omitempty"`
+	// Template renders the body and header values as Go templates with the request as data
+	Template bool `json:"template,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a string such as "250ms" in JSON
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("duration must be a string like \"250ms\": %w", err)
+		}
+		*d = Duration(n)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// compiledRule is a rule with its regular expressions compiled
+type compiledRule struct {
+	Rule
+	pathRegex *regexp.Regexp
+	bodyRegex *regexp.Regexp
+	// Templates are only set for rules with Response.Template
+	bodyTemplate    *template.Template
+	headerTemplates map[string]*template.Template
+}
+
+func compileRule(rule Rule) (*compiledRule, error) {
+	c := &compiledRule{Rule: rule}
+
+	if rule.Response.Status != 0 && (rule.Response.Status < 100 || rule.Response.Status > 999) {
+		return nil, fmt.Errorf("%w: status %d out of range", ErrInvalidRule, rule.Response.Status)
+	}
+	if rule.Scenario == "" && (rule.RequiredState != "" || rule.NewState != "") {
+		return nil, fmt.Errorf("%w: required_state and new_state need a scenario", ErrInvalidRule)
+	}
+	if rule.Response.Delay < 0 {
+		return nil, fmt.Errorf("%w: negative delay", ErrInvalidRule)
+	}
+
+	var err error
+	if rule.Match.PathRegex != "" {
+		if c.pathRegex, err = regexp.Compile("^(?:" + rule.Match.PathRegex + ")$"); err != nil {
+			return nil, fmt.Errorf("%w: path_regex: %w", ErrInvalidRule, err)
+		}
+	}
+	if rule.Match.Body != nil && rule.Match.Body.Regex != "" {
+		if c.bodyRegex, err = regexp.Compile(rule.Match.Body.Regex); err != nil {
+			return nil, fmt.Errorf("%w: body regex: %w", ErrInvalidRule, err)
+		}
+	}
+	if rule.Response.Template {
+		if err := c.compileTemplates(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *compiledRule) compileTemplates() error {
+	var err error
+	if c.bodyTemplate, err = parseTemplate("body", c.Response.Body); err != nil {
+		return fmt.Errorf("%w: body template: %w", ErrInvalidRule, err)
+	}
+
+	c.headerTemplates = make(map[string]*template.Template, len(c.Response.Headers))
+	for name, value := range c.Response.Headers {
+		if c.headerTemplates[name], err = parseTemplate(name, value); err != nil {
+			return fmt.Errorf("%w: header %s template: %w", ErrInvalidRule, name, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the request and its body satisfy the rule
+func (c *compiledRule) matches(r *http.Request, body []byte) bool {
+	m := c.Match
+	if m.Method != "" && !strings.EqualFold(m.Method, r.Method) {
+		return false
+	}
+	if m.Path != "" && !store.MatchGlob(m.Path, r.URL.Path) {
+		return false
+	}
+	if c.pathRegex != nil && !c.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if !matchValues(m.Headers, r.Header.Values) {
+		return false
+	}
+	query := r.URL.Query()
+	if !matchValues(m.Query, func(key string) []string { return query[key] }) {
+		return false
+	}
+	return c.matchBody(body)
+}
+
+func (c *compiledRule) matchBody(body []byte) bool {
+	bm := c.Match.Body
+	if bm == nil {
+		return true
+	}
+	if bm.Contains != "" && !strings.Contains(string(body), bm.Contains) {
+		return false
+	}
+	if c.bodyRegex != nil && !c.bodyRegex.Match(body) {
+		return false
+	}
+	if len(bm.JSON) == 0 {
+		return true
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return false
+	}
+	for path, expected := range bm.JSON {
+		actual, ok := LookupJSON(doc, path)
+		if !ok || !reflect.DeepEqual(actual, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchValues(want map[string]string, values func(string) []string) bool {
+	for name, value := range want {
+		got := values(name)
+		if len(got) == 0 {
+			return false
+		}
+		if value != "" && !contains(got, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
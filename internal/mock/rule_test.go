@@ -0,0 +1,152 @@
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRule_Matches(t *testing.T) {
+	tests := []struct {
+		name     string
+		match    Match
+		method   string
+		target   string
+		headers  map[string]string
+		body     string
+		expected bool
+	}{
+		{name: "empty match", match: Match{}, method: "GET", target: "/anything", expected: true},
+		{name: "method", match: Match{Method: "post"}, method: "POST", target: "/", expected: true},
+		{name: "method mismatch", match: Match{Method: "POST"}, method: "GET", target: "/", expected: false},
+		{name: "path glob", match: Match{Path: "/users/*"}, method: "GET", target: "/users/42", expected: true},
+		{name: "path glob mismatch", match: Match{Path: "/users/*"}, method: "GET", target: "/users/42/posts"},
+		{name: "path regex", match: Match{PathRegex: `/users/\d+`}, method: "GET", target: "/users/42", expected: true},
+		{name: "path regex anchored", match: Match{PathRegex: `/users/\d+`}, method: "GET", target: "/users/42/x"},
+		{
+			name:     "header value",
+			match:    Match{Headers: map[string]string{"X-Tenant": "acme"}},
+			method:   "GET",
+			target:   "/",
+			headers:  map[string]string{"X-Tenant": "acme"},
+			expected: true,
+		},
+		{
+			name:    "header value mismatch",
+			match:   Match{Headers: map[string]string{"X-Tenant": "acme"}},
+			method:  "GET",
+			target:  "/",
+			headers: map[string]string{"X-Tenant": "other"},
+		},
+		{
+			name:     "header presence",
+			match:    Match{Headers: map[string]string{"Authorization": ""}},
+			method:   "GET",
+			target:   "/",
+			headers:  map[string]string{"Authorization": "Bearer x"},
+			expected: true,
+		},
+		{name: "header missing", match: Match{Headers: map[string]string{"Authorization": ""}}, method: "GET", target: "/"},
+		{name: "query", match: Match{Query: map[string]string{"page": "2"}}, method: "GET", target: "/?page=2", expected: true},
+		{name: "query mismatch", match: Match{Query: map[string]string{"page": "2"}}, method: "GET", target: "/?page=3"},
+		{
+			name:     "body contains",
+			match:    Match{Body: &BodyMatch{Contains: "refund"}},
+			method:   "POST",
+			target:   "/",
+			body:     `{"type":"refund"}`,
+			expected: true,
+		},
+		{
+			name:     "body regex",
+			match:    Match{Body: &BodyMatch{Regex: `"amount":\s*\d{4,}`}},
+			method:   "POST",
+			target:   "/",
+			body:     `{"amount": 10000}`,
+			expected: true,
+		},
+		{
+			name:     "body json path",
+			match:    Match{Body: &BodyMatch{JSON: map[string]any{"$.order.items[0].sku": "A-1", "$.order.paid": true}}},
+			method:   "POST",
+			target:   "/",
+			body:     `{"order":{"paid":true,"items":[{"sku":"A-1"}]}}`,
+			expected: true,
+		},
+		{
+			name:   "body json path mismatch",
+			match:  Match{Body: &BodyMatch{JSON: map[string]any{"$.order.paid": true}}},
+			method: "POST",
+			target: "/",
+			body:   `{"order":{"paid":false}}`,
+		},
+		{
+			name:   "body json invalid",
+			match:  Match{Body: &BodyMatch{JSON: map[string]any{"$.order.paid": true}}},
+			method: "POST",
+			target: "/",
+			body:   `not json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileRule(Rule{ID: "r", Match: tt.match})
+			if err != nil {
+				t.Fatalf("compileRule failed: %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := c.matches(req, []byte(tt.body)); got != tt.expected {
+				t.Errorf("Expected match %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompileRule_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "path regex", rule: Rule{Match: Match{PathRegex: "("}}},
+		{name: "body regex", rule: Rule{Match: Match{Body: &BodyMatch{Regex: "["}}}},
+		{name: "status", rule: Rule{Response: Response{Status: 42}}},
+		{name: "delay", rule: Rule{Response: Response{Delay: Duration(-time.Second)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileRule(tt.rule); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Expected ErrInvalidRule, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDuration_JSON(t *testing.T) {
+	var resp Response
+	if err := json.Unmarshal([]byte(`{"delay":"1.5s"}`), &resp); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if time.Duration(resp.Delay) != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s, got %v", time.Duration(resp.Delay))
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"delay":"1.5s"}` {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"delay":"soon"}`), &resp); err == nil {
+		t.Error("Expected error for invalid duration")
+	}
+}
@@ -0,0 +1,99 @@
+package mock
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// StartedState is the state of every scenario before any transition and after a reset
+const StartedState = "Started"
+
+// ErrScenarioNotFound is returned for scenarios no rule belongs to
+var ErrScenarioNotFound = errors.New("scenario not found")
+
+// Scenario describes the current state of a scenario.
+type Scenario struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// States lists the states used by the rules of the scenario
+	States []string `json:"states"`
+}
+
+// Scenarios returns all scenarios used by the rules, sorted by name.
+func (e *Engine) Scenarios() []Scenario {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	states := make(map[string][]string)
+	for _, c := range e.rules {
+		if c.Scenario == "" {
+			continue
+		}
+		known := append(states[c.Scenario], StartedState)
+		for _, state := range []string{c.RequiredState, c.NewState} {
+			if state != "" {
+				known = append(known, state)
+			}
+		}
+		states[c.Scenario] = known
+	}
+
+	scenarios := make([]Scenario, 0, len(states))
+	for name, known := range states {
+		slices.Sort(known)
+		scenarios = append(scenarios, Scenario{
+			Name:   name,
+			State:  e.state(name),
+			States: slices.Compact(known),
+		})
+	}
+	slices.SortFunc(scenarios, func(a, b Scenario) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return scenarios
+}
+
+// SetScenarioState moves a scenario to the given state.
+func (e *Engine) SetScenarioState(name, state string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.hasScenario(name) {
+		return ErrScenarioNotFound
+	}
+	if state == "" || state == StartedState {
+		delete(e.states, name)
+		return nil
+	}
+	e.states[name] = state
+	return nil
+}
+
+// ResetScenario moves a scenario back to StartedState.
+func (e *Engine) ResetScenario(name string) error {
+	return e.SetScenarioState(name, StartedState)
+}
+
+// ResetScenarios moves all scenarios back to StartedState.
+func (e *Engine) ResetScenarios() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	clear(e.states)
+}
+
+// state returns the current state of a scenario, callers must hold the lock
+func (e *Engine) state(name string) string {
+	if state, ok := e.states[name]; ok {
+		return state
+	}
+	return StartedState
+}
+
+// hasScenario reports whether any rule belongs to the scenario, callers must hold the lock
+func (e *Engine) hasScenario(name string) bool {
+	return slices.ContainsFunc(e.rules, func(c *compiledRule) bool {
+		return c.Scenario == name
+	})
+}
@@ -0,0 +1,138 @@
+package mock
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// retryScenario models "first call fails, retry succeeds, then the job is done"
+func retryScenario() []Rule {
+	return []Rule{
+		{
+			ID:            "unavailable",
+			Scenario:      "job",
+			RequiredState: StartedState,
+			NewState:      "retried",
+			Match:         Match{Method: "POST", Path: "/jobs"},
+			Response:      Response{Status: http.StatusServiceUnavailable},
+		},
+		{
+			ID:            "accepted",
+			Scenario:      "job",
+			RequiredState: "retried",
+			NewState:      "accepted",
+			Match:         Match{Method: "POST", Path: "/jobs"},
+			Response:      Response{Status: http.StatusAccepted},
+		},
+		{
+			ID:            "completed",
+			Scenario:      "job",
+			RequiredState: "accepted",
+			Match:         Match{Method: "GET", Path: "/jobs/*"},
+			Response:      Response{Body: `{"status":"completed"}`},
+		},
+		{
+			ID:       "pending",
+			Scenario: "job",
+			Match:    Match{Method: "GET", Path: "/jobs/*"},
+			Response: Response{Body: `{"status":"pending"}`},
+		},
+	}
+}
+
+func TestEngine_Scenario(t *testing.T) {
+	e := NewEngine()
+	if err := e.SetRules(retryScenario()); err != nil {
+		t.Fatal(err)
+	}
+	handler := e.Handler(fallback)
+
+	steps := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{method: "GET", path: "/jobs/1", status: http.StatusOK, body: `{"status":"pending"}`},
+		{method: "POST", path: "/jobs", status: http.StatusServiceUnavailable},
+		{method: "POST", path: "/jobs", status: http.StatusAccepted},
+		{method: "GET", path: "/jobs/1", status: http.StatusOK, body: `{"status":"completed"}`},
+		// No POST rule applies in the final state
+		{method: "POST", path: "/jobs", status: http.StatusTeapot},
+	}
+
+	for i, step := range steps {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(step.method, step.path, nil))
+		if rr.Code != step.status {
+			t.Fatalf("Step %d: expected status %d, got %d", i, step.status, rr.Code)
+		}
+		if step.body != "" && rr.Body.String() != step.body {
+			t.Fatalf("Step %d: expected body %s, got %s", i, step.body, rr.Body.String())
+		}
+	}
+
+	scenarios := e.Scenarios()
+	if len(scenarios) != 1 || scenarios[0].State != "accepted" {
+		t.Fatalf("Expected job scenario in state accepted, got %+v", scenarios)
+	}
+	expectedStates := []string{"Started", "accepted", "retried"}
+	if len(scenarios[0].States) != len(expectedStates) {
+		t.Fatalf("Expected states %v, got %v", expectedStates, scenarios[0].States)
+	}
+	for i, state := range expectedStates {
+		if scenarios[0].States[i] != state {
+			t.Errorf("Expected states %v, got %v", expectedStates, scenarios[0].States)
+		}
+	}
+
+	if err := e.ResetScenario("job"); err != nil {
+		t.Fatalf("ResetScenario failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/jobs", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected reset scenario to start over, got %d", rr.Code)
+	}
+}
+
+func TestEngine_ScenarioState(t *testing.T) {
+	e := NewEngine()
+	if err := e.SetRules(retryScenario()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.SetScenarioState("job", "accepted"); err != nil {
+		t.Fatalf("SetScenarioState failed: %v", err)
+	}
+	rule, ok := e.Match(httptest.NewRequest("GET", "/jobs/1", nil), nil)
+	if !ok || rule.ID != "completed" {
+		t.Errorf("Expected completed rule, got %q", rule.ID)
+	}
+
+	if err := e.SetScenarioState("missing", "x"); !errors.Is(err, ErrScenarioNotFound) {
+		t.Errorf("Expected ErrScenarioNotFound, got %v", err)
+	}
+
+	e.ResetScenarios()
+	if state := e.Scenarios()[0].State; state != StartedState {
+		t.Errorf("Expected state %s after reset, got %s", StartedState, state)
+	}
+
+	// Replacing the rules resets all scenarios
+	if err := e.SetScenarioState("job", "accepted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetRules(retryScenario()); err != nil {
+		t.Fatal(err)
+	}
+	if state := e.Scenarios()[0].State; state != StartedState {
+		t.Errorf("Expected state %s after replacing rules, got %s", StartedState, state)
+	}
+
+	if _, err := e.Add(Rule{NewState: "x"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Expected ErrInvalidRule for new state without scenario, got %v", err)
+	}
+}
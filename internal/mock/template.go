@@ -0,0 +1,130 @@
+package mock
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // offered as a template helper, not used for security
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData is the request data available to response templates
+type templateData struct {
+	Method string
+	Path   string
+	// Segments holds the non-empty path segments, e.g. ["users", "42"] for /users/42
+	Segments []string
+	Query    url.Values
+	Headers  http.Header
+	Host     string
+	Body     string
+	// JSON is the decoded request body, nil when the body is not JSON
+	JSON any
+}
+
+func newTemplateData(r *http.Request, body []byte) templateData {
+	data := templateData{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Segments: pathSegments(r.URL.Path),
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		Host:     r.Host,
+		Body:     string(body),
+	}
+	if len(body) > 0 {
+		var doc any
+		if err := json.Unmarshal(body, &doc); err == nil {
+			data.JSON = doc
+		}
+	}
+	return data
+}
+
+func pathSegments(path string) []string {
+	segments := []string{}
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// templateFuncs are the helper functions available to response templates
+var templateFuncs = template.FuncMap{
+	"uuid":      newUUID,
+	"now":       func() time.Time { return time.Now().UTC() },
+	"timestamp": func() int64 { return time.Now().Unix() },
+	"randomInt": randomInt,
+	"randomString": func(n int) string {
+		const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, max(n, 0))
+		for i := range b {
+			b[i] = alphabet[mathrand.IntN(len(alphabet))] //nolint:gosec // not used for security
+		}
+		return string(b)
+	},
+	"sha256": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+	"md5": func(s string) string {
+		sum := md5.Sum([]byte(s)) //nolint:gosec // offered as a template helper, not used for security
+		return hex.EncodeToString(sum[:])
+	},
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"base64Decode": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+	"jsonPath": func(doc any, path string) any {
+		v, _ := LookupJSON(doc, path)
+		return v
+	},
+	"toJSON": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate parses a response template with the helper functions
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func renderTemplate(tmpl *template.Template, data templateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomInt returns a random integer in [minimum, maximum]
+func randomInt(minimum, maximum int) (int, error) {
+	if maximum < minimum {
+		return 0, fmt.Errorf("randomInt: max %d is less than min %d", maximum, minimum)
+	}
+	return minimum + mathrand.IntN(maximum-minimum+1), nil //nolint:gosec // not used for security
+}
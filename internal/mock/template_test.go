@@ -0,0 +1,129 @@
+package mock
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "path segment", body: `{{index .Segments 1}}`, expected: "42"},
+		{name: "query", body: `{{.Query.Get "expand"}}`, expected: "items"},
+		{name: "header", body: `{{.Headers.Get "X-Request-Id"}}`, expected: "req-1"},
+		{name: "json field", body: `{{.JSON.order.id}}`, expected: "ord_1"},
+		{name: "json path", body: `{{jsonPath .JSON "$.order.items[0].sku"}}`, expected: "A-1"},
+		{name: "json encode", body: `{{toJSON .JSON.order.items}}`, expected: `[{"sku":"A-1"}]`},
+		{name: "method", body: `{{.Method}} {{.Path}}`, expected: "POST /users/42"},
+		{name: "sha256", body: `{{sha256 "raccoon"}}`, expected: "715c0446492292bdac4fd7448b985fd1d081d4181172095059ab7a4371f9221e"},
+		{name: "md5", body: `{{md5 "raccoon"}}`, expected: "3f5b31f8506cfb9a606553978da02d9f"},
+		{name: "base64", body: `{{base64 "raccoon"}}`, expected: "cmFjY29vbg=="},
+		{name: "base64 decode", body: `{{base64Decode "cmFjY29vbg=="}}`, expected: "raccoon"},
+		{name: "random int", body: `{{randomInt 7 7}}`, expected: "7"},
+		{name: "random string", body: `{{len (randomString 12)}}`, expected: "12"},
+	}
+
+	body := []byte(`{"order":{"id":"ord_1","items":[{"sku":"A-1"}]}}`)
+	req := httptest.NewRequest("POST", "/users/42?expand=items", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	data := newTemplateData(req, body)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate("body", tt.body)
+			if err != nil {
+				t.Fatalf("parseTemplate failed: %v", err)
+			}
+			got, err := renderTemplate(tmpl, data)
+			if err != nil {
+				t.Fatalf("renderTemplate failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTemplate_Helpers(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if id := newUUID(); !uuidPattern.MatchString(id) {
+		t.Errorf("Expected a version 4 UUID, got %s", id)
+	}
+	if newUUID() == newUUID() {
+		t.Error("Expected distinct UUIDs")
+	}
+
+	if _, err := randomInt(5, 1); err == nil {
+		t.Error("Expected error for max below min")
+	}
+
+	tmpl, err := parseTemplate("now", `{{(now).Year}} {{timestamp}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderTemplate(tmpl, templateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\d{4} \d{10}$`).Match(got) {
+		t.Errorf("Unexpected time output %q", got)
+	}
+}
+
+func TestEngine_TemplateResponse(t *testing.T) {
+	e := NewEngine()
+	err := e.SetRules([]Rule{{
+		ID:    "echo",
+		Match: Match{Path: "/orders/*"},
+		Response: Response{
+			Status:   http.StatusCreated,
+			Headers:  map[string]string{"Location": "/orders/{{index .Segments 1}}"},
+			Body:     `{"id":"{{index .Segments 1}}","customer":"{{.JSON.customer}}"}`,
+			Template: true,
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	e.Handler(fallback).ServeHTTP(rr, httptest.NewRequest("PUT", "/orders/o-7", strings.NewReader(`{"customer":"c-1"}`)))
+	if rr.Body.String() != `{"id":"o-7","customer":"c-1"}` {
+		t.Errorf("Unexpected body %s", rr.Body.String())
+	}
+	if rr.Header().Get("Location") != "/orders/o-7" {
+		t.Errorf("Unexpected Location header %q", rr.Header().Get("Location"))
+	}
+
+	// Execution errors answer 500 instead of a partial body
+	if _, err := e.Update("echo", Rule{Response: Response{Body: `{{index .Segments 5}}`, Template: true}}); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	e.Handler(fallback).ServeHTTP(rr, httptest.NewRequest("GET", "/orders/o-7", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+
+	// Templates are only rendered when enabled
+	if _, err := e.Update("echo", Rule{Response: Response{Body: `{{.Path}}`}}); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	e.Handler(fallback).ServeHTTP(rr, httptest.NewRequest("GET", "/orders/o-7", nil))
+	if rr.Body.String() != `{{.Path}}` {
+		t.Errorf("Expected literal body, got %s", rr.Body.String())
+	}
+
+	if _, err := e.Add(Rule{Response: Response{Body: `{{.Path`, Template: true}}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Expected ErrInvalidRule for malformed template, got %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// ErrDeadLetterNotFound is returned when no dead letter has the given request ID
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a forwarded request the upstream did not accept after all retries.
+type DeadLetter struct {
+	ID      string                 `json:"id"`
+	Request *store.CapturedRequest `json:"request"`
+	// Attempts counts every delivery attempt, including retries and redrives
+	Attempts int       `json:"attempts"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// RedriveResult is the outcome of sending a dead letter to the upstream again.
+type RedriveResult struct {
+	ID        string `json:"id"`
+	Delivered bool   `json:"delivered"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// deadLetters keeps failed deliveries in a store, so they survive restarts with a disk store.
+// The captured requests are stored as copies whose upstream records the last failed attempt.
+type deadLetters struct {
+	// mu serializes changes, so that drops are counted and attempts are not lost
+	mu      sync.Mutex
+	store   store.Store
+	dropped atomic.Int64
+}
+
+func newDeadLetters(st store.Store, size int) *deadLetters {
+	if st == nil {
+		st = store.NewMemory(size, 0)
+	}
+	return &deadLetters{store: st}
+}
+
+func (d *deadLetters) add(rec *store.CapturedRequest) {
+	captured := *rec
+	upstream := *rec.Upstream
+	captured.Upstream = &upstream
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	before := d.store.Len()
+	if err := d.store.Add(&captured); err != nil {
+		slog.Error("Failed to park failed delivery as dead letter", "request_id", rec.ID, "error", err)
+		return
+	}
+	if dropped := before + 1 - d.store.Len(); dropped > 0 {
+		d.dropped.Add(int64(dropped))
+		slog.Warn("Dead letter list full, dropped oldest", "dropped", dropped)
+	}
+	slog.Warn("Parked failed delivery as dead letter",
+		"request_id", rec.ID,
+		"attempts", upstream.Attempts,
+		"status", upstream.Status,
+		"error", upstream.Error)
+}
+
+// list returns all dead letters, oldest first
+func (d *deadLetters) list() ([]DeadLetter, error) {
+	requests, err := d.store.List(store.Filter{})
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(requests))
+	for _, req := range slices.Backward(requests) {
+		letters = append(letters, newDeadLetter(req))
+	}
+	return letters, nil
+}
+
+func (d *deadLetters) get(id string) (DeadLetter, error) {
+	req, err := d.store.Get(id)
+	if errors.Is(err, store.ErrNotFound) {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	return newDeadLetter(req), nil
+}
+
+func (d *deadLetters) remove(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.store.Delete(id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrDeadLetterNotFound
+	}
+	return err
+}
+
+// failed records another unsuccessful delivery attempt
+func (d *deadLetters) failed(id string, status int, message string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	req, err := d.store.Get(id)
+	if err != nil {
+		return err
+	}
+	captured := *req
+	upstream := store.Upstream{}
+	if req.Upstream != nil {
+		upstream = *req.Upstream
+	}
+	upstream.Attempts++
+	upstream.Status = status
+	upstream.Error = message
+	upstream.FailedAt = time.Now()
+	captured.Upstream = &upstream
+	return d.store.Update(&captured)
+}
+
+// newDeadLetter presents a stored request as a dead letter
+func newDeadLetter(req *store.CapturedRequest) DeadLetter {
+	letter := DeadLetter{ID: req.ID, Request: req}
+	if req.Upstream != nil {
+		letter.Attempts = req.Upstream.Attempts
+		letter.Status = req.Upstream.Status
+		letter.Error = req.Upstream.Error
+		letter.FailedAt = req.Upstream.FailedAt
+	}
+	return letter
+}
+
+// DeadLetters returns the parked failed deliveries, oldest first.
+func (p *Proxy) DeadLetters() ([]DeadLetter, error) {
+	return p.deadLetters.list()
+}
+
+// DroppedDeadLetters returns how many dead letters were dropped since start to keep the list within its limits.
+func (p *Proxy) DroppedDeadLetters() int64 {
+	return p.deadLetters.dropped.Load()
+}
+
+// Redrive sends a dead letter to the upstream again, once. It is removed when the upstream accepts it.
+// Dead letters with a truncated body are refused with mirror.ErrTruncated without being sent.
+func (p *Proxy) Redrive(ctx context.Context, id string) (RedriveResult, error) {
+	letter, err := p.deadLetters.get(id)
+	if err != nil {
+		return RedriveResult{}, err
+	}
+	if letter.Request.BodyTruncated {
+		return RedriveResult{}, fmt.Errorf("%w: %d of %d bytes kept",
+			mirror.ErrTruncated, len(letter.Request.Body), letter.Request.BodySize)
+	}
+
+	// Rewrite rules apply like they did when the request was forwarded
+	captured := *letter.Request
+	u := &url.URL{Path: captured.Path}
+	captured.Headers = captured.Headers.Clone()
+	if captured.Headers == nil {
+		captured.Headers = make(http.Header)
+	}
+	rewrites := p.rewrites.Match(captured.Method, captured.Path, letter.Request.Headers)
+	host := rewrites.Request(u, captured.Headers)
+	captured.Path = u.Path
+
+	req, err := mirror.NewRequest(ctx, p.target, &captured)
+	if err != nil {
+		return RedriveResult{}, err
+	}
+	if host != "" {
+		req.Host = host
+	}
+
+	result := RedriveResult{ID: id}
+	resp, err := p.client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBody))
+		resp.Body.Close()
+		result.Status = resp.StatusCode
+		if p.transport.retryable(resp.StatusCode) {
+			err = fmt.Errorf("upstream answered %d", resp.StatusCode)
+		}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		if recordErr := p.deadLetters.failed(id, result.Status, result.Error); recordErr != nil {
+			slog.Error("Failed to record dead letter attempt", "request_id", id, "error", recordErr)
+		}
+		slog.Warn("Dead letter redrive failed", "request_id", id, "status", result.Status, "error", err)
+		return result, nil
+	}
+
+	result.Delivered = true
+	if err = p.deadLetters.remove(id); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+		slog.Error("Failed to remove redriven dead letter", "request_id", id, "error", err)
+	}
+	slog.Info("Redrove dead letter", "request_id", id, "status", result.Status)
+	return result, nil
+}
+
+// ListDeadLetters returns a page of dead letters, oldest first, with the number dropped since start.
+func (p *Proxy) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := api.ParsePage(r)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	letters, err := p.deadLetters.list()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	total := len(letters)
+	page := letters[min(offset, total):min(offset+limit, total)]
+	raw := isRaw(r)
+	for i := range page {
+		page[i] = present(page[i], raw)
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"dead_letters": page,
+		"total":        total,
+		"dropped":      p.DroppedDeadLetters(),
+		"offset":       offset,
+		"limit":        limit,
+	})
+}
+
+// GetDeadLetter returns a single dead letter.
+func (p *Proxy) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	letter, err := p.deadLetters.get(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrDeadLetterNotFound):
+		api.WriteError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+	default:
+		api.WriteJSON(w, http.StatusOK, present(letter, isRaw(r)))
+	}
+}
+
+// DeleteDeadLetter discards a dead letter without delivering it.
+func (p *Proxy) DeleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	err := p.deadLetters.remove(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrDeadLetterNotFound):
+		api.WriteError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RedriveDeadLetter sends a dead letter to the upstream again, answering 502 when it still fails
+// and 422 when its body was truncated.
+func (p *Proxy) RedriveDeadLetter(w http.ResponseWriter, r *http.Request) {
+	result, err := p.Redrive(r.Context(), r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrDeadLetterNotFound):
+		api.WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, mirror.ErrTruncated):
+		api.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+	case !result.Delivered:
+		api.WriteJSON(w, http.StatusBadGateway, result)
+	default:
+		api.WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// RedriveDeadLetters sends all dead letters to the upstream again, oldest first.
+func (p *Proxy) RedriveDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := p.deadLetters.list()
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := make([]RedriveResult, 0)
+	delivered := 0
+	for _, letter := range letters {
+		if r.Context().Err() != nil {
+			break
+		}
+		result, err := p.Redrive(r.Context(), letter.ID)
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			// Redriven or deleted concurrently
+			continue
+		}
+		if err != nil {
+			result = RedriveResult{ID: letter.ID, Error: err.Error()}
+		}
+		if result.Delivered {
+			delivered++
+		}
+		results = append(results, result)
+	}
+
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"delivered": delivered,
+		"failed":    len(results) - delivered,
+		"results":   results,
+	})
+}
+
+// present redacts the sensitive headers of a dead letter unless raw output was requested
+func present(letter DeadLetter, raw bool) DeadLetter {
+	if !raw {
+		letter.Request = letter.Request.Redacted()
+	}
+	return letter
+}
+
+func isRaw(r *http.Request) bool {
+	raw, _ := strconv.ParseBool(r.URL.Query().Get("raw"))
+	return raw
+}
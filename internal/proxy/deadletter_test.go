@@ -0,0 +1,426 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/rewrite"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// forward serves req with the captured request the middleware would record
+func forward(p *Proxy, id string, req *http.Request) (*httptest.ResponseRecorder, *store.CapturedRequest) {
+	body, _ := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	rec := &store.CapturedRequest{
+		ID:      id,
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Query:   req.URL.RawQuery,
+		Headers: req.Header.Clone(),
+		Body:    body,
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req.WithContext(store.NewContext(req.Context(), rec)))
+	return rr, rec
+}
+
+// flakyUpstream fails with 503 while down is set and records the bodies it accepted
+type flakyUpstream struct {
+	down     atomic.Bool
+	calls    atomic.Int32
+	mu       sync.Mutex
+	accepted []string
+	ids      []string
+}
+
+func (f *flakyUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	if f.down.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	f.mu.Lock()
+	f.accepted = append(f.accepted, string(body))
+	f.ids = append(f.ids, r.Header.Get("X-Raccoon-Request-Id"))
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newFlakyProxy(t *testing.T, retries int) (*Proxy, *flakyUpstream) {
+	t.Helper()
+
+	upstream := &flakyUpstream{}
+	srv := newUpstream(t, upstream.ServeHTTP)
+	p, err := New(srv.URL, Options{Timeout: time.Second, Retries: retries, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return p, upstream
+}
+
+func listDeadLetters(t *testing.T, p *Proxy) []DeadLetter {
+	t.Helper()
+
+	letters, err := p.DeadLetters()
+	if err != nil {
+		t.Fatalf("DeadLetters failed: %v", err)
+	}
+	return letters
+}
+
+func TestProxy_RetriesUntilUpstreamRecovers(t *testing.T) {
+	var calls atomic.Int32
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write(body)
+	})
+
+	p, err := New(upstream.URL, Options{Timeout: time.Second, Retries: 3, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	rr, rec := serveCaptured(p, httptest.NewRequest("POST", "/hooks", strings.NewReader(`{"event":"paid"}`)))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"event":"paid"}` {
+		t.Fatalf("Expected the body to be sent again, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rec.Upstream.Attempts != 3 || rec.Upstream.Status != http.StatusOK {
+		t.Errorf("Expected 3 attempts, got %+v", rec.Upstream)
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestProxy_RetriesConnectionErrors(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	p, err := New(closed.URL, Options{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	rr, rec := serveCaptured(p, httptest.NewRequest("POST", "/hooks", strings.NewReader("payload")))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", rr.Code)
+	}
+	if rec.Upstream.Attempts != 3 || rec.Upstream.Error == "" {
+		t.Errorf("Expected 3 failed attempts, got %+v", rec.Upstream)
+	}
+
+	letters := listDeadLetters(t, p)
+	if len(letters) != 1 || letters[0].ID != "1" || letters[0].Attempts != 3 || letters[0].Error == "" {
+		t.Fatalf("Expected a dead letter after 3 attempts, got %+v", letters)
+	}
+}
+
+func TestProxy_DoesNotRetryOtherStatuses(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 3)
+	p.transport.statuses = []int{http.StatusBadGateway}
+	upstream.down.Store(true)
+
+	rr, rec := serveCaptured(p, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable || upstream.calls.Load() != 1 || rec.Upstream.Attempts != 1 {
+		t.Errorf("Expected a single attempt, got %d after %d calls", rr.Code, upstream.calls.Load())
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestProxy_DeadLettersWithoutRetries(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 0)
+	upstream.down.Store(true)
+
+	rr, rec := forward(p, "a", httptest.NewRequest("POST", "/hooks", strings.NewReader("a")))
+	if rr.Code != http.StatusServiceUnavailable || rec.Upstream.Attempts != 1 {
+		t.Errorf("Expected a single failed attempt, got %d after %d attempts", rr.Code, rec.Upstream.Attempts)
+	}
+	letters := listDeadLetters(t, p)
+	if len(letters) != 1 || letters[0].ID != "a" || letters[0].Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the failed delivery to be parked without retries, got %+v", letters)
+	}
+}
+
+func TestProxy_RetriesLargeBodiesWithGetBody(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 1)
+	upstream.down.Store(true)
+	body := strings.Repeat("a", maxRetryBody+1)
+
+	// Without GetBody a large body is streamed once instead of being buffered for retries
+	rr, rec := serveCaptured(p, httptest.NewRequest("POST", "/hooks", strings.NewReader(body)))
+	if rr.Code != http.StatusServiceUnavailable || rec.Upstream.Attempts != 1 || upstream.calls.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d after %d attempts", rr.Code, rec.Upstream.Attempts)
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 1 {
+		t.Errorf("Expected a dead letter after the only attempt, got %d", len(letters))
+	}
+
+	// The logging middleware provides GetBody over the spooled body
+	var reads atomic.Int32
+	req := httptest.NewRequest("POST", "/hooks", strings.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		reads.Add(1)
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	rr, rec = serveCaptured(p, req)
+	if rr.Code != http.StatusServiceUnavailable || rec.Upstream.Attempts != 2 || reads.Load() != 1 {
+		t.Errorf("Expected a retry reading the body through GetBody, got %d after %d attempts and %d reads", rr.Code, rec.Upstream.Attempts, reads.Load())
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 2 {
+		t.Errorf("Expected a dead letter after the retry, got %d", len(letters))
+	}
+}
+
+func TestProxy_RedriveDeadLetter(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 1)
+	upstream.down.Store(true)
+
+	req := httptest.NewRequest("POST", "/hooks", strings.NewReader("payload"))
+	req.Header.Set("Authorization", "Bearer secret")
+	rr, rec := forward(p, "1", req)
+	if rr.Code != http.StatusServiceUnavailable || rec.Upstream.Attempts != 2 {
+		t.Fatalf("Expected the upstream status after 2 attempts, got %d %+v", rr.Code, rec.Upstream)
+	}
+
+	// Listing redacts sensitive headers
+	rr = httptest.NewRecorder()
+	p.ListDeadLetters(rr, httptest.NewRequest("GET", "/_raccoon/api/deadletters", nil))
+	var page struct {
+		DeadLetters []DeadLetter `json:"dead_letters"`
+		Total       int          `json:"total"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if page.Total != 1 || page.DeadLetters[0].Status != http.StatusServiceUnavailable || page.DeadLetters[0].Attempts != 2 {
+		t.Fatalf("Unexpected dead letters %+v", page)
+	}
+	if auth := page.DeadLetters[0].Request.Headers.Get("Authorization"); auth == "Bearer secret" {
+		t.Error("Expected the Authorization header to be redacted")
+	}
+
+	// Still failing keeps the dead letter
+	rr = httptest.NewRecorder()
+	redrive := httptest.NewRequest("POST", "/_raccoon/api/deadletters/1/redrive", nil)
+	redrive.SetPathValue("id", "1")
+	p.RedriveDeadLetter(rr, redrive)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 while the upstream is down, got %d", rr.Code)
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 1 || letters[0].Attempts != 3 {
+		t.Fatalf("Expected the dead letter to stay with 3 attempts, got %+v", letters)
+	}
+
+	upstream.down.Store(false)
+	rr = httptest.NewRecorder()
+	p.RedriveDeadLetter(rr, redrive)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"delivered":true`) {
+		t.Errorf("Expected the redrive to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+	if len(upstream.accepted) != 1 || upstream.accepted[0] != "payload" || upstream.ids[0] != "1" {
+		t.Errorf("Expected the original body and request ID, got %q %q", upstream.accepted, upstream.ids)
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 0 {
+		t.Errorf("Expected the dead letter to be removed, got %d", len(letters))
+	}
+
+	rr = httptest.NewRecorder()
+	p.RedriveDeadLetter(rr, redrive)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a redriven dead letter, got %d", rr.Code)
+	}
+}
+
+func TestProxy_RedriveAllAndDelete(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 1)
+	upstream.down.Store(true)
+
+	for _, id := range []string{"a", "b", "c"} {
+		forward(p, id, httptest.NewRequest("POST", "/hooks", strings.NewReader(id)))
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 3 || letters[0].ID != "a" {
+		t.Fatalf("Expected 3 dead letters oldest first, got %+v", letters)
+	}
+
+	rr := httptest.NewRecorder()
+	del := httptest.NewRequest("DELETE", "/_raccoon/api/deadletters/b", nil)
+	del.SetPathValue("id", "b")
+	p.DeleteDeadLetter(rr, del)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rr.Code)
+	}
+
+	upstream.down.Store(false)
+	rr = httptest.NewRecorder()
+	p.RedriveDeadLetters(rr, httptest.NewRequest("POST", "/_raccoon/api/deadletters/redrive", nil))
+	var summary struct {
+		Delivered int             `json:"delivered"`
+		Failed    int             `json:"failed"`
+		Results   []RedriveResult `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&summary); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if summary.Delivered != 2 || summary.Failed != 0 || summary.Results[0].ID != "a" || summary.Results[1].ID != "c" {
+		t.Errorf("Unexpected redrive summary %+v", summary)
+	}
+	if len(upstream.accepted) != 2 || upstream.accepted[0] != "a" || upstream.accepted[1] != "c" {
+		t.Errorf("Expected a and c to be delivered in order, got %q", upstream.accepted)
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestDeadLetters_DropsOldest(t *testing.T) {
+	upstream := &flakyUpstream{}
+	upstream.down.Store(true)
+	p, err := New(newUpstream(t, upstream.ServeHTTP).URL, Options{Timeout: time.Second, DeadLetterSize: 2})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		forward(p, id, httptest.NewRequest("GET", "/", nil))
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 2 || letters[0].ID != "b" || letters[1].ID != "c" {
+		t.Errorf("Expected b and c, got %+v", letters)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ListDeadLetters(rr, httptest.NewRequest("GET", "/_raccoon/api/deadletters", nil))
+	if !strings.Contains(rr.Body.String(), `"dropped":1`) {
+		t.Errorf("Expected the dropped dead letter to be counted, got %s", rr.Body.String())
+	}
+}
+
+func TestDeadLetters_Persisted(t *testing.T) {
+	dir := t.TempDir()
+	upstream := &flakyUpstream{}
+	upstream.down.Store(true)
+	srv := newUpstream(t, upstream.ServeHTTP)
+
+	open := func() (*Proxy, *store.Disk) {
+		st, err := store.NewDisk(dir, store.DiskOptions{})
+		if err != nil {
+			t.Fatalf("NewDisk failed: %v", err)
+		}
+		p, err := New(srv.URL, Options{Timeout: time.Second, DeadLetters: st})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		return p, st
+	}
+
+	p, st := open()
+	forward(p, "a", httptest.NewRequest("POST", "/hooks", strings.NewReader("payload")))
+	if result, err := p.Redrive(context.Background(), "a"); err != nil || result.Delivered {
+		t.Fatalf("Expected the redrive to fail, got %+v %v", result, err)
+	}
+	st.Close()
+
+	// Dead letters and their attempts survive a restart
+	p, st = open()
+	defer st.Close()
+	letters := listDeadLetters(t, p)
+	if len(letters) != 1 || letters[0].ID != "a" || letters[0].Attempts != 2 || letters[0].FailedAt.IsZero() {
+		t.Fatalf("Expected the dead letter to be kept, got %+v", letters)
+	}
+
+	upstream.down.Store(false)
+	if result, err := p.Redrive(context.Background(), "a"); err != nil || !result.Delivered {
+		t.Fatalf("Expected the redrive to succeed, got %+v %v", result, err)
+	}
+	if len(upstream.accepted) != 1 || upstream.accepted[0] != "payload" {
+		t.Errorf("Expected the original body, got %q", upstream.accepted)
+	}
+}
+
+func TestProxy_RedriveTruncated(t *testing.T) {
+	p, upstream := newFlakyProxy(t, 0)
+	upstream.down.Store(true)
+
+	req := httptest.NewRequest("POST", "/hooks", strings.NewReader("payload"))
+	rec := &store.CapturedRequest{ID: "a", Method: "POST", Path: "/hooks", Body: []byte("pay"), BodySize: 7, BodyTruncated: true}
+	p.ServeHTTP(httptest.NewRecorder(), req.WithContext(store.NewContext(req.Context(), rec)))
+	upstream.down.Store(false)
+	calls := upstream.calls.Load()
+
+	rr := httptest.NewRecorder()
+	redrive := httptest.NewRequest("POST", "/_raccoon/api/deadletters/a/redrive", nil)
+	redrive.SetPathValue("id", "a")
+	p.RedriveDeadLetter(rr, redrive)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a truncated body, got %d", rr.Code)
+	}
+	if upstream.calls.Load() != calls {
+		t.Error("Expected the truncated body not to be sent")
+	}
+	if letters := listDeadLetters(t, p); len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("Expected the dead letter to stay without another attempt, got %+v", letters)
+	}
+}
+
+func TestRetryTransport_Delay(t *testing.T) {
+	tr := &retryTransport{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for range 20 {
+			if d := tr.delay(attempt); d < limit/2 || d > limit {
+				t.Errorf("Expected the delay of attempt %d within [%v, %v], got %v", attempt, limit/2, limit, d)
+			}
+		}
+	}
+}
+
+func TestProxy_RedriveAppliesRewrites(t *testing.T) {
+	var path atomic.Value
+	var down atomic.Bool
+	down.Store(true)
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		path.Store(r.URL.Path + " " + r.Host)
+	})
+
+	rules, err := rewrite.New([]rewrite.Rule{{
+		Request: rewrite.Request{Path: &rewrite.Path{Regex: "^/webhooks", Replacement: "/hooks"}, Host: "hooks.internal"},
+	}})
+	if err != nil {
+		t.Fatalf("rewrite.New failed: %v", err)
+	}
+	p, err := New(upstream.URL, Options{Timeout: time.Second, Retries: 1, Backoff: time.Millisecond, Rewrites: rules})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	forward(p, "1", httptest.NewRequest("POST", "/webhooks/github", nil))
+	down.Store(false)
+	if result, err := p.Redrive(context.Background(), "1"); err != nil || !result.Delivered {
+		t.Fatalf("Expected the redrive to succeed, got %+v %v", result, err)
+	}
+	if got, _ := path.Load().(string); got != "/hooks/github hooks.internal" {
+		t.Errorf("Expected the rewritten path and host, got %q", got)
+	}
+}
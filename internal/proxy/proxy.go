@@ -0,0 +1,253 @@
+// Package proxy forwards captured requests to an upstream server and records its response.
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/rewrite"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// MaxCaptureBody is the largest upstream response body kept on the captured request.
+// Larger bodies are still relayed in full.
+const MaxCaptureBody = 1 << 20
+
+// maxRetryBody is the largest request body buffered for retries when the request cannot provide it again.
+// Larger bodies are sent once.
+const maxRetryBody = 1 << 20
+
+// Defaults applied by New for unset options
+const (
+	DefaultBackoff        = 500 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultDeadLetterSize = 1000
+)
+
+// DefaultRetryStatuses are the upstream statuses retried when no others are configured
+var DefaultRetryStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Options configures a proxy.
+type Options struct {
+	// Timeout bounds the wait for upstream response headers of each attempt, zero disables it
+	Timeout time.Duration
+	// Retries is how often a request is sent again after an error or a retryable status
+	Retries int
+	// RetryStatuses are the upstream statuses that are retried
+	RetryStatuses []int
+	// Backoff is the delay before the first retry, doubled for every further one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// DeadLetterSize is the number of failed deliveries kept, the oldest is dropped when full
+	DeadLetterSize int
+	// DeadLetters keeps the failed deliveries, a memory store of DeadLetterSize requests when nil.
+	// The proxy does not close it.
+	DeadLetters store.Store
+	// Rewrites change forwarded requests and the upstream responses to them
+	Rewrites *rewrite.Rules
+}
+
+// Proxy is a reverse proxy to a single upstream.
+type Proxy struct {
+	target      *url.URL
+	reverse     *httputil.ReverseProxy
+	transport   *retryTransport
+	client      *http.Client
+	deadLetters *deadLetters
+	rewrites    *rewrite.Rules
+}
+
+// New creates a proxy forwarding to the target URL. The target path is prepended to request paths.
+func New(target string, opts Options) (*Proxy, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("parse upstream URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("upstream URL %q must be an absolute http or https URL", target)
+	}
+
+	if opts.RetryStatuses == nil {
+		opts.RetryStatuses = DefaultRetryStatuses
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+	if opts.MaxBackoff < opts.Backoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.Backoff)
+	}
+	if opts.DeadLetterSize <= 0 {
+		opts.DeadLetterSize = DefaultDeadLetterSize
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // always a *http.Transport
+	transport.ResponseHeaderTimeout = opts.Timeout
+
+	p := &Proxy{
+		target: u,
+		transport: &retryTransport{
+			base:       transport,
+			retries:    max(opts.Retries, 0),
+			statuses:   opts.RetryStatuses,
+			backoff:    opts.Backoff,
+			maxBackoff: opts.MaxBackoff,
+		},
+		client: &http.Client{
+			Transport: transport,
+			// Redirects are relayed like by the reverse proxy instead of followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		deadLetters: newDeadLetters(opts.DeadLetters, opts.DeadLetterSize),
+		rewrites:    opts.Rewrites,
+	}
+	p.reverse = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// Rules match the request as received, the path is rewritten before the upstream path is prepended
+			rewrites := p.rewrites.Match(pr.In.Method, pr.In.URL.Path, pr.In.Header)
+			host := rewrites.Request(pr.Out.URL, pr.Out.Header)
+			pr.SetURL(u)
+			pr.SetXForwarded()
+			if host != "" {
+				pr.Out.Host = host
+			}
+			if len(rewrites) > 0 {
+				pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), rewritesKey{}, rewrites))
+			}
+			if c, ok := pr.In.Context().Value(exchangeKey{}).(*exchange); ok {
+				c.upstream.URL = pr.Out.URL.String()
+			}
+		},
+		Transport:      p.transport,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+	}
+	return p, nil
+}
+
+// Target returns the upstream URL.
+func (p *Proxy) Target() *url.URL {
+	return p.target
+}
+
+// ServeHTTP forwards the request to the upstream and records the exchange on the captured request.
+// Requests whose last attempt still fails are parked as dead letters, also when no retries are configured.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.transport.retries > 0 && r.GetBody == nil && r.Body != nil && r.Body != http.NoBody {
+		// Keep small bodies so that retries can send them again, the logging middleware provides GetBody for
+		// spooled ones
+		head, err := io.ReadAll(io.LimitReader(r.Body, maxRetryBody+1))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if len(head) <= maxRetryBody {
+			r.Body = io.NopCloser(bytes.NewReader(head))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(head)), nil
+			}
+		} else {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		}
+	}
+
+	rec := store.FromContext(r.Context())
+	if rec == nil {
+		p.reverse.ServeHTTP(w, r)
+		return
+	}
+
+	c := &exchange{
+		upstream: &store.Upstream{URL: p.target.String()},
+		start:    time.Now(),
+	}
+	p.reverse.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), exchangeKey{}, c)))
+
+	if c.body != nil {
+		c.upstream.Body = c.body.buf
+		c.upstream.BodyTruncated = c.body.truncated
+	}
+	rec.Upstream = c.upstream
+
+	if c.upstream.Error != "" || p.transport.retryable(c.upstream.Status) {
+		c.upstream.FailedAt = time.Now()
+		p.deadLetters.add(rec)
+	}
+}
+
+// exchange collects what the upstream answered while the response is relayed
+type exchange struct {
+	upstream *store.Upstream
+	start    time.Time
+	body     *captureReader
+}
+
+type exchangeKey struct{}
+
+// rewritesKey holds the rewrites matching a forwarded request, applied to its response
+type rewritesKey struct{}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	// The exchange records the response as the upstream sent it
+	if c, ok := resp.Request.Context().Value(exchangeKey{}).(*exchange); ok {
+		c.upstream.Latency = time.Since(c.start)
+		c.upstream.Status = resp.StatusCode
+		c.upstream.Headers = resp.Header.Clone()
+		c.body = &captureReader{ReadCloser: resp.Body, limit: MaxCaptureBody}
+		resp.Body = c.body
+	}
+
+	if rewrites, ok := resp.Request.Context().Value(rewritesKey{}).(rewrite.Rewrites); ok {
+		rewrites.Response(resp.Header)
+	}
+	return nil
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		status = http.StatusGatewayTimeout
+	}
+
+	if c, ok := r.Context().Value(exchangeKey{}).(*exchange); ok {
+		c.upstream.Latency = time.Since(c.start)
+		c.upstream.Error = err.Error()
+	}
+
+	slog.Error("Upstream request failed", "error", err, "upstream", p.target.String(), "path", r.URL.Path)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// captureReader keeps a copy of the first limit bytes read through it
+type captureReader struct {
+	io.ReadCloser
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (c *captureReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		keep := min(n, c.limit-len(c.buf))
+		c.buf = append(c.buf, p[:keep]...)
+		if keep < n {
+			c.truncated = true
+		}
+	}
+	return n, err
+}
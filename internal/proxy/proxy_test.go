@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/rewrite"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func newUpstream(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func serveCaptured(p *Proxy, req *http.Request) (*httptest.ResponseRecorder, *store.CapturedRequest) {
+	rec := &store.CapturedRequest{ID: "1"}
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req.WithContext(store.NewContext(req.Context(), rec)))
+	return rr, rec
+}
+
+func TestProxy_Forward(t *testing.T) {
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Query", r.URL.RawQuery)
+		w.Header().Set("X-Forwarded-For-Seen", r.Header.Get("X-Forwarded-For"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("echo:" + string(body)))
+	})
+
+	p, err := New(upstream.URL+"/base", Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/orders?expand=items", strings.NewReader("hello"))
+	rr, rec := serveCaptured(p, req)
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != "echo:hello" {
+		t.Fatalf("Expected relayed upstream response, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Upstream-Path") != "/base/orders" || rr.Header().Get("X-Upstream-Query") != "expand=items" {
+		t.Errorf("Unexpected upstream URL %s?%s", rr.Header().Get("X-Upstream-Path"), rr.Header().Get("X-Upstream-Query"))
+	}
+	if rr.Header().Get("X-Forwarded-For-Seen") == "" {
+		t.Error("Expected X-Forwarded-For to be set")
+	}
+
+	up := rec.Upstream
+	if up == nil {
+		t.Fatal("Expected upstream exchange to be recorded")
+	}
+	if up.URL != upstream.URL+"/base/orders?expand=items" {
+		t.Errorf("Unexpected upstream URL %s", up.URL)
+	}
+	if up.Status != http.StatusCreated || string(up.Body) != "echo:hello" || up.BodyTruncated {
+		t.Errorf("Unexpected upstream record %+v", up)
+	}
+	if up.Headers.Get("X-Upstream-Path") != "/base/orders" {
+		t.Errorf("Expected upstream headers to be recorded, got %v", up.Headers)
+	}
+	if up.Latency <= 0 {
+		t.Errorf("Expected positive latency, got %v", up.Latency)
+	}
+}
+
+func TestProxy_TruncatesCapturedBody(t *testing.T) {
+	large := strings.Repeat("x", MaxCaptureBody+10)
+	upstream := newUpstream(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, large)
+	})
+
+	p, err := New(upstream.URL, Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, rec := serveCaptured(p, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Body.Len() != len(large) {
+		t.Errorf("Expected full body to be relayed, got %d bytes", rr.Body.Len())
+	}
+	if len(rec.Upstream.Body) != MaxCaptureBody || !rec.Upstream.BodyTruncated {
+		t.Errorf("Expected captured body truncated to %d bytes, got %d", MaxCaptureBody, len(rec.Upstream.Body))
+	}
+}
+
+func TestProxy_Errors(t *testing.T) {
+	slow := newUpstream(t, func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	p, err := New(slow.URL, Options{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, rec := serveCaptured(p, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, rr.Code)
+	}
+	if rec.Upstream == nil || rec.Upstream.Error == "" {
+		t.Errorf("Expected upstream error to be recorded, got %+v", rec.Upstream)
+	}
+
+	// Nothing listens on a closed server
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	p, err = New(closed.URL, Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, _ = serveCaptured(p, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rr.Code)
+	}
+}
+
+func TestProxy_Rewrites(t *testing.T) {
+	upstream := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Host", r.Host)
+		w.Header().Set("X-Upstream-Event", r.Header.Get("X-Github-Event"))
+		w.Header().Set("X-Upstream-Kind", r.Header.Get("X-Event-Kind"))
+		w.Header().Set("Server", "internal")
+	})
+
+	rules, err := rewrite.New([]rewrite.Rule{{
+		Match: rewrite.Match{Path: "/webhooks/github"},
+		Request: rewrite.Request{
+			Path:    &rewrite.Path{Regex: "^/webhooks/github$", Replacement: "/internal/events/github"},
+			Headers: rewrite.Headers{Rename: map[string]string{"X-GitHub-Event": "X-Event-Kind"}},
+			Host:    "events.internal",
+		},
+		Response: rewrite.Response{Headers: rewrite.Headers{Remove: []string{"Server"}}},
+	}})
+	if err != nil {
+		t.Fatalf("rewrite.New failed: %v", err)
+	}
+
+	p, err := New(upstream.URL+"/base", Options{Timeout: time.Second, Rewrites: rules})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader("{}"))
+	req.Header.Set("X-GitHub-Event", "push")
+	rr, rec := serveCaptured(p, req)
+
+	if path := rr.Header().Get("X-Upstream-Path"); path != "/base/internal/events/github" {
+		t.Errorf("Expected the rewritten path below the upstream path, got %s", path)
+	}
+	if host := rr.Header().Get("X-Upstream-Host"); host != "events.internal" {
+		t.Errorf("Expected Host events.internal, got %s", host)
+	}
+	if rr.Header().Get("X-Upstream-Event") != "" || rr.Header().Get("X-Upstream-Kind") != "push" {
+		t.Errorf("Expected the header to be renamed, got %v", rr.Header())
+	}
+	if rr.Header().Get("Server") != "" {
+		t.Errorf("Expected the response header to be removed, got %s", rr.Header().Get("Server"))
+	}
+	if rec.Upstream.URL != upstream.URL+"/base/internal/events/github" || rec.Upstream.Headers.Get("Server") != "internal" {
+		t.Errorf("Expected the exchange as the upstream saw it, got %s %v", rec.Upstream.URL, rec.Upstream.Headers)
+	}
+
+	// Other requests are forwarded unchanged
+	rr, _ = serveCaptured(p, httptest.NewRequest("GET", "/status", nil))
+	if rr.Header().Get("X-Upstream-Path") != "/base/status" || rr.Header().Get("Server") != "internal" {
+		t.Errorf("Expected an unchanged request, got %v", rr.Header())
+	}
+}
+
+func TestNew_InvalidTarget(t *testing.T) {
+	for _, target := range []string{"", "localhost:8080", "ftp://example.com", "http://", "://bad"} {
+		if _, err := New(target, Options{Timeout: time.Second}); err == nil {
+			t.Errorf("Expected error for upstream %q", target)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// maxDrainBody is the most read from a retried response so its connection can be reused
+const maxDrainBody = 64 << 10
+
+// retryTransport sends a request again when the upstream could not be reached or answered with a retryable status
+type retryTransport struct {
+	base       http.RoundTripper
+	retries    int
+	statuses   []int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if c, ok := req.Context().Value(exchangeKey{}).(*exchange); ok {
+			c.upstream.Attempts = attempt
+		}
+
+		if attempt > t.retries || req.Context().Err() != nil || err == nil && !t.retryable(resp.StatusCode) {
+			return resp, err
+		}
+		// Without GetBody a consumed body cannot be sent again
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+
+		attrs := []any{"path", req.URL.Path, "attempt", attempt}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		} else {
+			attrs = append(attrs, "status", resp.StatusCode)
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBody))
+			resp.Body.Close()
+		}
+		delay := t.delay(attempt)
+		slog.Warn("Retrying upstream request", append(attrs, "delay", delay)...)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		next := req.Clone(req.Context())
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		req = next
+	}
+}
+
+// retryable reports whether an upstream status is retried
+func (t *retryTransport) retryable(status int) bool {
+	return slices.Contains(t.statuses, status)
+}
+
+// delay returns the backoff before the given retry, doubling per attempt with up to half of it as random jitter
+func (t *retryTransport) delay(attempt int) time.Duration {
+	d := t.backoff
+	for i := 1; i < attempt && d < t.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, t.maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,140 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Pull limits
+const (
+	DefaultPullWait  = 30 * time.Second
+	MaxPullWait      = 5 * time.Minute
+	DefaultPullLimit = 10
+	MaxPullLimit     = 100
+)
+
+// API contains the admin API handlers of the relay.
+type API struct {
+	queue *Queue
+	token string
+}
+
+// NewAPI creates the relay API for the given queue. When token is set, requests must carry it as bearer token.
+func NewAPI(q *Queue, token string) *API {
+	return &API{
+		queue: q,
+		token: token,
+	}
+}
+
+// Ack is the optional request body of the acknowledge endpoint, describing the delivery.
+type Ack struct {
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Pull leases pending requests to the caller, waiting up to the wait parameter for one to arrive.
+// The requests are returned with sensitive headers, since they are delivered as they were received.
+func (a *API) Pull(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(w, r) {
+		return
+	}
+
+	limit := DefaultPullLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			api.WriteError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, MaxPullLimit)
+	}
+
+	wait := DefaultPullWait
+	if value := r.URL.Query().Get("wait"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			api.WriteError(w, http.StatusBadRequest, "invalid wait")
+			return
+		}
+		wait = min(d, MaxPullWait)
+	}
+
+	requests, err := a.queue.Pull(r.Context(), limit, wait)
+	if err != nil {
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.Context().Err() != nil {
+		return
+	}
+	if requests == nil {
+		requests = []*store.CapturedRequest{}
+	}
+	api.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"requests": requests,
+	})
+}
+
+// Acknowledge removes a delivered request from the queue.
+func (a *API) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(w, r) {
+		return
+	}
+
+	var ack Ack
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil && !errors.Is(err, io.EOF) {
+		api.WriteError(w, http.StatusBadRequest, "invalid acknowledgement: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	err := a.queue.Ack(id)
+	switch {
+	case errors.Is(err, ErrNotPending):
+		api.WriteError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		api.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	slog.Info("Relayed request delivered",
+		"request_id", id,
+		"status", ack.Status,
+		"error", ack.Error)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Status returns the queue counters.
+func (a *API) Status(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(w, r) {
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, a.queue.Stats())
+}
+
+// authorized checks the bearer token and answers 401 when it does not match
+func (a *API) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="raccoon relay"`)
+	api.WriteError(w, http.StatusUnauthorized, "invalid relay token")
+	return false
+}
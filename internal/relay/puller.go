@@ -0,0 +1,215 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Backoff between failed pulls
+const (
+	minPullBackoff = time.Second
+	maxPullBackoff = 30 * time.Second
+)
+
+// ErrUndelivered is returned by PullOnce when the target could not be reached for a pulled request
+var ErrUndelivered = errors.New("request not delivered")
+
+// Delivery is the outcome of delivering a pulled request to the local target.
+type Delivery struct {
+	Request  *store.CapturedRequest
+	Status   int
+	Duration time.Duration
+	// Err is set when the target could not be reached, the request is then not acknowledged, or when the
+	// request cannot be delivered at all, such as one with a truncated body, which is acknowledged with the error
+	Err error
+}
+
+// Puller fetches requests from a relay and delivers them to a local target.
+type Puller struct {
+	server string
+	target *url.URL
+	token  string
+	client *http.Client
+
+	// Limit is the largest number of requests fetched at once
+	Limit int
+	// Wait is how long the relay holds a pull open when nothing is pending
+	Wait time.Duration
+	// OnDelivery is called after every delivery attempt
+	OnDelivery func(Delivery)
+	// OnError is called when pulling or acknowledging fails
+	OnError func(error)
+}
+
+// NewPuller creates a puller for the relay at server, usually "https://raccoon.example.com",
+// delivering to the target URL. Token is the relay token, if the relay requires one.
+func NewPuller(server, target, token string) (*Puller, error) {
+	if _, err := parseURL(server); err != nil {
+		return nil, err
+	}
+	u, err := parseURL(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Puller{
+		server: strings.TrimSuffix(server, "/") + "/_raccoon/api/relay",
+		target: u,
+		token:  token,
+		client: &http.Client{
+			// The local target's answer is the result, redirects are not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Limit: DefaultPullLimit,
+		Wait:  DefaultPullWait,
+	}, nil
+}
+
+func parseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%q must be an absolute http or https URL", raw)
+	}
+	return u, nil
+}
+
+// Run pulls and delivers requests until ctx is done. Failed pulls and deliveries are retried with backoff.
+func (p *Puller) Run(ctx context.Context) error {
+	backoff := minPullBackoff
+	for {
+		err := p.PullOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			backoff = minPullBackoff
+			continue
+		}
+
+		// Failed deliveries were reported to OnDelivery already
+		if p.OnError != nil && !errors.Is(err, ErrUndelivered) {
+			p.OnError(err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxPullBackoff)
+	}
+}
+
+// PullOnce fetches pending requests, waiting up to Wait, and delivers them in order.
+// Delivered requests are acknowledged. Delivery stops at the first request the target could not be reached for,
+// returning ErrUndelivered, so that later requests do not overtake it; the relay hands it out again with the rest
+// of the page once their leases expire. Requests with a truncated body are acknowledged without delivery.
+func (p *Puller) PullOnce(ctx context.Context) error {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(p.Limit))
+	q.Set("wait", p.Wait.String())
+
+	var page struct {
+		Requests []*store.CapturedRequest `json:"requests"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/pull?"+q.Encode(), nil, http.StatusOK, &page); err != nil {
+		return err
+	}
+
+	for _, req := range page.Requests {
+		delivery := p.deliver(ctx, req)
+		if p.OnDelivery != nil {
+			p.OnDelivery(delivery)
+		}
+		ack := Ack{Status: delivery.Status}
+		switch {
+		case errors.Is(delivery.Err, mirror.ErrTruncated):
+			// Delivering it again would fail the same way
+			ack.Error = delivery.Err.Error()
+		case delivery.Err != nil:
+			return fmt.Errorf("%w: %s: %w", ErrUndelivered, req.ID, delivery.Err)
+		}
+		path := "/" + url.PathEscape(req.ID) + "/ack"
+		if err := p.call(ctx, http.MethodPost, path, ack, http.StatusNoContent, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Puller) deliver(ctx context.Context, captured *store.CapturedRequest) Delivery {
+	delivery := Delivery{Request: captured}
+
+	req, err := mirror.NewRequest(ctx, p.target, captured)
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	delivery.Duration = time.Since(start)
+	if err != nil {
+		delivery.Err = err
+		return delivery
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	delivery.Status = resp.StatusCode
+	return delivery
+}
+
+// call sends a relay API request and decodes the JSON response into out
+func (p *Puller) call(ctx context.Context, method, path string, in any, expected int, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.server+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("relay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("relay returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode relay response: %w", err)
+	}
+	return nil
+}
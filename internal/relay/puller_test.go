@@ -0,0 +1,266 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// newRelay starts a server with the relay API
+func newRelay(t *testing.T, q *Queue, token string) *httptest.Server {
+	t.Helper()
+
+	a := NewAPI(q, token)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_raccoon/api/relay", a.Status)
+	mux.HandleFunc("GET /_raccoon/api/relay/pull", a.Pull)
+	mux.HandleFunc("POST /_raccoon/api/relay/{id}/ack", a.Acknowledge)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func webhook(id string) *store.CapturedRequest {
+	return &store.CapturedRequest{
+		ID:     id,
+		Method: "POST",
+		URL:    "/hooks/github?delivery=" + id,
+		Path:   "/hooks/github",
+		Query:  "delivery=" + id,
+		Headers: http.Header{
+			"Content-Type":    {"application/json"},
+			"X-Hub-Signature": {"sha256=abc"},
+			"Authorization":   {"Bearer secret"},
+		},
+		Body: []byte(`{"id":"` + id + `"}`),
+	}
+}
+
+func TestAPI_Pull(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	q.Add(webhook("a"))
+	srv := newRelay(t, q, "")
+
+	resp, err := http.Get(srv.URL + "/_raccoon/api/relay/pull?wait=0s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var page struct {
+		Requests []*store.CapturedRequest `json:"requests"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(page.Requests) != 1 || page.Requests[0].Headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected the raw request, got %+v", page.Requests)
+	}
+
+	for query, status := range map[string]int{"limit=0": 400, "limit=x": 400, "wait=-1s": 400, "wait=soon": 400} {
+		resp, err := http.Get(srv.URL + "/_raccoon/api/relay/pull?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected %d for %s, got %d", status, query, resp.StatusCode)
+		}
+	}
+}
+
+func TestAPI_Token(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	srv := newRelay(t, q, "s3cret")
+
+	for token, status := range map[string]int{"": 401, "wrong": 401, "s3cret": 200} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/_raccoon/api/relay", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected %d for token %q, got %d", status, token, resp.StatusCode)
+		}
+	}
+}
+
+func TestPuller_DeliversAndAcknowledges(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	q.Add(webhook("a"))
+	q.Add(webhook("b"))
+	srv := newRelay(t, q, "s3cret")
+
+	var mu sync.Mutex
+	var received []string
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("X-Hub-Signature")+" "+string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer local.Close()
+
+	p, err := NewPuller(srv.URL, local.URL+"/dev", "s3cret")
+	if err != nil {
+		t.Fatalf("NewPuller failed: %v", err)
+	}
+	p.Wait = 0
+	var deliveries []Delivery
+	p.OnDelivery = func(d Delivery) {
+		deliveries = append(deliveries, d)
+	}
+
+	if err := p.PullOnce(context.Background()); err != nil {
+		t.Fatalf("PullOnce failed: %v", err)
+	}
+
+	want := `POST /dev/hooks/github?delivery=a sha256=abc {"id":"a"}`
+	if len(received) != 2 || received[0] != want {
+		t.Errorf("Expected %q first, got %q", want, received)
+	}
+	if len(deliveries) != 2 || deliveries[1].Request.ID != "b" || deliveries[1].Status != http.StatusAccepted {
+		t.Errorf("Unexpected deliveries %+v", deliveries)
+	}
+	if stats := q.Stats(); stats.Delivered != 2 || stats.Pending+stats.Leased != 0 {
+		t.Errorf("Expected both requests to be acknowledged, got %+v", stats)
+	}
+}
+
+func TestPuller_TargetDown(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	q.Add(webhook("a"))
+	q.Add(webhook("b"))
+	srv := newRelay(t, q, "")
+
+	p, err := NewPuller(srv.URL, "http://127.0.0.1:1", "")
+	if err != nil {
+		t.Fatalf("NewPuller failed: %v", err)
+	}
+	p.Wait = 0
+	var deliveries []Delivery
+	p.OnDelivery = func(d Delivery) {
+		deliveries = append(deliveries, d)
+	}
+
+	// Delivery stops at the first failure, so that the next request does not overtake it
+	if err := p.PullOnce(context.Background()); !errors.Is(err, ErrUndelivered) {
+		t.Fatalf("Expected ErrUndelivered, got %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Request.ID != "a" || deliveries[0].Err == nil {
+		t.Errorf("Expected a single failed delivery, got %+v", deliveries)
+	}
+	if stats := q.Stats(); stats.Delivered != 0 || stats.Leased != 2 {
+		t.Errorf("Expected the requests to stay leased for a retry, got %+v", stats)
+	}
+}
+
+func TestPuller_TruncatedBody(t *testing.T) {
+	truncated := webhook("a")
+	truncated.BodySize = 1 << 20
+	truncated.BodyTruncated = true
+	q := NewQueue(nil, time.Minute, 10)
+	q.Add(truncated)
+	srv := newRelay(t, q, "")
+
+	var received int
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		received++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer local.Close()
+
+	p, err := NewPuller(srv.URL, local.URL, "")
+	if err != nil {
+		t.Fatalf("NewPuller failed: %v", err)
+	}
+	p.Wait = 0
+	var delivery Delivery
+	p.OnDelivery = func(d Delivery) {
+		delivery = d
+	}
+
+	if err := p.PullOnce(context.Background()); err != nil {
+		t.Fatalf("PullOnce failed: %v", err)
+	}
+	if received != 0 || !errors.Is(delivery.Err, mirror.ErrTruncated) {
+		t.Errorf("Expected the truncated request not to be delivered, got %d deliveries (%v)", received, delivery.Err)
+	}
+	if stats := q.Stats(); stats.Pending+stats.Leased != 0 {
+		t.Errorf("Expected the request to be acknowledged instead of retried, got %+v", stats)
+	}
+}
+
+func TestPuller_Run(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	srv := newRelay(t, q, "")
+
+	delivered := make(chan string, 1)
+	local := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		delivered <- r.URL.Path
+	}))
+	defer local.Close()
+
+	p, err := NewPuller(srv.URL, local.URL, "")
+	if err != nil {
+		t.Fatalf("NewPuller failed: %v", err)
+	}
+	p.Wait = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	q.Add(webhook("a"))
+	select {
+	case path := <-delivered:
+		if path != "/hooks/github" {
+			t.Errorf("Unexpected path %s", path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request was not delivered")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPuller_Errors(t *testing.T) {
+	if _, err := NewPuller("relay.example.com", "http://localhost:3000", ""); err == nil {
+		t.Error("Expected error for a server without scheme")
+	}
+	if _, err := NewPuller("http://relay.example.com", "", ""); err == nil {
+		t.Error("Expected error for an empty target")
+	}
+
+	q := NewQueue(nil, time.Minute, 10)
+	srv := newRelay(t, q, "s3cret")
+	p, err := NewPuller(srv.URL, "http://localhost:3000", "wrong")
+	if err != nil {
+		t.Fatalf("NewPuller failed: %v", err)
+	}
+	if err := p.PullOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package relay holds captured requests until a pull client fetches them and acknowledges their delivery,
+// so webhooks received publicly can be delivered to machines that accept no inbound connections.
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Defaults for Queue options left at zero
+const (
+	DefaultLease = 30 * time.Second
+	DefaultSize  = 1000
+)
+
+// ErrNotPending is returned when acknowledging a request that is not waiting for delivery
+var ErrNotPending = errors.New("request is not pending delivery")
+
+// Queue holds captured requests in a store until their delivery is acknowledged.
+// Pulled requests are leased; a request whose lease expires without an acknowledgement is handed out again.
+type Queue struct {
+	lease time.Duration
+	store store.Store
+
+	mu sync.Mutex
+	// leases holds the end of the lease of pulled requests by ID. They are not persisted, so requests pulled
+	// before a restart are handed out again right away.
+	leases map[string]time.Time
+	// changed is closed and replaced whenever a request is added
+	changed   chan struct{}
+	delivered int64
+	dropped   int64
+}
+
+// Stats counts the requests of a queue. Delivered and dropped requests are counted since start.
+type Stats struct {
+	Pending   int   `json:"pending"`
+	Leased    int   `json:"leased"`
+	Delivered int64 `json:"delivered"`
+	Dropped   int64 `json:"dropped"`
+}
+
+// NewQueue creates a queue holding requests in st, which keeps them across restarts when it is a disk store.
+// When st is nil the requests are kept in a memory store of size requests. The queue does not close st.
+// Lease is how long a pulled request stays reserved for the client that pulled it. The oldest requests are
+// dropped when the store is full.
+func NewQueue(st store.Store, lease time.Duration, size int) *Queue {
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if st == nil {
+		st = store.NewMemory(size, 0)
+	}
+	return &Queue{
+		lease:   lease,
+		store:   st,
+		leases:  make(map[string]time.Time),
+		changed: make(chan struct{}),
+	}
+}
+
+// Add queues a captured request for delivery, dropping the oldest requests when the queue is full.
+func (q *Queue) Add(req *store.CapturedRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	before := q.store.Len()
+	if err := q.store.Add(req); err != nil {
+		slog.Error("Failed to queue request for relay", "request_id", req.ID, "error", err)
+		return
+	}
+	if dropped := before + 1 - q.store.Len(); dropped > 0 {
+		q.dropped += int64(dropped)
+		slog.Warn("Relay queue full, dropped oldest requests", "dropped", dropped)
+		for id := range q.leases {
+			if _, err := q.store.Get(id); errors.Is(err, store.ErrNotFound) {
+				delete(q.leases, id)
+			}
+		}
+	}
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Pull leases up to limit requests that are not leased, oldest first. When there are none it waits
+// up to wait for one to arrive or for a lease to expire, and returns nothing when it did not.
+func (q *Queue) Pull(ctx context.Context, limit int, wait time.Duration) ([]*store.CapturedRequest, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		requests, nextExpiry, err := q.leaseLocked(now, limit)
+		changed := q.changed
+		q.mu.Unlock()
+
+		if err != nil || len(requests) > 0 || !now.Before(deadline) {
+			return requests, err
+		}
+
+		wake := deadline
+		if !nextExpiry.IsZero() && nextExpiry.Before(wake) {
+			wake = nextExpiry
+		}
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		}
+		timer.Stop()
+	}
+}
+
+// leaseLocked leases available requests and returns them with the earliest expiry of the remaining leases
+func (q *Queue) leaseLocked(now time.Time, limit int) ([]*store.CapturedRequest, time.Time, error) {
+	queued, err := q.store.List(store.Filter{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var requests []*store.CapturedRequest
+	var nextExpiry time.Time
+	leases := make(map[string]time.Time, len(q.leases))
+	for _, req := range slices.Backward(queued) {
+		if until := q.leases[req.ID]; until.After(now) {
+			leases[req.ID] = until
+			if nextExpiry.IsZero() || until.Before(nextExpiry) {
+				nextExpiry = until
+			}
+			continue
+		}
+		if len(requests) >= limit {
+			continue
+		}
+		leases[req.ID] = now.Add(q.lease)
+		requests = append(requests, req)
+	}
+	// Expired leases and those of dropped requests are forgotten
+	q.leases = leases
+	return requests, nextExpiry, nil
+}
+
+// Ack removes a delivered request from the queue.
+func (q *Queue) Ack(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	err := q.store.Delete(id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrNotPending
+	}
+	if err != nil {
+		return err
+	}
+	delete(q.leases, id)
+	q.delivered++
+	return nil
+}
+
+// Stats returns the queue counters.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := Stats{Delivered: q.delivered, Dropped: q.dropped}
+	now := time.Now()
+	for _, until := range q.leases {
+		if until.After(now) {
+			stats.Leased++
+		}
+	}
+	stats.Pending = q.store.Len() - stats.Leased
+	return stats
+}
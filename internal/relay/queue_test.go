@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func ids(requests []*store.CapturedRequest) []string {
+	var out []string
+	for _, req := range requests {
+		out = append(out, req.ID)
+	}
+	return out
+}
+
+// pull leases requests from q, failing the test when the queue store fails
+func pull(t *testing.T, ctx context.Context, q *Queue, limit int, wait time.Duration) []*store.CapturedRequest {
+	t.Helper()
+
+	requests, err := q.Pull(ctx, limit, wait)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	return requests
+}
+
+func TestQueue_PullAndAck(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		q.Add(&store.CapturedRequest{ID: id})
+	}
+
+	got := pull(t, ctx, q, 2, 0)
+	if len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Fatalf("Expected a and b, got %v", ids(got))
+	}
+	// Leased requests are not handed out again
+	if got := pull(t, ctx, q, 10, 0); len(got) != 1 || got[0].ID != "c" {
+		t.Fatalf("Expected c, got %v", ids(got))
+	}
+	if stats := q.Stats(); stats.Leased != 3 || stats.Pending != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := q.Ack("b"); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	if err := q.Ack("b"); !errors.Is(err, ErrNotPending) {
+		t.Errorf("Expected ErrNotPending for a second ack, got %v", err)
+	}
+	if stats := q.Stats(); stats.Leased != 2 || stats.Delivered != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestQueue_LeaseExpires(t *testing.T) {
+	q := NewQueue(nil, 50*time.Millisecond, 10)
+	q.Add(&store.CapturedRequest{ID: "a"})
+
+	if got := pull(t, context.Background(), q, 1, 0); len(got) != 1 {
+		t.Fatalf("Expected a, got %v", ids(got))
+	}
+
+	// Waiting wakes up when the lease expires
+	start := time.Now()
+	got := pull(t, context.Background(), q, 1, time.Second)
+	if len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("Expected a to be handed out again, got %v", ids(got))
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the pull to return after the lease expired, took %v", elapsed)
+	}
+}
+
+func TestQueue_PullWaits(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 10)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q.Add(&store.CapturedRequest{ID: "late"})
+	}()
+	if got := pull(t, context.Background(), q, 10, 5*time.Second); len(got) != 1 || got[0].ID != "late" {
+		t.Errorf("Expected the late request, got %v", ids(got))
+	}
+
+	if got := pull(t, context.Background(), q, 10, 20*time.Millisecond); len(got) != 0 {
+		t.Errorf("Expected nothing after waiting, got %v", ids(got))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := pull(t, ctx, q, 10, time.Minute); got != nil {
+		t.Errorf("Expected nothing when canceled, got %v", ids(got))
+	}
+}
+
+func TestQueue_DropsOldest(t *testing.T) {
+	q := NewQueue(nil, time.Minute, 2)
+	for _, id := range []string{"a", "b", "c"} {
+		q.Add(&store.CapturedRequest{ID: id})
+	}
+
+	if got := pull(t, context.Background(), q, 10, 0); len(got) != 2 || got[0].ID != "b" || got[1].ID != "c" {
+		t.Errorf("Expected b and c, got %v", ids(got))
+	}
+	if stats := q.Stats(); stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped request, got %+v", stats)
+	}
+}
+
+func TestQueue_Persisted(t *testing.T) {
+	dir := t.TempDir()
+	st, err := store.NewDisk(dir, store.DiskOptions{})
+	if err != nil {
+		t.Fatalf("NewDisk failed: %v", err)
+	}
+	q := NewQueue(st, time.Minute, 0)
+	for _, id := range []string{"a", "b"} {
+		q.Add(&store.CapturedRequest{ID: id})
+	}
+	if got := pull(t, context.Background(), q, 1, 0); len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("Expected a, got %v", ids(got))
+	}
+	if err := q.Ack("a"); err != nil {
+		t.Fatalf("Ack failed: %v", err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Requests not acknowledged before a restart are handed out again
+	st, err = store.NewDisk(dir, store.DiskOptions{})
+	if err != nil {
+		t.Fatalf("NewDisk failed: %v", err)
+	}
+	defer st.Close()
+	q = NewQueue(st, time.Minute, 0)
+	if got := pull(t, context.Background(), q, 10, 0); len(got) != 1 || got[0].ID != "b" {
+		t.Errorf("Expected b after the restart, got %v", ids(got))
+	}
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252, the rest match ISO-8859-1
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// toUTF8 converts data in the given charset to UTF-8.
+// Only the charsets the standard library makes easy are supported: UTF-8, ASCII, ISO-8859-1, Windows-1252 and UTF-16.
+func toUTF8(data []byte, charset string) ([]byte, error) {
+	switch charset {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return data, nil
+	case "iso-8859-1", "latin1", "latin-1", "l1":
+		return singleByte(data, nil), nil
+	case "windows-1252", "cp1252":
+		return singleByte(data, &windows1252), nil
+	case "utf-16", "utf-16be", "utf-16le":
+		return fromUTF16(data, charset), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+// singleByte decodes ISO-8859-1, with the bytes 0x80 to 0x9F taken from high when set
+func singleByte(data []byte, high *[32]rune) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		r := rune(b)
+		if high != nil && b >= 0x80 && b < 0xA0 {
+			r = high[b-0x80]
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out
+}
+
+// fromUTF16 decodes UTF-16, big-endian unless a byte order mark or the charset says otherwise
+func fromUTF16(data []byte, charset string) []byte {
+	var order binary.ByteOrder = binary.BigEndian
+	if charset == "utf-16le" {
+		order = binary.LittleEndian
+	}
+	if charset == "utf-16" && len(data) >= 2 {
+		switch {
+		case data[0] == 0xFE && data[1] == 0xFF:
+			data = data[2:]
+		case data[0] == 0xFF && data[1] == 0xFE:
+			order = binary.LittleEndian
+			data = data[2:]
+		}
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
@@ -0,0 +1,274 @@
+// Package render decodes request bodies by their media type and charset and renders them for log lines.
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Formats a body is decoded as
+const (
+	FormatJSON   = "json"
+	FormatForm   = "form"
+	FormatXML    = "xml"
+	FormatNDJSON = "ndjson"
+	FormatText   = "text"
+	FormatBinary = "binary"
+)
+
+// Namespaces of SOAP 1.1 and 1.2 envelopes
+var soapNamespaces = []string{
+	"http://schemas.xmlsoap.org/soap/envelope/",
+	"http://www.w3.org/2003/05/soap-envelope",
+}
+
+var ndjsonTypes = []string{
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/jsonlines",
+	"application/x-jsonlines",
+}
+
+// Options configure how bodies are rendered
+type Options struct {
+	// Pretty indents JSON instead of compacting it
+	Pretty bool
+	// Partial marks a body that was cut short; it is rendered as far as it goes without reporting it as invalid
+	Partial bool
+}
+
+// Body decodes a body by its Content-Type and returns what was found together with the value to log:
+// compact JSON as a json.RawMessage (indented as a string when pretty), forms as maps, NDJSON as a list of records,
+// XML and text as UTF-8 strings and binary bodies as base64.
+func Body(contentType string, data []byte, opts Options) (*store.Content, any) {
+	c := &store.Content{}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		c.Sniffed = sniff(data)
+		mediaType, _, _ = mime.ParseMediaType(c.Sniffed)
+		params = nil
+	}
+	c.MediaType = mediaType
+
+	text := data
+	if charset := strings.ToLower(params["charset"]); charset != "" {
+		c.Charset = charset
+		if text, err = toUTF8(data, charset); err != nil {
+			c.Error = err.Error()
+			text = data
+		}
+	}
+	if opts.Partial {
+		text = trimRune(text)
+	}
+
+	if !utf8.Valid(text) {
+		c.Format = FormatBinary
+		if c.Sniffed == "" {
+			c.Sniffed = sniff(data)
+		}
+		return c, base64.StdEncoding.EncodeToString(data)
+	}
+
+	switch {
+	case isJSON(mediaType):
+		return c, renderJSON(c, text, opts)
+	case mediaType == "application/x-www-form-urlencoded":
+		return c, renderForm(c, text, opts)
+	case isXML(mediaType):
+		return c, renderXML(c, text, opts)
+	case slices.Contains(ndjsonTypes, mediaType):
+		return c, renderNDJSON(c, text, opts)
+	case c.Sniffed != "" && json.Valid(text):
+		// Undeclared JSON is recognised by being valid
+		c.MediaType = "application/json"
+		return c, renderJSON(c, text, opts)
+	}
+	c.Format = FormatText
+	return c, string(text)
+}
+
+// LogFields returns what was found about a body as structured log attributes.
+func LogFields(c *store.Content) []any {
+	if c == nil {
+		return nil
+	}
+
+	fields := []any{"request_body_format", c.Format}
+	if c.Sniffed != "" {
+		fields = append(fields, "request_body_sniffed", c.Sniffed)
+	}
+	if c.Charset != "" && c.Charset != "utf-8" {
+		fields = append(fields, "request_body_charset", c.Charset)
+	}
+	if c.Operation != "" {
+		fields = append(fields, "soap_operation", c.Operation)
+	}
+	if c.Records > 0 {
+		fields = append(fields, "request_body_records", c.Records)
+	}
+	if c.Error != "" {
+		fields = append(fields, "request_body_error", c.Error)
+	}
+	return fields
+}
+
+// sniff returns the media type of data detected by its content
+func sniff(data []byte) string {
+	return http.DetectContentType(data)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isXML(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+func renderJSON(c *store.Content, text []byte, opts Options) any {
+	c.Format = FormatJSON
+	var buf bytes.Buffer
+	if opts.Pretty {
+		if err := json.Indent(&buf, text, "", "  "); err == nil {
+			return buf.String()
+		}
+	} else if err := json.Compact(&buf, text); err == nil {
+		return json.RawMessage(buf.Bytes())
+	}
+
+	if !opts.Partial {
+		var v any
+		c.Error = "invalid JSON: " + json.Unmarshal(text, &v).Error()
+	}
+	return string(text)
+}
+
+// renderForm decodes a form into its values, logged as strings where a key has a single value
+func renderForm(c *store.Content, text []byte, opts Options) any {
+	c.Format = FormatForm
+	values, err := url.ParseQuery(string(text))
+	if err != nil && !opts.Partial {
+		c.Error = "invalid form: " + err.Error()
+	}
+	c.Form = values
+
+	fields := make(map[string]any, len(values))
+	for key, v := range values {
+		if len(v) == 1 {
+			fields[key] = v[0]
+		} else {
+			fields[key] = v
+		}
+	}
+	return fields
+}
+
+// renderXML checks an XML body is well-formed and finds its root element and SOAP operation
+func renderXML(c *store.Content, text []byte, opts Options) any {
+	c.Format = FormatXML
+	d := xml.NewDecoder(bytes.NewReader(text))
+	// The body is already UTF-8, whatever the declaration says
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	soap, inBody := false, false
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if !opts.Partial {
+				c.Error = "invalid XML: " + err.Error()
+			}
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case depth == 0:
+				c.Root = t.Name.Local
+				soap = t.Name.Local == "Envelope" && slices.Contains(soapNamespaces, t.Name.Space)
+			case depth == 1 && soap && t.Name.Local == "Body":
+				inBody = true
+			case depth == 2 && inBody && c.Operation == "":
+				c.Operation = t.Name.Local
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 1 {
+				inBody = false
+			}
+		}
+	}
+	if c.Root == "" && c.Error == "" && !opts.Partial {
+		c.Error = "invalid XML: no root element"
+	}
+	return strings.TrimSpace(string(text))
+}
+
+// renderNDJSON decodes newline delimited JSON into its records
+func renderNDJSON(c *store.Content, text []byte, opts Options) any {
+	c.Format = FormatNDJSON
+	lines := bytes.Split(text, []byte("\n"))
+	records := make([]json.RawMessage, 0, len(lines))
+	var errs []string
+	for i, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, line); err != nil {
+			// The last line of a partial body is cut short
+			if !opts.Partial || i < len(lines)-1 {
+				errs = append(errs, fmt.Sprintf("line %d: invalid JSON", i+1))
+			}
+			continue
+		}
+		records = append(records, json.RawMessage(buf.Bytes()))
+	}
+	c.Records = len(records)
+	c.Error = strings.Join(errs, "; ")
+
+	if opts.Pretty {
+		pretty := make([]string, len(records))
+		for i, record := range records {
+			var buf bytes.Buffer
+			_ = json.Indent(&buf, record, "", "  ")
+			pretty[i] = buf.String()
+		}
+		return strings.Join(pretty, "\n")
+	}
+	return records
+}
+
+// trimRune cuts an incomplete UTF-8 sequence from the end of data
+func trimRune(data []byte) []byte {
+	i := len(data) - 1
+	for i > 0 && len(data)-i < utf8.UTFMax && !utf8.RuneStart(data[i]) {
+		i--
+	}
+	if i >= 0 && !utf8.FullRune(data[i:]) {
+		return data[:i]
+	}
+	return data
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func TestBody_JSON(t *testing.T) {
+	c, value := Body("application/json", []byte("{\n  \"ref\": \"refs/heads/main\"\n}"), Options{})
+	if c.Format != FormatJSON || c.Error != "" {
+		t.Errorf("Expected valid JSON, got %+v", c)
+	}
+	if raw, ok := value.(json.RawMessage); !ok || string(raw) != `{"ref":"refs/heads/main"}` {
+		t.Errorf("Expected compact JSON, got %#v", value)
+	}
+
+	_, value = Body("application/vnd.github+json", []byte(`{"a":1}`), Options{Pretty: true})
+	if value != "{\n  \"a\": 1\n}" {
+		t.Errorf("Expected indented JSON, got %#v", value)
+	}
+
+	c, value = Body("application/json", []byte(`{"a":`), Options{})
+	if !strings.HasPrefix(c.Error, "invalid JSON") || value != `{"a":` {
+		t.Errorf("Expected invalid JSON to be reported and logged as text, got %+v %#v", c, value)
+	}
+	if c, _ = Body("application/json", []byte(`{"a":`), Options{Partial: true}); c.Error != "" {
+		t.Errorf("Expected a partial body not to be reported invalid, got %q", c.Error)
+	}
+
+	c, _ = Body("", []byte(`[1, 2]`), Options{})
+	if c.Format != FormatJSON || c.MediaType != "application/json" || c.Sniffed == "" {
+		t.Errorf("Expected undeclared JSON to be recognised, got %+v", c)
+	}
+}
+
+func TestBody_Form(t *testing.T) {
+	c, value := Body("application/x-www-form-urlencoded", []byte("name=Raccoon+Rocket&tag=a&tag=b"), Options{})
+	if c.Format != FormatForm || !reflect.DeepEqual(c.Form["tag"], []string{"a", "b"}) {
+		t.Errorf("Expected the form values, got %+v", c)
+	}
+	expected := map[string]any{"name": "Raccoon Rocket", "tag": []string{"a", "b"}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %v, got %v", expected, value)
+	}
+
+	if c, _ := Body("application/x-www-form-urlencoded", []byte("a=%zz"), Options{}); !strings.HasPrefix(c.Error, "invalid form") {
+		t.Errorf("Expected an invalid form to be reported, got %+v", c)
+	}
+}
+
+func TestBody_XML(t *testing.T) {
+	soap := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><Auth/></soap:Header>
+  <soap:Body><m:GetPrice xmlns:m="https://example.com/prices"><m:Item>Apples</m:Item></m:GetPrice></soap:Body>
+</soap:Envelope>`
+
+	c, value := Body("text/xml; charset=utf-8", []byte(soap), Options{})
+	if c.Format != FormatXML || c.Root != "Envelope" || c.Operation != "GetPrice" || c.Error != "" {
+		t.Errorf("Expected a SOAP envelope calling GetPrice, got %+v", c)
+	}
+	if value != soap {
+		t.Errorf("Expected the XML to be logged as text, got %#v", value)
+	}
+
+	c, _ = Body("application/xml", []byte(`<order><id>1</order>`), Options{})
+	if c.Root != "order" || c.Operation != "" || !strings.HasPrefix(c.Error, "invalid XML") {
+		t.Errorf("Expected malformed XML to be reported, got %+v", c)
+	}
+}
+
+func TestBody_NDJSON(t *testing.T) {
+	c, value := Body("application/x-ndjson", []byte("{\"n\": 1}\n\n{\"n\": 2}\nnope\n"), Options{})
+	if c.Format != FormatNDJSON || c.Records != 2 || c.Error != "line 4: invalid JSON" {
+		t.Errorf("Expected two records and an invalid line, got %+v", c)
+	}
+	expected := []json.RawMessage{json.RawMessage(`{"n":1}`), json.RawMessage(`{"n":2}`)}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %s, got %s", expected, value)
+	}
+
+	if c, _ := Body("application/x-ndjson", []byte("{\"n\": 1}\n{\"n\""), Options{Partial: true}); c.Records != 1 || c.Error != "" {
+		t.Errorf("Expected the cut last line of a partial body to be skipped, got %+v", c)
+	}
+}
+
+func TestBody_Charsets(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        []byte
+		expected    string
+	}{
+		{"text/plain; charset=ISO-8859-1", []byte("caf\xe9"), "café"},
+		{"text/plain; charset=windows-1252", []byte("\x93quoted\x94 \x80"), "“quoted” €"},
+		{"text/plain; charset=utf-16le", []byte("h\x00i\x00"), "hi"},
+		{"text/plain; charset=utf-16", []byte("\xfe\xff\x00h\x00i"), "hi"},
+		{"text/plain; charset=utf-8", []byte("žluťoučký"), "žluťoučký"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			c, value := Body(tt.contentType, tt.data, Options{})
+			if c.Format != FormatText || value != tt.expected {
+				t.Errorf("Expected %q, got %+v %#v", tt.expected, c, value)
+			}
+		})
+	}
+
+	if c, _ := Body("text/plain; charset=shift_jis", []byte("abc"), Options{}); c.Error != `unsupported charset "shift_jis"` {
+		t.Errorf("Expected an unsupported charset to be reported, got %+v", c)
+	}
+}
+
+func TestBody_Binary(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	c, value := Body("application/octet-stream", png, Options{})
+	if c.Format != FormatBinary || c.Sniffed != "image/png" || value != "iVBORw0KGgoAAAANSUhEUg==" {
+		t.Errorf("Expected a base64 PNG, got %+v %#v", c, value)
+	}
+
+	// A multi-byte character cut by a partial body is not mistaken for binary data
+	c, value = Body("text/plain", []byte("caf\xc3"), Options{Partial: true})
+	if c.Format != FormatText || value != "caf" {
+		t.Errorf("Expected the cut character to be dropped, got %+v %#v", c, value)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	if fields := LogFields(nil); fields != nil {
+		t.Errorf("Expected no fields, got %v", fields)
+	}
+
+	fields := LogFields(&store.Content{Format: FormatNDJSON, Charset: "utf-8", Records: 2, Error: "line 3: invalid JSON"})
+	expected := []any{"request_body_format", FormatNDJSON, "request_body_records", 2, "request_body_error", "line 3: invalid JSON"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+}
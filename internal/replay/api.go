@@ -0,0 +1,96 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// API contains the admin API handler replaying captured requests.
+type API struct {
+	store store.Store
+}
+
+// NewAPI creates the replay API for the given store.
+func NewAPI(st store.Store) *API {
+	return &API{
+		store: st,
+	}
+}
+
+// Body is the request body of the replay endpoint.
+type Body struct {
+	Options
+	// IDs selects the requests to replay, when empty the query filter does
+	IDs []string `json:"ids,omitempty"`
+}
+
+// Replay sends captured requests to the target in the request body and answers with the report once all were sent.
+// The requests are selected by ID, or by the query filter and page like the list endpoint.
+func (a *API) Replay(w http.ResponseWriter, r *http.Request) {
+	var body Body
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.WriteError(w, http.StatusBadRequest, "invalid replay: "+err.Error())
+		return
+	}
+
+	replayer, err := New(body.Options)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requests, status, err := a.selectRequests(r, body.IDs)
+	if err != nil {
+		api.WriteError(w, status, err.Error())
+		return
+	}
+
+	report := replayer.Replay(r.Context(), requests)
+	slog.Info("Replayed captured requests",
+		"target", report.Target,
+		"total", report.Total,
+		"succeeded", report.Succeeded,
+		"failed", report.Failed)
+	api.WriteJSON(w, http.StatusOK, report)
+}
+
+// selectRequests returns the requests to replay and the status to answer with when that fails
+func (a *API) selectRequests(r *http.Request, ids []string) ([]*store.CapturedRequest, int, error) {
+	if len(ids) > 0 {
+		requests := make([]*store.CapturedRequest, 0, len(ids))
+		for _, id := range ids {
+			req, err := a.store.Get(id)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, http.StatusNotFound, errors.New("request " + id + " not found")
+			}
+			if err != nil {
+				slog.Error("Failed to get captured request", "error", err, "id", id)
+				return nil, http.StatusInternalServerError, errors.New("failed to get request")
+			}
+			requests = append(requests, req)
+		}
+		return requests, http.StatusOK, nil
+	}
+
+	filter, err := store.ParseFilter(r.URL.Query())
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	offset, limit, err := api.ParsePage(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	requests, err := a.store.List(filter)
+	if err != nil {
+		slog.Error("Failed to list captured requests", "error", err)
+		return nil, http.StatusInternalServerError, errors.New("failed to list requests")
+	}
+	total := len(requests)
+	return requests[min(offset, total):min(offset+limit, total)], http.StatusOK, nil
+}
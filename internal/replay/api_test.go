@@ -0,0 +1,87 @@
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func newTestAPI(t *testing.T) (*http.ServeMux, store.Store) {
+	t.Helper()
+
+	st := store.NewMemory(100, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /_raccoon/api/replay", NewAPI(st).Replay)
+	return mux, st
+}
+
+func serve(mux *http.ServeMux, target, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return rr
+}
+
+func TestAPI_Replay(t *testing.T) {
+	srv, requests := newConsumer(t)
+	mux, st := newTestAPI(t)
+
+	base := time.Now()
+	_ = st.Add(webhook("orders", "/hooks/orders", base))
+	_ = st.Add(webhook("fail", "/hooks/fail", base.Add(time.Second)))
+	_ = st.Add(&store.CapturedRequest{ID: "get", Method: "GET", Path: "/health", ReceivedAt: base.Add(2 * time.Second)})
+
+	rr := serve(mux, "/_raccoon/api/replay?method=POST", `{"target":"`+srv.URL+`"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.Total != 2 || report.Succeeded != 1 || report.Failed != 1 || report.Results[0].ID != "orders" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(requests()) != 2 {
+		t.Errorf("Expected 2 replayed requests, got %d", len(requests()))
+	}
+
+	rr = serve(mux, "/_raccoon/api/replay", `{"target":"`+srv.URL+`","ids":["fail"],"raw":true}`)
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if report.Total != 1 || report.Results[0].ID != "fail" {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if got := requests(); len(got) != 3 || got[2].header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected the raw request to be replayed, got %v", got)
+	}
+}
+
+func TestAPI_ReplayErrors(t *testing.T) {
+	mux, _ := newTestAPI(t)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{"invalid JSON", "/_raccoon/api/replay", `{`, http.StatusBadRequest},
+		{"invalid target", "/_raccoon/api/replay", `{"target":"nowhere"}`, http.StatusBadRequest},
+		{"invalid filter", "/_raccoon/api/replay?since=yesterday", `{"target":"http://localhost:1"}`, http.StatusBadRequest},
+		{"unknown ID", "/_raccoon/api/replay", `{"target":"http://localhost:1","ids":["missing"]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := serve(mux, tt.target, tt.body); rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package replay sends captured requests again to a target, e.g. to re-deliver the webhooks a consumer failed on.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// DefaultTimeout bounds each replayed request when Options.Timeout is zero
+const DefaultTimeout = 30 * time.Second
+
+// Options configures a replay.
+type Options struct {
+	// Target is the URL requests are sent to, its path is prepended to the captured paths
+	Target string `json:"target"`
+	// Concurrency is the number of requests in flight, one keeps the original order
+	Concurrency int `json:"concurrency,omitempty"`
+	// Rate limits how many requests are started per second, zero is unlimited
+	Rate float64 `json:"rate,omitempty"`
+	// Timing reproduces the original gaps between the requests
+	Timing bool `json:"timing,omitempty"`
+	// Speed divides the original gaps when Timing is set, 2 replays twice as fast
+	Speed float64 `json:"speed,omitempty"`
+	// Raw sends sensitive headers such as Authorization with their stored values instead of dropping them
+	Raw bool `json:"raw,omitempty"`
+	// Timeout bounds each request
+	Timeout time.Duration `json:"-"`
+}
+
+// Result is the outcome of a single replayed request.
+type Result struct {
+	ID       string        `json:"id"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report summarizes a replay. Requests answered with a status outside 2xx count as failed.
+type Report struct {
+	Target    string   `json:"target"`
+	Total     int      `json:"total"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Results   []Result `json:"results"`
+}
+
+// Replayer sends captured requests to a target.
+type Replayer struct {
+	target *url.URL
+	client *http.Client
+	opts   Options
+}
+
+// New creates a replayer, validating the target and applying defaults.
+func New(opts Options) (*Replayer, error) {
+	u, err := url.Parse(opts.Target)
+	if err != nil {
+		return nil, fmt.Errorf("parse replay target: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("replay target %q must be an absolute http or https URL", opts.Target)
+	}
+	if opts.Concurrency < 0 || opts.Rate < 0 || opts.Speed < 0 {
+		return nil, errors.New("concurrency, rate and speed must not be negative")
+	}
+
+	if opts.Concurrency == 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &Replayer{
+		target: u,
+		client: &http.Client{
+			// The consumer's answer is the result, redirects are not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		opts: opts,
+	}, nil
+}
+
+// Replay sends the requests in the order they were received and waits for all of them.
+// Requests not sent before ctx is done are reported with its error.
+func (r *Replayer) Replay(ctx context.Context, requests []*store.CapturedRequest) Report {
+	requests = slices.Clone(requests)
+	slices.SortStableFunc(requests, func(a, b *store.CapturedRequest) int {
+		return a.ReceivedAt.Compare(b.ReceivedAt)
+	})
+
+	results := make([]Result, len(requests))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(r.opts.Concurrency, len(requests)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = r.send(ctx, requests[i])
+			}
+		}()
+	}
+
+	r.dispatch(ctx, requests, jobs, results)
+	close(jobs)
+	wg.Wait()
+
+	report := Report{Target: r.target.String(), Total: len(results), Results: results}
+	for _, result := range results {
+		if result.Error == "" && result.Status >= 200 && result.Status < 300 {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// dispatch hands out request indexes at the time each request is due
+func (r *Replayer) dispatch(ctx context.Context, requests []*store.CapturedRequest, jobs chan<- int, results []Result) {
+	start := time.Now()
+	var next time.Time
+	for i, req := range requests {
+		at := start
+		if r.opts.Timing {
+			gap := req.ReceivedAt.Sub(requests[0].ReceivedAt)
+			at = start.Add(time.Duration(float64(gap) / r.opts.Speed))
+		}
+		if r.opts.Rate > 0 {
+			if at.Before(next) {
+				at = next
+			}
+			next = at.Add(time.Duration(float64(time.Second) / r.opts.Rate))
+		}
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-timer.C:
+			select {
+			case jobs <- i:
+				continue
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+			timer.Stop()
+		}
+
+		// Canceled, report the requests that were not sent
+		for j := i; j < len(requests); j++ {
+			results[j] = Result{
+				ID:     requests[j].ID,
+				Method: requests[j].Method,
+				Path:   requests[j].Path,
+				Error:  ctx.Err().Error(),
+			}
+		}
+		return
+	}
+}
+
+func (r *Replayer) send(ctx context.Context, captured *store.CapturedRequest) Result {
+	result := Result{ID: captured.ID, Method: captured.Method, Path: captured.Path}
+
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	req, err := mirror.NewRequest(ctx, r.target, captured)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if !r.opts.Raw {
+		for name := range req.Header {
+			if store.IsSensitiveHeader(name) {
+				req.Header.Del(name)
+			}
+		}
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Error = err.Error()
+		return result
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	result.Duration = time.Since(start)
+	result.Status = resp.StatusCode
+	return result
+}
@@ -0,0 +1,218 @@
+package replay
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+type received struct {
+	method string
+	uri    string
+	header http.Header
+	body   string
+	at     time.Time
+}
+
+// newConsumer starts a target recording the requests it receives, answering 500 for paths ending in /hooks/fail
+func newConsumer(t *testing.T) (*httptest.Server, func() []received) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{method: r.Method, uri: r.RequestURI, header: r.Header, body: string(body), at: time.Now()})
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/hooks/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), requests...)
+	}
+}
+
+func webhook(id, path string, receivedAt time.Time) *store.CapturedRequest {
+	return &store.CapturedRequest{
+		ID:     id,
+		Method: "POST",
+		Path:   path,
+		Query:  "attempt=1",
+		Headers: http.Header{
+			"Content-Type":  {"application/json"},
+			"Authorization": {"Bearer secret"},
+		},
+		Body:       []byte(`{"id":"` + id + `"}`),
+		ReceivedAt: receivedAt,
+	}
+}
+
+func TestReplay_PreservesRequests(t *testing.T) {
+	srv, requests := newConsumer(t)
+	base := time.Now()
+
+	r, err := New(Options{Target: srv.URL + "/v2"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	// Newest first, as the store lists them
+	report := r.Replay(context.Background(), []*store.CapturedRequest{
+		webhook("second", "/hooks/fail", base.Add(time.Second)),
+		webhook("first", "/hooks/orders", base),
+	})
+
+	if report.Total != 2 || report.Succeeded != 1 || report.Failed != 1 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Results[0].ID != "first" || report.Results[0].Status != http.StatusOK ||
+		report.Results[1].ID != "second" || report.Results[1].Status != http.StatusInternalServerError {
+		t.Errorf("Unexpected results %+v", report.Results)
+	}
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 replayed requests, got %d", len(got))
+	}
+	first := got[0]
+	if first.method != "POST" || first.uri != "/v2/hooks/orders?attempt=1" || first.body != `{"id":"first"}` {
+		t.Errorf("Unexpected replayed request %s %s %s", first.method, first.uri, first.body)
+	}
+	if first.header.Get("Content-Type") != "application/json" || first.header.Get("X-Raccoon-Request-Id") != "first" {
+		t.Errorf("Unexpected headers %v", first.header)
+	}
+	if first.header.Get("Authorization") != "" {
+		t.Error("Expected sensitive headers to be dropped")
+	}
+}
+
+func TestReplay_Raw(t *testing.T) {
+	srv, requests := newConsumer(t)
+
+	r, err := New(Options{Target: srv.URL, Raw: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	r.Replay(context.Background(), []*store.CapturedRequest{webhook("r1", "/hooks", time.Now())})
+
+	if got := requests(); len(got) != 1 || got[0].header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected the stored Authorization header, got %v", got)
+	}
+}
+
+func TestReplay_TruncatedBody(t *testing.T) {
+	srv, requests := newConsumer(t)
+	truncated := webhook("r1", "/hooks", time.Now())
+	truncated.BodySize = 1 << 20
+	truncated.BodyTruncated = true
+
+	r, err := New(Options{Target: srv.URL})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	report := r.Replay(context.Background(), []*store.CapturedRequest{truncated, webhook("r2", "/hooks", time.Now())})
+
+	if got := requests(); len(got) != 1 || got[0].body != `{"id":"r2"}` {
+		t.Errorf("Expected only the complete request to be sent, got %v", got)
+	}
+	if report.Failed != 1 || !strings.Contains(report.Results[0].Error, "truncated") {
+		t.Errorf("Expected the truncated request to fail with a reason, got %+v", report)
+	}
+}
+
+func TestReplay_Timing(t *testing.T) {
+	srv, requests := newConsumer(t)
+	base := time.Now()
+
+	r, err := New(Options{Target: srv.URL, Timing: true, Speed: 4})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	start := time.Now()
+	r.Replay(context.Background(), []*store.CapturedRequest{
+		webhook("a", "/hooks", base),
+		webhook("b", "/hooks", base.Add(time.Second)),
+	})
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 replayed requests, got %d", len(got))
+	}
+	if gap := got[1].at.Sub(start); gap < 250*time.Millisecond || gap > 900*time.Millisecond {
+		t.Errorf("Expected the gap to be a quarter of a second, got %v", gap)
+	}
+}
+
+func TestReplay_Rate(t *testing.T) {
+	srv, requests := newConsumer(t)
+	now := time.Now()
+
+	r, err := New(Options{Target: srv.URL, Rate: 10, Concurrency: 3})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	start := time.Now()
+	r.Replay(context.Background(), []*store.CapturedRequest{
+		webhook("a", "/hooks", now), webhook("b", "/hooks", now), webhook("c", "/hooks", now),
+	})
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 replayed requests, got %d", len(got))
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected 3 requests at 10/s to take at least 200ms, took %v", elapsed)
+	}
+}
+
+func TestReplay_Canceled(t *testing.T) {
+	srv, requests := newConsumer(t)
+	base := time.Now()
+
+	r, err := New(Options{Target: srv.URL, Timing: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	report := r.Replay(ctx, []*store.CapturedRequest{
+		webhook("a", "/hooks", base),
+		webhook("b", "/hooks", base.Add(time.Hour)),
+	})
+
+	if len(requests()) != 1 {
+		t.Errorf("Expected only the first request to be sent, got %d", len(requests()))
+	}
+	if report.Failed != 1 || report.Results[1].ID != "b" || report.Results[1].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected the second request to be reported as not sent, got %+v", report)
+	}
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	tests := []Options{
+		{Target: "not a url"},
+		{Target: "ftp://example.com"},
+		{Target: "http://example.com", Concurrency: -1},
+		{Target: "http://example.com", Rate: -1},
+		{Target: "http://example.com", Speed: -1},
+	}
+
+	for _, opts := range tests {
+		if _, err := New(opts); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+}
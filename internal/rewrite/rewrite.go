@@ -0,0 +1,234 @@
+// Package rewrite transforms forwarded requests and the upstream responses to them.
+package rewrite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// ErrInvalidRule is returned for rules that cannot be compiled
+var ErrInvalidRule = errors.New("invalid rewrite rule")
+
+// Rule rewrites the requests it matches before they are forwarded and the responses to them.
+type Rule struct {
+	// Name is a human readable description
+	Name     string   `json:"name,omitempty"`
+	Match    Match    `json:"match"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Match holds the conditions a received request must meet. Empty conditions match everything.
+type Match struct {
+	Method string `json:"method,omitempty"`
+	// Path is a glob, see store.MatchGlob
+	Path string `json:"path,omitempty"`
+	// PathRegex is a regular expression the whole path must match
+	PathRegex string `json:"path_regex,omitempty"`
+	// Headers map names to required values; an empty value only requires presence
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Request describes how a matching request is changed before it is forwarded.
+type Request struct {
+	Path    *Path   `json:"path,omitempty"`
+	Headers Headers `json:"headers"`
+	// Host replaces the Host header sent to the upstream
+	Host string `json:"host,omitempty"`
+}
+
+// Path replaces every match of Regex in the path with Replacement, which may refer to groups as $1 or ${name}.
+type Path struct {
+	Regex       string `json:"regex"`
+	Replacement string `json:"replacement"`
+}
+
+// Response describes how the upstream response to a matching request is changed before it is returned.
+type Response struct {
+	Headers Headers `json:"headers"`
+}
+
+// Headers are header changes, applied in the order remove, rename, set, add.
+type Headers struct {
+	// Remove deletes headers; names may be globs such as X-GitHub-*
+	Remove []string `json:"remove,omitempty"`
+	// Rename moves the values of a header to another name
+	Rename map[string]string `json:"rename,omitempty"`
+	// Set replaces the values of a header
+	Set map[string]string `json:"set,omitempty"`
+	// Add appends a value to a header
+	Add map[string]string `json:"add,omitempty"`
+}
+
+// Rules are rewrite rules applied in order. Every matching rule is applied, not only the first.
+type Rules struct {
+	rules []*compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	pathRegex    *regexp.Regexp
+	rewriteRegex *regexp.Regexp
+}
+
+// New compiles rewrite rules.
+func New(rules []Rule) (*Rules, error) {
+	rs := &Rules{rules: make([]*compiledRule, 0, len(rules))}
+	for i, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Name, err)
+		}
+		rs.rules = append(rs.rules, c)
+	}
+	return rs, nil
+}
+
+// LoadFile compiles the JSON array of rewrite rules in the given file.
+func LoadFile(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rewrite rules file: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rewrite rules file %s: %w", path, err)
+	}
+
+	rs, err := New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("load rewrite rules file %s: %w", path, err)
+	}
+	return rs, nil
+}
+
+func compileRule(rule Rule) (*compiledRule, error) {
+	c := &compiledRule{Rule: rule}
+
+	var err error
+	if rule.Match.PathRegex != "" {
+		if c.pathRegex, err = regexp.Compile("^(?:" + rule.Match.PathRegex + ")$"); err != nil {
+			return nil, fmt.Errorf("%w: path_regex: %w", ErrInvalidRule, err)
+		}
+	}
+	if p := rule.Request.Path; p != nil {
+		if p.Regex == "" {
+			return nil, fmt.Errorf("%w: path rewrite without regex", ErrInvalidRule)
+		}
+		if c.rewriteRegex, err = regexp.Compile(p.Regex); err != nil {
+			return nil, fmt.Errorf("%w: path regex: %w", ErrInvalidRule, err)
+		}
+	}
+	for _, h := range []Headers{rule.Request.Headers, rule.Response.Headers} {
+		for name, to := range h.Rename {
+			if name == "" || to == "" {
+				return nil, fmt.Errorf("%w: empty header name in rename", ErrInvalidRule)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Match returns the rewrites of all rules matching a received request, in rule order.
+// It is safe to call on nil Rules.
+func (rs *Rules) Match(method, path string, header http.Header) Rewrites {
+	if rs == nil {
+		return nil
+	}
+
+	var matched Rewrites
+	for _, rule := range rs.rules {
+		if rule.matches(method, path, header) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+func (c *compiledRule) matches(method, path string, header http.Header) bool {
+	m := c.Match
+	if m.Method != "" && !strings.EqualFold(m.Method, method) {
+		return false
+	}
+	if m.Path != "" && !store.MatchGlob(m.Path, path) {
+		return false
+	}
+	if c.pathRegex != nil && !c.pathRegex.MatchString(path) {
+		return false
+	}
+	for name, value := range m.Headers {
+		values := header.Values(name)
+		if len(values) == 0 || value != "" && !contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Rewrites are the rules matching a request.
+type Rewrites []*compiledRule
+
+// Request rewrites the path and headers of a request about to be forwarded and returns the Host to send,
+// empty to keep it. The path is rewritten before the upstream path is prepended.
+func (rw Rewrites) Request(u *url.URL, header http.Header) string {
+	host := ""
+	for _, rule := range rw {
+		if rule.rewriteRegex != nil {
+			u.Path = rule.rewriteRegex.ReplaceAllString(u.Path, rule.Request.Path.Replacement)
+			u.RawPath = ""
+		}
+		rule.Request.Headers.apply(header)
+		if rule.Request.Host != "" {
+			host = rule.Request.Host
+		}
+	}
+	return host
+}
+
+// Response rewrites the headers of an upstream response.
+func (rw Rewrites) Response(header http.Header) {
+	for _, rule := range rw {
+		rule.Response.Headers.apply(header)
+	}
+}
+
+func (h Headers) apply(header http.Header) {
+	for _, pattern := range h.Remove {
+		pattern = http.CanonicalHeaderKey(pattern)
+		for name := range header {
+			if store.MatchGlob(pattern, http.CanonicalHeaderKey(name)) {
+				delete(header, name)
+			}
+		}
+	}
+	for from, to := range h.Rename {
+		if values := header.Values(from); len(values) > 0 {
+			header.Del(from)
+			header[http.CanonicalHeaderKey(to)] = values
+		}
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package rewrite
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRules_Match(t *testing.T) {
+	rs, err := New([]Rule{
+		{Name: "all"},
+		{Name: "github", Match: Match{Method: "post", Path: "/webhooks/github"}},
+		{Name: "regex", Match: Match{PathRegex: `/webhooks/\w+`}},
+		{Name: "header", Match: Match{Headers: map[string]string{"X-GitHub-Event": "push"}}},
+		{Name: "presence", Match: Match{Headers: map[string]string{"X-Stripe-Signature": ""}}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		want   []string
+	}{
+		{"everything", "POST", "/webhooks/github", http.Header{"X-Github-Event": {"push"}}, []string{"all", "github", "regex", "header"}},
+		{"method", "GET", "/webhooks/github", nil, []string{"all", "regex"}},
+		{"regex is anchored", "POST", "/api/webhooks/stripe", nil, []string{"all"}},
+		{"header value", "GET", "/", http.Header{"X-Github-Event": {"ping"}}, []string{"all"}},
+		{"header presence", "GET", "/", http.Header{"X-Stripe-Signature": {"t=1"}}, []string{"all", "presence"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, rule := range rs.Match(tt.method, tt.path, tt.header) {
+				got = append(got, rule.Name)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	var nilRules *Rules
+	if matched := nilRules.Match("GET", "/", nil); matched != nil {
+		t.Errorf("Expected no rewrites for nil rules, got %d", len(matched))
+	}
+}
+
+func TestRewrites_Request(t *testing.T) {
+	rs, err := New([]Rule{
+		{
+			Match: Match{Path: "/webhooks/*"},
+			Request: Request{
+				Path: &Path{Regex: `^/webhooks/(?P<provider>\w+)$`, Replacement: "/internal/${provider}/events"},
+				Headers: Headers{
+					Remove: []string{"x-github-*"},
+					Rename: map[string]string{"X-Hub-Signature-256": "X-Signature"},
+					Set:    map[string]string{"X-Source": "raccoon"},
+				},
+				Host: "events.internal",
+			},
+		},
+		{
+			Request: Request{
+				Path:    &Path{Regex: `^/internal`, Replacement: "/v2"},
+				Headers: Headers{Add: map[string]string{"X-Source": "gateway"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	header := http.Header{
+		"X-Github-Event":      {"push"},
+		"X-Github-Delivery":   {"abc"},
+		"X-Hub-Signature-256": {"sha256=1"},
+		"Content-Type":        {"application/json"},
+	}
+	u := &url.URL{Path: "/webhooks/github"}
+	host := rs.Match("POST", u.Path, header).Request(u, header)
+
+	if u.Path != "/v2/github/events" {
+		t.Errorf("Expected the path to be rewritten by both rules, got %s", u.Path)
+	}
+	if host != "events.internal" {
+		t.Errorf("Expected host events.internal, got %q", host)
+	}
+	if header.Get("X-Github-Event") != "" || header.Get("X-Github-Delivery") != "" || header.Get("X-Hub-Signature-256") != "" {
+		t.Errorf("Expected provider headers to be removed, got %v", header)
+	}
+	if header.Get("X-Signature") != "sha256=1" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected renamed and untouched headers, got %v", header)
+	}
+	if values := header.Values("X-Source"); len(values) != 2 || values[0] != "raccoon" || values[1] != "gateway" {
+		t.Errorf("Expected set then added values, got %v", values)
+	}
+}
+
+func TestRewrites_Response(t *testing.T) {
+	rs, err := New([]Rule{{
+		Match: Match{Path: "/api/**"},
+		Response: Response{Headers: Headers{
+			Remove: []string{"Server", "X-Powered-By"},
+			Set:    map[string]string{"Cache-Control": "no-store"},
+		}},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	header := http.Header{"Server": {"nginx"}, "X-Powered-By": {"PHP"}, "Cache-Control": {"max-age=60"}}
+	rs.Match("GET", "/api/users/1", nil).Response(header)
+	if len(header) != 1 || header.Get("Cache-Control") != "no-store" {
+		t.Errorf("Unexpected response headers %v", header)
+	}
+
+	header = http.Header{"Server": {"nginx"}}
+	rs.Match("GET", "/health", nil).Response(header)
+	if header.Get("Server") != "nginx" {
+		t.Errorf("Expected headers of unmatched requests to stay, got %v", header)
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"path regex", Rule{Match: Match{PathRegex: "("}}},
+		{"rewrite regex", Rule{Request: Request{Path: &Path{Regex: "[", Replacement: "/"}}}},
+		{"rewrite without regex", Rule{Request: Request{Path: &Path{Replacement: "/"}}}},
+		{"empty rename", Rule{Response: Response{Headers: Headers{Rename: map[string]string{"Server": ""}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Rule{tt.rule}); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Expected ErrInvalidRule, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rewrites.json")
+	data := `[{"match": {"path": "/webhooks/github"}, "request": {"path": {"regex": "^/webhooks", "replacement": "/hooks"}}}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	u := &url.URL{Path: "/webhooks/github"}
+	rs.Match("POST", u.Path, nil).Request(u, http.Header{})
+	if u.Path != "/hooks/github" {
+		t.Errorf("Expected /hooks/github, got %s", u.Path)
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+	if err := os.WriteFile(path, []byte(`{"rules": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected error for an invalid file")
+	}
+}
@@ -1,14 +1,34 @@
 package server
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/czechbol/request-raccoon/internal/api"
 	"github.com/czechbol/request-raccoon/internal/config"
+	"github.com/czechbol/request-raccoon/internal/dashboard"
+	"github.com/czechbol/request-raccoon/internal/dedup"
+	"github.com/czechbol/request-raccoon/internal/diff"
 	"github.com/czechbol/request-raccoon/internal/handler"
+	"github.com/czechbol/request-raccoon/internal/handshake"
 	"github.com/czechbol/request-raccoon/internal/middleware"
+	"github.com/czechbol/request-raccoon/internal/mirror"
+	"github.com/czechbol/request-raccoon/internal/mock"
+	"github.com/czechbol/request-raccoon/internal/proxy"
+	"github.com/czechbol/request-raccoon/internal/relay"
+	"github.com/czechbol/request-raccoon/internal/replay"
+	"github.com/czechbol/request-raccoon/internal/rewrite"
+	"github.com/czechbol/request-raccoon/internal/signature"
+	"github.com/czechbol/request-raccoon/internal/store"
+	"github.com/czechbol/request-raccoon/internal/stream"
+	"github.com/czechbol/request-raccoon/internal/vcr"
 )
 
 // Server holds the HTTP server and its dependencies
@@ -16,45 +36,375 @@ type Server struct {
 	config     config.Config
 	middleware *middleware.Manager
 	handler    *handler.Handler
+	handshakes *handshake.Responder
+	api        *api.API
+	store      store.Store
+	// stores holds the captured request store and the stores of queues, closed on shutdown
+	stores     []store.Store
+	events     *stream.Hub
+	duplicates *dedup.Detector
+	mocks      *mock.Engine
+	verifiers  *signature.Verifiers
+	upstream   *proxy.Proxy
+	mirror     *mirror.Mirror
+	differ     *diff.Differ
+	recorder   *vcr.Recorder
+	player     *vcr.Player
+	relay      *relay.Queue
 	server     *http.Server
 }
 
 // New creates a new server instance with configuration
-func New(cfg config.Config) *Server {
-	// Create middleware manager
-	middlewareManager := middleware.NewManager(cfg)
-
-	// Create handlers
-	h := handler.New()
+func New(cfg config.Config) (*Server, error) {
+	// Create the store holding captured requests
+	st, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
 
+	// Create middleware manager publishing captured requests to live streams
+	events := stream.NewHub()
+	events.AllowOrigins(cfg.StreamOrigins)
 	s := &Server{
 		config:     cfg,
-		middleware: middlewareManager,
-		handler:    h,
+		middleware: middleware.NewManager(cfg, st),
+		handler:    handler.New(),
+		api:        api.New(st, events),
+		store:      st,
+		stores:     []store.Store{st},
+		events:     events,
+		mocks:      mock.NewEngine(),
+	}
+	s.middleware.OnCapture(events.Publish)
+
+	// Each feature is set up from the configuration. The mirror comes last, since its workers start right away,
+	// and stores opened so far are closed again when the server cannot be created.
+	for _, setup := range []func() error{
+		s.setupRules,
+		s.setupUpstream,
+		s.setupVCR,
+		s.setupDuplicates,
+		s.setupRelay,
+		s.setupHandshakes,
+		s.setupMirror,
+	} {
+		if err := setup(); err != nil {
+			_ = closeAll(s.stores)
+			return nil, err
+		}
 	}
 
 	s.setupRoutes()
-	return s
+	return s, nil
+}
+
+// setupRules loads the mock response and signature rules
+func (s *Server) setupRules() error {
+	if s.config.MockRulesFile != "" {
+		if err := s.mocks.LoadFile(s.config.MockRulesFile); err != nil {
+			return err
+		}
+	}
+
+	// Verify webhook signatures
+	if s.config.SignatureRulesFile != "" {
+		verifiers, err := signature.LoadFile(s.config.SignatureRulesFile)
+		if err != nil {
+			return err
+		}
+		s.verifiers = verifiers
+	}
+	return nil
+}
+
+// setupUpstream forwards requests without a mock to the upstream when one is configured, rewriting them and
+// their responses, and parks failed deliveries as dead letters
+func (s *Server) setupUpstream() error {
+	cfg := s.config
+	if cfg.UpstreamURL == "" {
+		if cfg.RewriteRulesFile != "" {
+			return errors.New("REWRITE_RULES_FILE requires UPSTREAM_URL to forward requests to")
+		}
+		return nil
+	}
+
+	var rewrites *rewrite.Rules
+	if cfg.RewriteRulesFile != "" {
+		var err error
+		if rewrites, err = rewrite.LoadFile(cfg.RewriteRulesFile); err != nil {
+			return err
+		}
+	}
+
+	deadLetters, err := newQueueStore(cfg, "deadletters", cfg.DeadLetterSize)
+	if err != nil {
+		return err
+	}
+	s.stores = append(s.stores, deadLetters)
+
+	s.upstream, err = proxy.New(cfg.UpstreamURL, proxy.Options{
+		Timeout:        cfg.UpstreamTimeout,
+		Retries:        cfg.UpstreamRetries,
+		RetryStatuses:  cfg.RetryStatuses,
+		Backoff:        cfg.RetryBackoff,
+		MaxBackoff:     cfg.RetryMaxBackoff,
+		DeadLetterSize: cfg.DeadLetterSize,
+		DeadLetters:    deadLetters,
+		Rewrites:       rewrites,
+	})
+	return err
+}
+
+// setupVCR records upstream exchanges to a cassette or plays them back
+func (s *Server) setupVCR() error {
+	cfg := s.config
+	switch cfg.VCRMode {
+	case "":
+		return nil
+	case vcr.ModeRecord:
+		if s.upstream == nil {
+			return errors.New("VCR_MODE=record requires UPSTREAM_URL to record from")
+		}
+		s.recorder = vcr.NewRecorder(cfg.VCRCassette)
+		return nil
+	case vcr.ModePlayback:
+		var err error
+		s.player, err = vcr.NewPlayer(cfg.VCRCassette, cfg.VCRMatch, cfg.VCRStrict)
+		return err
+	default:
+		return fmt.Errorf("unknown VCR mode %q", cfg.VCRMode)
+	}
+}
+
+// setupDuplicates flags repeated deliveries, including repeats of requests kept from before a restart
+func (s *Server) setupDuplicates() error {
+	if !s.config.Dedup {
+		return nil
+	}
+
+	window := s.config.DedupWindow
+	if window <= 0 {
+		window = dedup.DefaultWindow
+	}
+	s.duplicates = dedup.New(dedup.Options{
+		Window:  window,
+		MaxKeys: s.config.DedupMaxKeys,
+		Headers: s.config.DedupHeaders,
+	})
+	requests, err := s.store.List(store.Filter{Since: time.Now().Add(-window)})
+	if err != nil {
+		return fmt.Errorf("load captured requests for duplicate detection: %w", err)
+	}
+	s.duplicates.Load(requests)
+	s.middleware.DetectDuplicates(s.duplicates)
+	return nil
+}
+
+// setupRelay holds captured requests for pull clients in relay mode
+func (s *Server) setupRelay() error {
+	if !s.config.Relay {
+		return nil
+	}
+
+	queued, err := newQueueStore(s.config, "relay", s.config.RelayQueueSize)
+	if err != nil {
+		return err
+	}
+	s.stores = append(s.stores, queued)
+	s.relay = relay.NewQueue(queued, s.config.RelayLease, s.config.RelayQueueSize)
+	s.middleware.OnCapture(s.relay.Add)
+	return nil
+}
+
+// setupHandshakes answers webhook provider handshakes that would otherwise get the universal response
+func (s *Server) setupHandshakes() error {
+	if s.config.Handshakes {
+		s.handshakes = handshake.New(handshake.Options{
+			TwitterSecret:   string(s.config.TwitterSecret),
+			ZoomSecret:      string(s.config.ZoomSecret),
+			MetaVerifyToken: string(s.config.MetaVerifyToken),
+			ConfirmSNS:      s.config.SNSConfirm,
+		})
+	}
+	return nil
+}
+
+// setupMirror mirrors captured requests to shadow targets, including the candidate upstream responses are
+// compared with
+func (s *Server) setupMirror() error {
+	cfg := s.config
+	targets := cfg.MirrorTargets
+	if cfg.DiffTarget != "" {
+		if s.upstream == nil {
+			return errors.New("DIFF_TARGET requires UPSTREAM_URL to compare responses with")
+		}
+		if !slices.Contains(targets, cfg.DiffTarget) {
+			targets = append(slices.Clone(targets), cfg.DiffTarget)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var err error
+	s.mirror, err = mirror.New(targets, mirror.Options{
+		Timeout:     cfg.MirrorTimeout,
+		Concurrency: cfg.MirrorConcurrency,
+		QueueSize:   cfg.MirrorQueueSize,
+	})
+	if err != nil {
+		return err
+	}
+	s.middleware.OnCapture(s.mirror.Mirror)
+
+	if cfg.DiffTarget != "" {
+		s.differ = diff.New(s.store, cfg.DiffTarget, diff.Options{
+			Headers: cfg.DiffHeaders,
+			Ignore:  cfg.DiffIgnore,
+		})
+		s.mirror.OnResult(s.differ.Observe)
+	}
+	return nil
+}
+
+// newStore creates the captured request store selected by the configuration
+func newStore(cfg config.Config) (store.Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return store.NewMemory(cfg.StoreMaxRequests, cfg.StoreMaxBytes), nil
+	case "disk":
+		st, err := store.NewDisk(cfg.StorePath, store.DiskOptions{
+			MaxRequests: cfg.StoreMaxRequests,
+			MaxBytes:    cfg.StoreMaxBytes,
+			MaxAge:      cfg.StoreMaxAge,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("open disk store: %w", err)
+		}
+		return st, nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
+}
+
+// newQueueStore creates the store of a queue of captured requests holding up to size requests.
+// With the disk store it is kept in a subdirectory of the store path, so the queue survives restarts.
+func newQueueStore(cfg config.Config, name string, size int) (store.Store, error) {
+	if cfg.Store != "disk" {
+		return store.NewMemory(size, cfg.StoreMaxBytes), nil
+	}
+	st, err := store.NewDisk(filepath.Join(cfg.StorePath, name), store.DiskOptions{
+		MaxRequests: size,
+		MaxBytes:    cfg.StoreMaxBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open %s store: %w", name, err)
+	}
+	return st, nil
+}
+
+// closeAll closes every store, returning their errors
+func closeAll(stores []store.Store) error {
+	var errs []error
+	for _, st := range stores {
+		errs = append(errs, st.Close())
+	}
+	return errors.Join(errs...)
 }
 
 // setupRoutes configures all HTTP routes and middleware
 func (s *Server) setupRoutes() {
 	mux := http.NewServeMux()
 
-	// Health check endpoints
-	mux.HandleFunc("/health", s.handler.Health)
+	// Health check endpoints are logged but not captured
+	mux.Handle("/health", middleware.NewManager(s.config, nil).Logging(http.HandlerFunc(s.handler.Health)))
 
-	// Catch-all handler for logging all other requests
-	mux.HandleFunc("/", s.handler.Universal)
+	// Admin API endpoints, which require the admin token when one is set
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET "+api.Prefix+"/api/requests", s.api.ListRequests)
+	admin.HandleFunc("DELETE "+api.Prefix+"/api/requests", s.api.ClearRequests)
+	admin.HandleFunc("GET "+api.Prefix+"/api/requests/{id}", s.api.GetRequest)
+	admin.HandleFunc("DELETE "+api.Prefix+"/api/requests/{id}", s.api.DeleteRequest)
+	admin.HandleFunc("GET "+api.Prefix+"/api/verify", s.api.Verify)
+	admin.HandleFunc("GET "+api.Prefix+"/api/wait", s.api.Wait)
+	admin.HandleFunc("POST "+api.Prefix+"/api/replay", replay.NewAPI(s.store).Replay)
+	admin.HandleFunc("GET "+api.Prefix+"/api/stream", s.events.ServeSSE)
+	admin.HandleFunc("GET "+api.Prefix+"/api/ws", s.events.ServeWebSocket)
 
-	// Apply middleware in the correct order
-	finalHandler := s.middleware.Logging(mux)
+	mockAPI := mock.NewAPI(s.mocks)
+	admin.HandleFunc("GET "+api.Prefix+"/api/mocks", mockAPI.ListRules)
+	admin.HandleFunc("POST "+api.Prefix+"/api/mocks", mockAPI.CreateRule)
+	admin.HandleFunc("PUT "+api.Prefix+"/api/mocks", mockAPI.ReplaceRules)
+	admin.HandleFunc("POST "+api.Prefix+"/api/mocks/reload", mockAPI.ReloadRules)
+	admin.HandleFunc("GET "+api.Prefix+"/api/mocks/{id}", mockAPI.GetRule)
+	admin.HandleFunc("PUT "+api.Prefix+"/api/mocks/{id}", mockAPI.UpdateRule)
+	admin.HandleFunc("DELETE "+api.Prefix+"/api/mocks/{id}", mockAPI.DeleteRule)
+	admin.HandleFunc("GET "+api.Prefix+"/api/scenarios", mockAPI.ListScenarios)
+	admin.HandleFunc("DELETE "+api.Prefix+"/api/scenarios", mockAPI.ResetScenarios)
+	admin.HandleFunc("PUT "+api.Prefix+"/api/scenarios/{name}", mockAPI.SetScenarioState)
+	admin.HandleFunc("DELETE "+api.Prefix+"/api/scenarios/{name}", mockAPI.ResetScenario)
+	if s.upstream != nil {
+		admin.HandleFunc("GET "+api.Prefix+"/api/deadletters", s.upstream.ListDeadLetters)
+		admin.HandleFunc("POST "+api.Prefix+"/api/deadletters/redrive", s.upstream.RedriveDeadLetters)
+		admin.HandleFunc("GET "+api.Prefix+"/api/deadletters/{id}", s.upstream.GetDeadLetter)
+		admin.HandleFunc("DELETE "+api.Prefix+"/api/deadletters/{id}", s.upstream.DeleteDeadLetter)
+		admin.HandleFunc("POST "+api.Prefix+"/api/deadletters/{id}/redrive", s.upstream.RedriveDeadLetter)
+	}
+	if s.duplicates != nil {
+		admin.HandleFunc("GET "+api.Prefix+"/api/duplicates", s.duplicates.ListDuplicates)
+	}
+	if s.mirror != nil {
+		admin.HandleFunc("GET "+api.Prefix+"/api/mirrors", s.mirror.ListTargets)
+	}
+	if s.differ != nil {
+		admin.HandleFunc("GET "+api.Prefix+"/api/diffs", s.differ.Summarize)
+	}
+	admin.HandleFunc(api.Prefix+"/api/", api.NotFound)
+	mux.Handle(api.Prefix+"/api/", api.RequireToken(string(cmp.Or(s.config.AdminToken, s.config.RelayToken)), admin))
+
+	// Relay endpoints check their own token, so pull clients do not need the admin token
+	if s.relay != nil {
+		relayAPI := relay.NewAPI(s.relay, string(cmp.Or(s.config.RelayToken, s.config.AdminToken)))
+		mux.HandleFunc("GET "+api.Prefix+"/api/relay", relayAPI.Status)
+		mux.HandleFunc("GET "+api.Prefix+"/api/relay/pull", relayAPI.Pull)
+		mux.HandleFunc("POST "+api.Prefix+"/api/relay/{id}/ack", relayAPI.Acknowledge)
+	}
+	mux.HandleFunc(api.Prefix+"/", api.NotFound)
+
+	// Web dashboard
+	mux.Handle("GET "+api.Prefix+"/ui/", http.StripPrefix(api.Prefix+"/ui", dashboard.Handler()))
+	mux.Handle("GET "+api.Prefix+"/{$}", http.RedirectHandler(api.Prefix+"/ui/", http.StatusFound))
+
+	// Catch-all handler for logging and capturing all other requests, checked against signature
+	// rules and answered by the first matching mock rule, a recorded interaction in playback mode,
+	// a webhook handshake answer, the upstream in forwarding mode or the universal handler
+	var fallback http.Handler = http.HandlerFunc(s.handler.Universal)
+	if s.upstream != nil {
+		fallback = s.upstream
+	}
+	if s.handshakes != nil {
+		fallback = s.handshakes.Handler(fallback)
+	}
+	if s.recorder != nil {
+		fallback = s.recorder.Handler(fallback)
+	}
+	if s.player != nil {
+		fallback = s.player.Handler(fallback)
+	}
+	catchAll := s.mocks.Handler(fallback)
+	if s.verifiers != nil {
+		catchAll = s.verifiers.Handler(catchAll)
+	}
+	mux.Handle("/", s.middleware.Logging(catchAll))
 
 	s.server = &http.Server{
 		Addr:              s.config.Host + ":" + s.config.Port,
-		Handler:           finalHandler,
+		Handler:           mux,
 		ReadHeaderTimeout: 10 * time.Second, // Set a read header timeout
 	}
+
+	// Live streams never become idle, so end them when shutdown starts
+	s.server.RegisterOnShutdown(s.events.Close)
 }
 
 // Start starts the HTTP server
@@ -69,5 +419,19 @@ func (s *Server) Start() error {
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	slog.Info("Shutting down HTTP logger server")
-	return s.server.Shutdown(ctx)
+	if err := s.server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if s.mirror != nil {
+		// Give queued mirrored requests a chance to go out
+		if err := s.mirror.Close(ctx); err != nil {
+			slog.Warn("Mirrored requests still queued at shutdown", "error", err)
+		}
+	}
+	if s.recorder != nil {
+		if err := s.recorder.Close(); err != nil {
+			slog.Error("Failed to write cassette at shutdown", "error", err, "cassette", s.config.VCRCassette)
+		}
+	}
+	return closeAll(s.stores)
 }
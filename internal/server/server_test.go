@@ -1,15 +1,33 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/czechbol/request-raccoon/internal/config"
+	"github.com/czechbol/request-raccoon/internal/store"
 )
 
+func newTestServer(t *testing.T, cfg config.Config) *Server {
+	t.Helper()
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return server
+}
+
 func TestServer_SetupRoutes(t *testing.T) {
 	cfg := config.Config{
 		Port:              "8080",
@@ -18,7 +36,7 @@ func TestServer_SetupRoutes(t *testing.T) {
 		EnableRequestBody: true,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Test that server address is correctly set
 	expectedAddr := cfg.Host + ":" + cfg.Port
@@ -40,7 +58,7 @@ func TestServer_HealthEndpoint(t *testing.T) {
 		EnableRequestBody: false,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Create a test request for the health endpoint
 	req := httptest.NewRequest("GET", "/health", nil)
@@ -74,7 +92,7 @@ func TestServer_UniversalEndpoint(t *testing.T) {
 		EnableRequestBody: false,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	tests := []struct {
 		name   string
@@ -137,7 +155,7 @@ func TestServer_MiddlewareIntegration(t *testing.T) {
 		EnableRequestBody: true,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Test with a request that has a body
 	req := httptest.NewRequest("POST", "/test", nil)
@@ -180,7 +198,7 @@ func TestServer_ConfigIntegration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			server := New(tt.config)
+			server := newTestServer(t, tt.config)
 
 			expectedAddr := tt.config.Host + ":" + tt.config.Port
 			if server.server.Addr != expectedAddr {
@@ -206,7 +224,7 @@ func TestServer_Shutdown(t *testing.T) {
 		EnableRequestBody: false,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Start server in a goroutine
 	errChan := make(chan error, 1)
@@ -246,7 +264,7 @@ func TestServer_ShutdownTimeout(t *testing.T) {
 		EnableRequestBody: false,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Start server in a goroutine
 	errChan := make(chan error, 1)
@@ -290,7 +308,7 @@ func TestServer_HandlerChain(t *testing.T) {
 		EnableRequestBody: true,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Test that middleware is properly chained with handlers
 	req := httptest.NewRequest("GET", "/health", nil)
@@ -319,7 +337,7 @@ func TestServer_RouteSpecificity(t *testing.T) {
 		EnableRequestBody: false,
 	}
 
-	server := New(cfg)
+	server := newTestServer(t, cfg)
 
 	// Test that /health is handled by health handler, not universal
 	healthReq := httptest.NewRequest("GET", "/health", nil)
@@ -352,3 +370,804 @@ func TestServer_RouteSpecificity(t *testing.T) {
 		t.Error("Health and universal endpoints should return different responses")
 	}
 }
+
+func TestServer_CapturesRequests(t *testing.T) {
+	cfg := config.Config{
+		Port:              "8080",
+		Host:              "localhost",
+		LogLevel:          "info",
+		EnableRequestBody: true,
+	}
+
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"event":"test"}`))
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	healthReq := httptest.NewRequest("GET", "/health", nil)
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), healthReq)
+
+	list, err := server.store.List(store.Filter{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 captured request, got %d", len(list))
+	}
+	if list[0].Path != "/webhook" {
+		t.Errorf("Expected captured path /webhook, got %s", list[0].Path)
+	}
+}
+
+func TestServer_LogsHealthChecks(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	server := newTestServer(t, config.Config{})
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	if !strings.Contains(logs.String(), `"path":"/health"`) {
+		t.Errorf("Expected the health check to be logged, got %s", logs.String())
+	}
+	if list, _ := server.store.List(store.Filter{}); len(list) != 0 {
+		t.Errorf("Expected the health check not to be captured, got %d requests", len(list))
+	}
+}
+
+func TestServer_AdminAPI(t *testing.T) {
+	cfg := config.Config{
+		Port:              "8080",
+		Host:              "localhost",
+		LogLevel:          "info",
+		EnableRequestBody: true,
+	}
+
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"event":"test"}`))
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	listReq := httptest.NewRequest("GET", "/_raccoon/api/requests?path=/webhook", nil)
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, listReq)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"total":1`) {
+		t.Errorf("Expected one listed request, got %s", rr.Body.String())
+	}
+
+	unknownReq := httptest.NewRequest("POST", "/_raccoon/unknown", nil)
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, unknownReq)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown admin path, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// Admin API calls are not captured themselves
+	if server.store.Len() != 1 {
+		t.Errorf("Expected 1 captured request, got %d", server.store.Len())
+	}
+}
+
+func TestServer_DiskStore(t *testing.T) {
+	cfg := config.Config{
+		Port:              "0",
+		Host:              "localhost",
+		LogLevel:          "info",
+		EnableRequestBody: true,
+		Store:             "disk",
+		StorePath:         t.TempDir(),
+	}
+
+	server := newTestServer(t, cfg)
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"event":"test"}`))
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// A new server on the same path sees the request captured before the restart
+	restarted := newTestServer(t, cfg)
+	defer restarted.Shutdown(context.Background())
+	if restarted.store.Len() != 1 {
+		t.Errorf("Expected 1 captured request after restart, got %d", restarted.store.Len())
+	}
+}
+
+func TestServer_UnknownStore(t *testing.T) {
+	cfg := config.Config{
+		Port:  "8080",
+		Host:  "localhost",
+		Store: "redis",
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for unknown store")
+	}
+}
+
+func TestServer_Dashboard(t *testing.T) {
+	cfg := config.Config{
+		Port: "8080",
+		Host: "localhost",
+	}
+
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("GET", "/_raccoon/ui/", nil)
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected HTML dashboard, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	req = httptest.NewRequest("GET", "/_raccoon/", nil)
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "/_raccoon/ui/" {
+		t.Errorf("Expected redirect to dashboard, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if server.store.Len() != 0 {
+		t.Errorf("Expected dashboard requests not to be captured, got %d", server.store.Len())
+	}
+}
+
+func TestServer_ShutdownEndsEventStreams(t *testing.T) {
+	cfg := config.Config{
+		Port: "0",
+		Host: "127.0.0.1",
+	}
+
+	server := newTestServer(t, cfg)
+	ts := httptest.NewServer(server.server.Handler)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/_raccoon/api/stream")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	// A captured request reaches the stream
+	ts.Client().Post(ts.URL+"/webhook", "application/json", strings.NewReader(`{}`))
+	buf := make([]byte, 4096)
+	n, _ := resp.Body.Read(buf)
+	for !strings.Contains(string(buf[:n]), "event: request") {
+		m, err := resp.Body.Read(buf[n:])
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		n += m
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, resp.Body)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected event stream to end on shutdown")
+	}
+}
+
+func TestServer_MockRules(t *testing.T) {
+	dir := t.TempDir()
+	rulesFile := filepath.Join(dir, "mocks.json")
+	rules := `[{"id":"create-charge","match":{"method":"POST","path":"/v1/charges"},
+		"response":{"status":402,"headers":{"Content-Type":"application/json"},"body":"{\"error\":\"card_declined\"}"}}]`
+	if err := os.WriteFile(rulesFile, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{
+		Port:          "8080",
+		Host:          "localhost",
+		LogLevel:      "info",
+		MockRulesFile: rulesFile,
+	}
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/v1/charges", strings.NewReader(`{"amount":100}`))
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("Expected status %d, got %d", http.StatusPaymentRequired, rr.Code)
+	}
+	if rr.Body.String() != `{"error":"card_declined"}` {
+		t.Errorf("Unexpected mock body %s", rr.Body.String())
+	}
+
+	// Unmatched requests still get the universal response
+	req = httptest.NewRequest("GET", "/v1/charges", nil)
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"success"`) {
+		t.Errorf("Expected universal response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	list, err := server.store.List(store.Filter{Method: "POST"})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected 1 captured POST request, got %d (%v)", len(list), err)
+	}
+	if list[0].MockRule != "create-charge" || list[0].Response.Status != http.StatusPaymentRequired {
+		t.Errorf("Expected capture to record mock rule and status, got %q %d", list[0].MockRule, list[0].Response.Status)
+	}
+
+	// Rules can be listed through the admin API
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/mocks", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"create-charge"`) {
+		t.Errorf("Expected rule listing, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServer_InvalidMockRulesFile(t *testing.T) {
+	cfg := config.Config{
+		Port:          "8080",
+		Host:          "localhost",
+		MockRulesFile: filepath.Join(t.TempDir(), "missing.json"),
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for missing mock rules file")
+	}
+}
+
+func TestServer_ForwardsToUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, `{"upstream":"`+r.URL.Path+`"}`)
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Port:              "8080",
+		Host:              "localhost",
+		EnableRequestBody: true,
+		BodyCaptureMax:    1 << 20,
+		UpstreamURL:       upstream.URL,
+		UpstreamTimeout:   time.Second,
+	}
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"event":"test"}`))
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted || rr.Body.String() != `{"upstream":"/webhook"}` {
+		t.Fatalf("Expected upstream response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	list, err := server.store.List(store.Filter{})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("Expected 1 captured request, got %d (%v)", len(list), err)
+	}
+	captured := list[0]
+	if string(captured.Body) != `{"event":"test"}` {
+		t.Errorf("Expected request body to be captured, got %s", captured.Body)
+	}
+	if captured.Upstream == nil || captured.Upstream.Status != http.StatusAccepted {
+		t.Fatalf("Expected upstream response to be captured, got %+v", captured.Upstream)
+	}
+	if string(captured.Upstream.Body) != `{"upstream":"/webhook"}` {
+		t.Errorf("Unexpected captured upstream body %s", captured.Upstream.Body)
+	}
+}
+
+func TestServer_InvalidUpstream(t *testing.T) {
+	cfg := config.Config{
+		Port:        "8080",
+		Host:        "localhost",
+		UpstreamURL: "not a url",
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for invalid upstream URL")
+	}
+}
+
+func TestServer_MirrorsRequests(t *testing.T) {
+	mirrored := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.URL.Path + " " + string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer shadow.Close()
+
+	cfg := config.Config{
+		Port:           "0",
+		Host:           "localhost",
+		BodyCaptureMax: 1 << 20,
+		MirrorTargets:  []string{shadow.URL},
+		MirrorTimeout:  time.Second,
+	}
+	server := newTestServer(t, cfg)
+
+	req := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"event":"test"}`))
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"success"`) {
+		t.Errorf("Expected universal response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case got := <-mirrored:
+		if got != `/webhook {"event":"test"}` {
+			t.Errorf("Unexpected mirrored request %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request was not mirrored")
+	}
+
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/mirrors", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), shadow.URL) {
+		t.Errorf("Expected mirror targets, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestServer_DiffsResponses(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"name":"raccoon","at":"1"}`))
+	}))
+	defer primary.Close()
+	candidate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"name":"panda","at":"2"}`))
+	}))
+	defer candidate.Close()
+
+	cfg := config.Config{
+		Port:          "0",
+		Host:          "localhost",
+		UpstreamURL:   primary.URL,
+		MirrorTimeout: time.Second,
+		DiffTarget:    candidate.URL,
+		DiffHeaders:   []string{"Content-Type"},
+		DiffIgnore:    []string{"$.at"},
+	}
+	server := newTestServer(t, cfg)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "raccoon") {
+		t.Fatalf("Expected upstream response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Diffs are recorded once the candidate answered
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	requests, err := server.store.List(store.Filter{})
+	if err != nil || len(requests) != 1 {
+		t.Fatalf("Expected 1 captured request, got %d (%v)", len(requests), err)
+	}
+	d := requests[0].Diff
+	if d == nil || d.Equal || len(d.Differences) != 1 || d.Differences[0].Field != "body:$.name" {
+		t.Fatalf("Expected a name difference, got %+v", d)
+	}
+
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/diffs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"different":1`) {
+		t.Errorf("Expected diff summary, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServer_DiffTargetRequiresUpstream(t *testing.T) {
+	cfg := config.Config{
+		Port:       "8080",
+		Host:       "localhost",
+		DiffTarget: "http://localhost:9090",
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected error for diff target without upstream")
+	}
+}
+
+func TestServer_RecordsAndPlaysBack(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"user":"` + r.URL.Path + `"}`))
+	}))
+	defer upstream.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recording := newTestServer(t, config.Config{
+		Port:        "0",
+		Host:        "localhost",
+		UpstreamURL: upstream.URL,
+		VCRMode:     "record",
+		VCRCassette: cassette,
+	})
+	rr := httptest.NewRecorder()
+	recording.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("Expected the upstream to answer, got %d after %d calls", rr.Code, calls)
+	}
+
+	// The cassette is written at the latest when the server shuts down
+	if err := recording.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	upstream.Close()
+	playback := newTestServer(t, config.Config{
+		Port:        "0",
+		Host:        "localhost",
+		VCRMode:     "playback",
+		VCRCassette: cassette,
+		VCRMatch:    []string{"method", "path"},
+		VCRStrict:   true,
+	})
+
+	rr = httptest.NewRecorder()
+	playback.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"user":"/users/1"}` || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the recorded response, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	playback.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/users/2", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected unmatched request to fail in strict mode, got %d", rr.Code)
+	}
+}
+
+func TestServer_InvalidVCR(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"unknown mode", config.Config{VCRMode: "rewind"}},
+		{"record without upstream", config.Config{VCRMode: "record", VCRCassette: "cassette.json"}},
+		{"missing cassette", config.Config{VCRMode: "playback", VCRCassette: filepath.Join(t.TempDir(), "missing.json")}},
+		{"invalid match key", config.Config{VCRMode: "playback", VCRCassette: "cassette.json", VCRMatch: []string{"host"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestServer_Relay(t *testing.T) {
+	cfg := config.Config{
+		Port:           "0",
+		Host:           "localhost",
+		Relay:          true,
+		RelayToken:     "s3cret",
+		RelayLease:     time.Minute,
+		RelayQueueSize: 10,
+	}
+	server := newTestServer(t, cfg)
+	handler := server.server.Handler
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/hooks/stripe", strings.NewReader(`{"type":"charge"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/relay/pull?wait=0s", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/_raccoon/api/relay/pull?wait=0s", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"path":"/hooks/stripe"`) {
+		t.Errorf("Expected the captured webhook, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Admin requests are not relayed
+	if strings.Contains(rr.Body.String(), "/_raccoon") {
+		t.Errorf("Expected only the webhook, got %s", rr.Body.String())
+	}
+}
+
+func TestServer_AdminToken(t *testing.T) {
+	cfg := config.Config{
+		Port:           "0",
+		Host:           "localhost",
+		AdminToken:     "admin",
+		Relay:          true,
+		RelayToken:     "relay",
+		RelayLease:     time.Minute,
+		RelayQueueSize: 10,
+	}
+	handler := newTestServer(t, cfg).server.Handler
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		token    string
+		expected int
+	}{
+		{"raw requests without token", "GET", "/_raccoon/api/requests?raw=true", "", http.StatusUnauthorized},
+		{"raw requests with relay token", "GET", "/_raccoon/api/requests?raw=true", "relay", http.StatusUnauthorized},
+		{"raw requests with admin token", "GET", "/_raccoon/api/requests?raw=true", "admin", http.StatusOK},
+		{"token in query", "GET", "/_raccoon/api/requests?access_token=admin", "", http.StatusOK},
+		{"replay", "POST", "/_raccoon/api/replay", "", http.StatusUnauthorized},
+		{"mocks", "PUT", "/_raccoon/api/mocks", "", http.StatusUnauthorized},
+		{"stream", "GET", "/_raccoon/api/stream", "", http.StatusUnauthorized},
+		{"unknown endpoint", "GET", "/_raccoon/api/nope", "", http.StatusUnauthorized},
+		{"relay with relay token", "GET", "/_raccoon/api/relay", "relay", http.StatusOK},
+		{"relay with admin token", "GET", "/_raccoon/api/relay", "admin", http.StatusUnauthorized},
+		{"dashboard", "GET", "/_raccoon/ui/", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("Expected %d, got %d %s", tt.expected, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// Without an admin token the relay token protects the whole admin API
+	handler = newTestServer(t, config.Config{Port: "0", Host: "localhost", RelayToken: "relay"}).server.Handler
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/requests", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the relay token to be required, got %d", rr.Code)
+	}
+}
+
+func TestServer_DeadLetters(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var delivered atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		delivered.Store(r.URL.Path + " " + string(body))
+	}))
+	defer upstream.Close()
+
+	cfg := config.Config{
+		Port:            "0",
+		Host:            "localhost",
+		BodyCaptureMax:  1 << 20,
+		Store:           "disk",
+		StorePath:       t.TempDir(),
+		UpstreamURL:     upstream.URL,
+		UpstreamRetries: 1,
+		RetryBackoff:    time.Millisecond,
+	}
+	server := newTestServer(t, cfg)
+
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("POST", "/hooks/orders", strings.NewReader(`{"id":1}`)))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the upstream status, got %d", rr.Code)
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Dead letters are kept with the disk store across restarts
+	server = newTestServer(t, cfg)
+	defer server.Shutdown(context.Background())
+	handler := server.server.Handler
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/deadletters", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"total":1`) || !strings.Contains(rr.Body.String(), `"attempts":2`) {
+		t.Fatalf("Expected one dead letter, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	down.Store(false)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/_raccoon/api/deadletters/redrive", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"delivered":1`) {
+		t.Errorf("Expected the dead letter to be redriven, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got, _ := delivered.Load().(string); got != `/hooks/orders {"id":1}` {
+		t.Errorf("Expected the original request to be delivered, got %q", got)
+	}
+}
+
+func TestServer_RewriteRules(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	rules := filepath.Join(t.TempDir(), "rewrites.json")
+	data := `[{"match": {"path": "/webhooks/github"}, "request": {"path": {"regex": ".*", "replacement": "/internal/github"}}}]`
+	if err := os.WriteFile(rules, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t, config.Config{
+		Port:             "0",
+		Host:             "localhost",
+		UpstreamURL:      upstream.URL,
+		RewriteRulesFile: rules,
+	})
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks/github", nil))
+	if rr.Body.String() != "/internal/github" {
+		t.Errorf("Expected the rewritten path, got %s", rr.Body.String())
+	}
+
+	if _, err := New(config.Config{RewriteRulesFile: rules}); err == nil {
+		t.Error("Expected error for rewrite rules without upstream")
+	}
+	if _, err := New(config.Config{UpstreamURL: upstream.URL, RewriteRulesFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("Expected error for a missing rewrite rules file")
+	}
+}
+
+func TestServer_SignatureVerification(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "signatures.json")
+	data := `[{"path": "/webhooks/github", "provider": "github", "secret": "s3cret", "reject": true}]`
+	if err := os.WriteFile(rules, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer(t, config.Config{
+		Port:               "0",
+		Host:               "localhost",
+		EnableRequestBody:  true,
+		SignatureRulesFile: rules,
+	})
+
+	req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(`{"zen":"hi"}`))
+	req.Header.Set("X-Hub-Signature-256", "sha256=0000")
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an invalid signature, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	server.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+
+	// Rejected requests are still captured with the verification result
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/requests?signature=false", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, `"total":1`) || !strings.Contains(body, `"provider":"github"`) {
+		t.Errorf("Expected the failed request to be listed, got %s", body)
+	}
+
+	if _, err := New(config.Config{SignatureRulesFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("Expected error for a missing signature rules file")
+	}
+}
+
+func TestServer_Handshakes(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		Port:              "0",
+		Host:              "localhost",
+		EnableRequestBody: true,
+		Handshakes:        true,
+	})
+
+	req := httptest.NewRequest("POST", "/slack/events", strings.NewReader(`{"type":"url_verification","challenge":"abc"}`))
+	rr := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"challenge":"abc"}` {
+		t.Errorf("Expected the Slack challenge to be answered, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	requests, err := server.store.List(store.Filter{})
+	if err != nil || len(requests) != 1 || requests[0].Handshake != "slack" {
+		t.Errorf("Expected the handshake to be recorded, got %v", requests)
+	}
+
+	// In forwarding mode enabled handshakes are answered as well, everything else reaches the upstream
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, r.URL.Path+" "+string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	server = newTestServer(t, config.Config{
+		Port:            "0",
+		Host:            "localhost",
+		Handshakes:      true,
+		MetaVerifyToken: "meta-token",
+		UpstreamURL:     upstream.URL,
+	})
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr,
+		httptest.NewRequest("GET", "/meta?hub.mode=subscribe&hub.challenge=42&hub.verify_token=meta-token", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "42" {
+		t.Errorf("Expected the Meta challenge to be answered, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rr, httptest.NewRequest("POST", "/slack/events", strings.NewReader(`{"type":"event_callback"}`)))
+	if rr.Code != http.StatusNoContent || len(forwarded) != 1 || forwarded[0] != `/slack/events {"type":"event_callback"}` {
+		t.Errorf("Expected other requests to reach the upstream with their body, got %d %q", rr.Code, forwarded)
+	}
+}
+
+func TestServer_Duplicates(t *testing.T) {
+	cfg := config.Config{
+		Port:      "0",
+		Host:      "localhost",
+		Store:     "disk",
+		StorePath: t.TempDir(),
+		Dedup:     true,
+	}
+
+	send := func(server *Server) {
+		req := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(`{"action":"opened"}`))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+		req.Header.Set("X-GitHub-Delivery", "72d3162e")
+		server.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	server := newTestServer(t, cfg)
+	send(server)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Deliveries captured before a restart are remembered
+	restarted := newTestServer(t, cfg)
+	defer restarted.Shutdown(context.Background())
+	send(restarted)
+
+	requests, err := restarted.store.List(store.Filter{})
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("Expected 2 captured requests, got %d (%v)", len(requests), err)
+	}
+	dup := requests[0].Duplicate
+	if dup == nil || dup.FirstID != requests[1].ID || dup.Count != 2 || dup.FirstStatus != http.StatusOK {
+		t.Errorf("Expected the redelivery to be flagged, got %+v", dup)
+	}
+
+	rr := httptest.NewRecorder()
+	restarted.server.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/_raccoon/api/duplicates", nil))
+	if !strings.Contains(rr.Body.String(), `"key":"github:72d3162e"`) || !strings.Contains(rr.Body.String(), `"total":1`) {
+		t.Errorf("Expected the duplicated delivery to be listed, got %s", rr.Body.String())
+	}
+}
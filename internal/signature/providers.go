@@ -0,0 +1,301 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // Twilio signs with HMAC-SHA1
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Built-in providers
+const (
+	GitHub     = "github"
+	Stripe     = "stripe"
+	Slack      = "slack"
+	Shopify    = "shopify"
+	Twilio     = "twilio"
+	HMACSHA256 = "hmac-sha256"
+)
+
+// maxFormBody is the largest form body Twilio signatures are checked for, the limit of http.Request.ParseForm
+const maxFormBody = 10 << 20
+
+func init() {
+	Register(GitHub, func(rule Rule) (Verifier, error) {
+		return &hmacVerifier{
+			secret:   []byte(rule.Secret),
+			header:   "X-Hub-Signature-256",
+			prefix:   "sha256=",
+			encoding: "hex",
+		}, nil
+	})
+	Register(Shopify, func(rule Rule) (Verifier, error) {
+		return &hmacVerifier{
+			secret:   []byte(rule.Secret),
+			header:   "X-Shopify-Hmac-Sha256",
+			encoding: "base64",
+		}, nil
+	})
+	Register(HMACSHA256, func(rule Rule) (Verifier, error) {
+		if rule.Header == "" {
+			return nil, fmt.Errorf("%w: %s needs a header", ErrInvalidRule, HMACSHA256)
+		}
+		encoding := rule.Encoding
+		if encoding == "" {
+			encoding = "hex"
+		}
+		if encoding != "hex" && encoding != "base64" {
+			return nil, fmt.Errorf("%w: unknown encoding %q", ErrInvalidRule, encoding)
+		}
+		return &hmacVerifier{
+			secret:   []byte(rule.Secret),
+			header:   rule.Header,
+			prefix:   rule.Prefix,
+			encoding: encoding,
+		}, nil
+	})
+	Register(Stripe, func(rule Rule) (Verifier, error) {
+		tolerance, err := parseTolerance(rule.Tolerance)
+		if err != nil {
+			return nil, err
+		}
+		return &stripeVerifier{secret: []byte(rule.Secret), tolerance: tolerance}, nil
+	})
+	Register(Slack, func(rule Rule) (Verifier, error) {
+		tolerance, err := parseTolerance(rule.Tolerance)
+		if err != nil {
+			return nil, err
+		}
+		return &slackVerifier{secret: []byte(rule.Secret), tolerance: tolerance}, nil
+	})
+	Register(Twilio, func(rule Rule) (Verifier, error) {
+		v := &twilioVerifier{secret: []byte(rule.Secret)}
+		if rule.URL != "" {
+			u, err := url.Parse(rule.URL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("%w: url %q must be absolute", ErrInvalidRule, rule.URL)
+			}
+			v.base = u
+		}
+		return v, nil
+	})
+}
+
+func parseTolerance(value string) (time.Duration, error) {
+	if value == "" {
+		return DefaultTolerance, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: invalid tolerance %q", ErrInvalidRule, value)
+	}
+	return d, nil
+}
+
+func sign(h func() hash.Hash, secret []byte, parts ...string) []byte {
+	mac := hmac.New(h, secret)
+	for _, part := range parts {
+		mac.Write([]byte(part))
+	}
+	return mac.Sum(nil)
+}
+
+// signBody computes the HMAC-SHA256 of the prefix parts followed by the body, streaming the body into the HMAC
+func signBody(secret []byte, body io.Reader, prefix ...string) ([]byte, error) {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range prefix {
+		mac.Write([]byte(part))
+	}
+	if _, err := io.Copy(mac, body); err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return mac.Sum(nil), nil
+}
+
+// compare checks a received signature against the expected one in constant time
+func compare(expected, received string) error {
+	if !hmac.Equal([]byte(expected), []byte(received)) {
+		return &Mismatch{Received: received}
+	}
+	return nil
+}
+
+// checkTimestamp rejects signed Unix timestamps further than tolerance from now
+func checkTimestamp(value string, now time.Time, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrMalformed, value)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: signed %s ago, tolerance %s", ErrExpired, age.Round(time.Second), tolerance)
+	}
+	return nil
+}
+
+// hmacVerifier checks an HMAC-SHA256 of the body sent in a header, as GitHub, Shopify and many others do
+type hmacVerifier struct {
+	secret   []byte
+	header   string
+	prefix   string
+	encoding string
+}
+
+func (v *hmacVerifier) Verify(r *http.Request, body io.Reader, _ time.Time) error {
+	received := r.Header.Get(v.header)
+	if received == "" {
+		return fmt.Errorf("%w: no %s header", ErrMissingSignature, v.header)
+	}
+	if !strings.HasPrefix(received, v.prefix) {
+		return fmt.Errorf("%w: %s does not start with %q", ErrMalformed, v.header, v.prefix)
+	}
+
+	mac, err := signBody(v.secret, body)
+	if err != nil {
+		return err
+	}
+	expected := v.prefix + hex.EncodeToString(mac)
+	if v.encoding == "base64" {
+		expected = v.prefix + base64.StdEncoding.EncodeToString(mac)
+	}
+	return compare(expected, received)
+}
+
+// stripeVerifier checks Stripe-Signature: "t=<timestamp>,v1=<hex HMAC of timestamp.body>", possibly with several v1
+type stripeVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+func (v *stripeVerifier) Verify(r *http.Request, body io.Reader, now time.Time) error {
+	header := r.Header.Get("Stripe-Signature")
+	if header == "" {
+		return fmt.Errorf("%w: no Stripe-Signature header", ErrMissingSignature)
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("%w: Stripe-Signature needs t and v1", ErrMalformed)
+	}
+
+	mac, err := signBody(v.secret, body, timestamp, ".")
+	if err != nil {
+		return err
+	}
+	expected := hex.EncodeToString(mac)
+	for _, received := range signatures {
+		if err = compare(expected, received); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return checkTimestamp(timestamp, now, v.tolerance)
+}
+
+// slackVerifier checks X-Slack-Signature: "v0=<hex HMAC of v0:timestamp:body>"
+type slackVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+func (v *slackVerifier) Verify(r *http.Request, body io.Reader, now time.Time) error {
+	received := r.Header.Get("X-Slack-Signature")
+	if received == "" {
+		return fmt.Errorf("%w: no X-Slack-Signature header", ErrMissingSignature)
+	}
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	if timestamp == "" {
+		return fmt.Errorf("%w: no X-Slack-Request-Timestamp header", ErrMalformed)
+	}
+
+	mac, err := signBody(v.secret, body, "v0:", timestamp, ":")
+	if err != nil {
+		return err
+	}
+	expected := "v0=" + hex.EncodeToString(mac)
+	if err := compare(expected, received); err != nil {
+		return err
+	}
+	return checkTimestamp(timestamp, now, v.tolerance)
+}
+
+// twilioVerifier checks X-Twilio-Signature: base64 HMAC-SHA1 of the full URL followed by the sorted form parameters
+type twilioVerifier struct {
+	secret []byte
+	base   *url.URL
+}
+
+func (v *twilioVerifier) Verify(r *http.Request, body io.Reader, _ time.Time) error {
+	received := r.Header.Get("X-Twilio-Signature")
+	if received == "" {
+		return fmt.Errorf("%w: no X-Twilio-Signature header", ErrMissingSignature)
+	}
+
+	signed := v.url(r)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// The parameters are sorted, so the form is read like net/http parses forms, up to its limit
+		data, err := io.ReadAll(io.LimitReader(body, maxFormBody+1))
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		if len(data) > maxFormBody {
+			return fmt.Errorf("%w: form body over %d bytes", ErrMalformed, maxFormBody)
+		}
+		form, err := url.ParseQuery(string(data))
+		if err != nil {
+			return fmt.Errorf("%w: invalid form body: %w", ErrMalformed, err)
+		}
+		keys := make([]string, 0, len(form))
+		for key := range form {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values := form[key]
+			sort.Strings(values)
+			for _, value := range values {
+				signed += key + value
+			}
+		}
+	}
+
+	expected := base64.StdEncoding.EncodeToString(sign(sha1.New, v.secret, signed))
+	return compare(expected, received)
+}
+
+// url returns the URL the sender requested, based on the configured public URL or the request itself
+func (v *twilioVerifier) url(r *http.Request) string {
+	if v.base != nil {
+		return strings.TrimSuffix(v.base.String(), "/") + r.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,192 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // Twilio signs with HMAC-SHA1
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hexHMAC(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifier(t *testing.T, rule Rule) Verifier {
+	t.Helper()
+
+	factoriesMu.RLock()
+	factory := factories[rule.Provider]
+	factoriesMu.RUnlock()
+	v, err := factory(rule)
+	if err != nil {
+		t.Fatalf("Creating %s verifier failed: %v", rule.Provider, err)
+	}
+	return v
+}
+
+func request(headers map[string]string) *http.Request {
+	r := httptest.NewRequest("POST", "/webhooks", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	return r
+}
+
+func TestGitHub(t *testing.T) {
+	// Test vector from the GitHub documentation
+	v := verifier(t, Rule{Provider: GitHub, Secret: "It's a Secret to Everybody"})
+	body := []byte("Hello, World!")
+	valid := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+	signed := map[string]string{"X-Hub-Signature-256": valid}
+	if err := v.Verify(request(signed), bytes.NewReader(body), time.Now()); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	err := v.Verify(request(signed), strings.NewReader("Hello, World!\n"), time.Now())
+	var mismatch *Mismatch
+	if !errors.As(err, &mismatch) || mismatch.Received != valid {
+		t.Errorf("Expected a mismatch for a changed body, got %v", err)
+	}
+
+	if err := v.Verify(request(nil), bytes.NewReader(body), time.Now()); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("Expected ErrMissingSignature, got %v", err)
+	}
+	prefixed := map[string]string{"X-Hub-Signature-256": "sha1=abc"}
+	if err := v.Verify(request(prefixed), bytes.NewReader(body), time.Now()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestStripe(t *testing.T) {
+	v := verifier(t, Rule{Provider: Stripe, Secret: "whsec_test"})
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"charge.succeeded"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := hexHMAC("whsec_test", ts+"."+string(body))
+
+	tests := []struct {
+		name   string
+		header string
+		now    time.Time
+		err    error
+	}{
+		{"valid", "t=" + ts + ",v1=" + sig, now, nil},
+		{"second v1 after rotation", "t=" + ts + ",v1=" + hexHMAC("old", "x") + ",v1=" + sig + ",v0=abc", now, nil},
+		{"within tolerance", "t=" + ts + ",v1=" + sig, now.Add(4 * time.Minute), nil},
+		{"expired", "t=" + ts + ",v1=" + sig, now.Add(6 * time.Minute), ErrExpired},
+		{"mismatch", "t=" + ts + ",v1=" + hexHMAC("other", ts+"."+string(body)), now, &Mismatch{}},
+		{"missing v1", "t=" + ts, now, ErrMalformed},
+		{"invalid timestamp", "t=yesterday,v1=" + hexHMAC("whsec_test", "yesterday."+string(body)), now, ErrMalformed},
+		{"missing", "", now, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Verify(request(map[string]string{"Stripe-Signature": tt.header}), bytes.NewReader(body), tt.now)
+			checkError(t, err, tt.err)
+		})
+	}
+}
+
+func TestSlack(t *testing.T) {
+	v := verifier(t, Rule{Provider: Slack, Secret: "8f742231b10e8888abcd99yyyzzz85a5", Tolerance: "1m"})
+	now := time.Unix(1531420618, 0)
+	body := []byte("token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&command=%2Fwebhook-collect&text=")
+	sig := "v0=" + hexHMAC("8f742231b10e8888abcd99yyyzzz85a5", "v0:1531420618:"+string(body))
+
+	headers := map[string]string{"X-Slack-Signature": sig, "X-Slack-Request-Timestamp": "1531420618"}
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), now), nil)
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), now.Add(2*time.Minute)), ErrExpired)
+	checkError(t, v.Verify(request(headers), strings.NewReader("token=changed"), now), &Mismatch{})
+	checkError(t, v.Verify(request(map[string]string{"X-Slack-Signature": sig}), bytes.NewReader(body), now), ErrMalformed)
+}
+
+func TestShopify(t *testing.T) {
+	v := verifier(t, Rule{Provider: Shopify, Secret: "shpss_secret"})
+	body := []byte(`{"id":1}`)
+	mac := hmac.New(sha256.New, []byte("shpss_secret"))
+	mac.Write(body)
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	headers := map[string]string{"X-Shopify-Hmac-Sha256": sig}
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), time.Now()), nil)
+	headers = map[string]string{"X-Shopify-Hmac-Sha256": hexHMAC("shpss_secret", string(body))}
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), time.Now()), &Mismatch{})
+}
+
+func TestTwilio(t *testing.T) {
+	body := "To=%2B18005551212&From=%2B12349013030&CallSid=CA1234567890ABCDE&Digits=1234"
+	data := "https://mycompany.com/myapp?foo=1CallSidCA1234567890ABCDEDigits1234From+12349013030To+18005551212"
+	mac := hmac.New(sha1.New, []byte("12345"))
+	mac.Write([]byte(data))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	newRequest := func(host string) *http.Request {
+		r := httptest.NewRequest("POST", "http://"+host+"/myapp?foo=1", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", sig)
+		return r
+	}
+
+	// Behind a proxy the public URL is configured
+	v := verifier(t, Rule{Provider: Twilio, Secret: "12345", URL: "https://mycompany.com/"})
+	checkError(t, v.Verify(newRequest("localhost:8080"), strings.NewReader(body), time.Now()), nil)
+
+	// Otherwise it is derived from the request
+	v = verifier(t, Rule{Provider: Twilio, Secret: "12345"})
+	r := newRequest("mycompany.com")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	checkError(t, v.Verify(r, strings.NewReader(body), time.Now()), nil)
+	checkError(t, v.Verify(newRequest("mycompany.com"), strings.NewReader(body), time.Now()), &Mismatch{})
+}
+
+func TestHMACSHA256(t *testing.T) {
+	v := verifier(t, Rule{Provider: HMACSHA256, Secret: "s3cret", Header: "X-Signature", Prefix: "hmac "})
+	body := []byte("payload")
+
+	headers := map[string]string{"X-Signature": "hmac " + hexHMAC("s3cret", "payload")}
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), time.Now()), nil)
+	headers = map[string]string{"X-Signature": hexHMAC("s3cret", "payload")}
+	checkError(t, v.Verify(request(headers), bytes.NewReader(body), time.Now()), ErrMalformed)
+
+	for _, rule := range []Rule{
+		{Provider: HMACSHA256, Secret: "s3cret"},
+		{Provider: HMACSHA256, Secret: "s3cret", Header: "X-Signature", Encoding: "base32"},
+		{Provider: Stripe, Secret: "s3cret", Tolerance: "soon"},
+		{Provider: Twilio, Secret: "s3cret", URL: "/relative"},
+	} {
+		if _, err := factories[rule.Provider](rule); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Expected ErrInvalidRule for %+v, got %v", rule, err)
+		}
+	}
+}
+
+func checkError(t *testing.T, err, expected error) {
+	t.Helper()
+
+	var mismatch *Mismatch
+	switch {
+	case expected == nil:
+		if err != nil {
+			t.Errorf("Expected a valid signature, got %v", err)
+		}
+	case errors.As(expected, &mismatch):
+		if !errors.As(err, &mismatch) {
+			t.Errorf("Expected a mismatch, got %v", err)
+		}
+	case !errors.Is(err, expected):
+		t.Errorf("Expected %v, got %v", expected, err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package signature verifies the webhook signatures of captured requests.
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// DefaultTolerance is the maximum age of signed timestamps when a rule sets none
+const DefaultTolerance = 5 * time.Minute
+
+// Errors describing why a verification failed
+var (
+	ErrInvalidRule      = errors.New("invalid signature rule")
+	ErrMissingSignature = errors.New("missing signature")
+	ErrMalformed        = errors.New("malformed signature")
+	ErrExpired          = errors.New("timestamp outside tolerance")
+)
+
+// Mismatch is returned when a signature is well-formed but differs from the one computed with the secret.
+// The computed signature is deliberately left out, so that recording a failure never hands out a valid signature.
+type Mismatch struct {
+	Received string
+}
+
+func (m *Mismatch) Error() string {
+	return "signature mismatch"
+}
+
+// Verifier checks the signature of a request. Body streams the complete request body, so that large bodies are
+// never held in memory.
+type Verifier interface {
+	Verify(r *http.Request, body io.Reader, now time.Time) error
+}
+
+// Factory creates the verifier of a rule.
+type Factory func(rule Rule) (Verifier, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a verifier available under the provider name used in rules.
+func Register(provider string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[provider] = factory
+}
+
+// Providers returns the names of all registered providers, sorted.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rule configures the verification of requests to matching paths.
+type Rule struct {
+	// Path is a glob, see store.MatchGlob
+	Path     string `json:"path"`
+	Provider string `json:"provider"`
+	Secret   string `json:"secret"`
+	// Reject answers requests failing verification with 401 instead of handling them
+	Reject bool `json:"reject,omitempty"`
+	// Tolerance is the maximum age of signed timestamps such as "10m", used by Stripe and Slack
+	Tolerance string `json:"tolerance,omitempty"`
+	// Header, Encoding ("hex" or "base64") and Prefix describe the signature of the generic hmac-sha256 provider
+	Header   string `json:"header,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	// URL is the public base URL the sender signs, used by Twilio when requests arrive through a proxy
+	URL string `json:"url,omitempty"`
+}
+
+type compiledRule struct {
+	Rule
+	verifier Verifier
+}
+
+// Verifiers check requests against the first rule whose path matches.
+type Verifiers struct {
+	rules []*compiledRule
+}
+
+// New creates verifiers for the given rules.
+func New(rules []Rule) (*Verifiers, error) {
+	v := &Verifiers{rules: make([]*compiledRule, 0, len(rules))}
+	for i, rule := range rules {
+		if rule.Path == "" || rule.Secret == "" {
+			return nil, fmt.Errorf("rule %d (%s): %w: path and secret are required", i, rule.Path, ErrInvalidRule)
+		}
+
+		factoriesMu.RLock()
+		factory, ok := factories[rule.Provider]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("rule %d (%s): %w: unknown provider %q, expected one of %s",
+				i, rule.Path, ErrInvalidRule, rule.Provider, strings.Join(Providers(), ", "))
+		}
+
+		verifier, err := factory(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Path, err)
+		}
+		v.rules = append(v.rules, &compiledRule{Rule: rule, verifier: verifier})
+	}
+	return v, nil
+}
+
+// LoadFile creates verifiers for the JSON array of rules in the given file.
+func LoadFile(path string) (*Verifiers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read signature rules file: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse signature rules file %s: %w", path, err)
+	}
+
+	v, err := New(rules)
+	if err != nil {
+		return nil, fmt.Errorf("load signature rules file %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// Verify checks the request against the first rule matching its path.
+// It returns nil when no rule matches.
+func (v *Verifiers) Verify(r *http.Request, body []byte) *store.Signature {
+	if rule := v.match(r.URL.Path); rule != nil {
+		return rule.verify(r, bytes.NewReader(body))
+	}
+	return nil
+}
+
+func (c *compiledRule) verify(r *http.Request, body io.Reader) *store.Signature {
+	result := &store.Signature{Provider: c.Provider, Valid: true}
+
+	err := c.verifier.Verify(r, body, time.Now())
+	if err == nil {
+		return result
+	}
+
+	result.Valid = false
+	result.Error = err.Error()
+	var mismatch *Mismatch
+	if errors.As(err, &mismatch) {
+		result.Received = mismatch.Received
+	}
+	return result
+}
+
+// Handler verifies requests matching a rule before passing them to next and records the result on the
+// captured request. Failing requests of rules with Reject are answered with 401.
+func (v *Verifiers) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule := v.match(r.URL.Path)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := store.FromContext(r.Context())
+		body, err := requestBody(r, rec)
+		if err != nil {
+			api.WriteError(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		defer body.Close()
+
+		result := rule.verify(r, body)
+		if rec != nil {
+			rec.Signature = result
+		}
+		if result.Valid {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slog.Warn("Webhook signature verification failed",
+			"provider", result.Provider,
+			"path", r.URL.Path,
+			"error", result.Error)
+		if rule.Reject {
+			api.WriteError(w, http.StatusUnauthorized, "invalid signature: "+result.Error)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestBody opens the body a signature covers. The captured body is used unless it was truncated, otherwise the
+// whole body is read again through GetBody, which the logging middleware serves from its spool. Only requests with
+// neither are read into memory, and restored for the handlers.
+func requestBody(r *http.Request, rec *store.CapturedRequest) (io.ReadCloser, error) {
+	switch {
+	case rec != nil && !rec.BodyTruncated:
+		return io.NopCloser(bytes.NewReader(rec.Body)), nil
+	case r.GetBody != nil:
+		return r.GetBody()
+	case r.Body == nil || r.Body == http.NoBody:
+		return http.NoBody, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (v *Verifiers) match(path string) *compiledRule {
+	for _, rule := range v.rules {
+		if store.MatchGlob(rule.Path, path) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func newVerifiers(t *testing.T, reject bool) *Verifiers {
+	t.Helper()
+
+	v, err := New([]Rule{
+		{Path: "/webhooks/github", Provider: GitHub, Secret: "s3cret", Reject: reject},
+		{Path: "/webhooks/**", Provider: HMACSHA256, Secret: "other", Header: "X-Signature"},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return v
+}
+
+// serve passes a captured request through the handler and returns the response and the record
+func serve(v *Verifiers, path, body, sig string) (*httptest.ResponseRecorder, *store.CapturedRequest, bool) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if got, _ := io.ReadAll(r.Body); string(got) != body {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	})
+
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	r.Header.Set("X-Hub-Signature-256", sig)
+	rec := &store.CapturedRequest{ID: "1", Body: []byte(body)}
+	rr := httptest.NewRecorder()
+	v.Handler(next).ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+	return rr, rec, called
+}
+
+func TestHandler_RecordsResult(t *testing.T) {
+	v := newVerifiers(t, false)
+	body := `{"zen":"Keep it logically awesome."}`
+
+	rr, rec, called := serve(v, "/webhooks/github", body, "sha256="+hexHMAC("s3cret", body))
+	if !called || rr.Code != http.StatusOK {
+		t.Fatalf("Expected the request to be handled, got %d", rr.Code)
+	}
+	if rec.Signature == nil || !rec.Signature.Valid || rec.Signature.Provider != GitHub {
+		t.Errorf("Expected a valid GitHub signature, got %+v", rec.Signature)
+	}
+
+	// Failures are recorded but still handled without reject
+	rr, rec, called = serve(v, "/webhooks/github", body, "sha256="+hexHMAC("wrong", body))
+	if !called || rr.Code != http.StatusOK {
+		t.Fatalf("Expected the request to be handled, got %d", rr.Code)
+	}
+	sig := rec.Signature
+	if sig == nil || sig.Valid || sig.Error != "signature mismatch" || sig.Received != "sha256="+hexHMAC("wrong", body) {
+		t.Errorf("Expected a mismatch with the received signature, got %+v", sig)
+	}
+	if data, _ := json.Marshal(sig); strings.Contains(string(data), hexHMAC("s3cret", body)) {
+		t.Errorf("Expected the computed signature not to be recorded, got %s", data)
+	}
+
+	// The first matching rule applies
+	_, rec, _ = serve(v, "/webhooks/stripe", body, "")
+	if rec.Signature == nil || rec.Signature.Provider != HMACSHA256 || !strings.Contains(rec.Signature.Error, "X-Signature") {
+		t.Errorf("Expected the generic rule to fail, got %+v", rec.Signature)
+	}
+
+	_, rec, called = serve(v, "/api/users", body, "")
+	if !called || rec.Signature != nil {
+		t.Errorf("Expected requests without a rule to pass unverified, got %+v", rec.Signature)
+	}
+}
+
+func TestHandler_Rejects(t *testing.T) {
+	v := newVerifiers(t, true)
+	body := "{}"
+
+	rr, rec, called := serve(v, "/webhooks/github", body, "sha256=0000")
+	if called || rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the request to be rejected, got %d", rr.Code)
+	}
+	if rec.Signature == nil || rec.Signature.Valid {
+		t.Errorf("Expected the failure to be recorded, got %+v", rec.Signature)
+	}
+
+	rr, _, called = serve(v, "/webhooks/github", body, "sha256="+hexHMAC("s3cret", body))
+	if !called || rr.Code != http.StatusOK {
+		t.Errorf("Expected a valid request to be handled, got %d", rr.Code)
+	}
+}
+
+func TestHandler_WithoutCapture(t *testing.T) {
+	v := newVerifiers(t, true)
+	body := "{}"
+
+	var got string
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got = string(data)
+	})
+	r := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC("s3cret", body))
+	rr := httptest.NewRecorder()
+	v.Handler(next).ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK || got != body {
+		t.Errorf("Expected the verified body to reach the handler, got %d %q", rr.Code, got)
+	}
+}
+
+func TestHandler_TruncatedCapture(t *testing.T) {
+	v := newVerifiers(t, true)
+	body := strings.Repeat("a", 100)
+
+	// The logging middleware serves spooled bodies through GetBody, the handlers still read r.Body
+	r := httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC("s3cret", body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	original := r.Body
+	var got string
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.Body != original {
+			t.Error("Expected the request body to be left untouched")
+		}
+		data, _ := io.ReadAll(r.Body)
+		got = string(data)
+	})
+	rec := &store.CapturedRequest{ID: "1", Body: []byte(body[:10]), BodySize: 100, BodyTruncated: true}
+	rr := httptest.NewRecorder()
+	v.Handler(next).ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+
+	if rr.Code != http.StatusOK || rec.Signature == nil || !rec.Signature.Valid {
+		t.Errorf("Expected the whole body to be verified, got %d %+v", rr.Code, rec.Signature)
+	}
+	if got != body {
+		t.Errorf("Expected the handler to read the whole body, got %d bytes", len(got))
+	}
+
+	r = httptest.NewRequest("POST", "/webhooks/github", strings.NewReader(body))
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC("s3cret", body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return nil, errors.New("spool removed")
+	}
+	rr = httptest.NewRecorder()
+	v.Handler(next).ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when the body cannot be read again, got %d", rr.Code)
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{Provider: GitHub, Secret: "s3cret"},
+		{Path: "/webhooks", Provider: GitHub},
+		{Path: "/webhooks", Provider: "gitlab", Secret: "s3cret"},
+		{Path: "/webhooks", Provider: HMACSHA256, Secret: "s3cret"},
+	} {
+		if _, err := New([]Rule{rule}); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Expected ErrInvalidRule for %+v, got %v", rule, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("always", func(Rule) (Verifier, error) {
+		return verifierFunc(func(*http.Request, io.Reader) error { return ErrMissingSignature }), nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "always")
+		factoriesMu.Unlock()
+	}()
+
+	v, err := New([]Rule{{Path: "/**", Provider: "always", Secret: "s3cret"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	result := v.Verify(httptest.NewRequest("GET", "/", nil), nil)
+	if result == nil || result.Valid || result.Provider != "always" {
+		t.Errorf("Expected the registered verifier to run, got %+v", result)
+	}
+}
+
+type verifierFunc func(*http.Request, io.Reader) error
+
+func (f verifierFunc) Verify(r *http.Request, body io.Reader, _ time.Time) error {
+	return f(r, body)
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "signatures.json")
+	if err := os.WriteFile(path, []byte(`[{"path": "/webhooks/github", "provider": "github", "secret": "s3cret"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if result := v.Verify(httptest.NewRequest("POST", "/webhooks/github", nil), nil); result == nil || result.Valid {
+		t.Errorf("Expected an unsigned request to fail, got %+v", result)
+	}
+
+	if _, err := LoadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for a missing file")
+	}
+	if err := os.WriteFile(path, []byte(`[{"path": "/", "provider": "github"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Expected ErrInvalidRule, got %v", err)
+	}
+}
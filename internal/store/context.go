@@ -0,0 +1,17 @@
+package store
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request being captured
+func NewContext(ctx context.Context, req *CapturedRequest) context.Context {
+	return context.WithValue(ctx, contextKey{}, req)
+}
+
+// FromContext returns the request being captured, or nil when the request is not captured.
+// Handlers may annotate the returned request until they return; it is stored afterwards.
+func FromContext(ctx context.Context) *CapturedRequest {
+	req, _ := ctx.Value(contextKey{}).(*CapturedRequest)
+	return req
+}
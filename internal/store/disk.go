@@ -0,0 +1,624 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSegmentSize is the size after which a disk store starts a new segment file
+const DefaultSegmentSize = 16 << 20
+
+const (
+	segmentExt        = ".seg"
+	recordHeaderSize  = 8
+	retentionInterval = time.Minute
+
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// ErrCorruptRecord is returned when a record read from disk fails its checksum
+var ErrCorruptRecord = errors.New("corrupt record")
+
+// DiskOptions configures the limits of a disk store. Non-positive values select defaults,
+// except MaxAge where zero disables age based retention.
+type DiskOptions struct {
+	MaxRequests int
+	MaxBytes    int64
+	MaxAge      time.Duration
+	SegmentSize int64
+}
+
+// Disk is a Store persisting captured requests in append-only segment files.
+//
+// Every change is appended to the active segment as a length-prefixed, checksummed
+// JSON record. An in-memory index of live records is rebuilt from the segments on open.
+// Segments that only hold evicted records are removed, and once more than half of the
+// data on disk is dead the live records are rewritten into fresh segments.
+type Disk struct {
+	mu         sync.RWMutex
+	dir        string
+	opts       DiskOptions
+	files      map[int]*os.File
+	active     int
+	activeSize int64
+	entries    []*diskEntry // oldest first
+	byID       map[string]*diskEntry
+	liveBytes  int64
+	totalBytes int64
+	stop       chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+type diskEntry struct {
+	id         string
+	segment    int
+	offset     int64
+	length     int64
+	receivedAt time.Time
+}
+
+type diskRecord struct {
+	Op      string           `json:"op"`
+	ID      string           `json:"id"`
+	Request *CapturedRequest `json:"request,omitempty"`
+}
+
+// NewDisk opens or creates a disk store in dir
+func NewDisk(dir string, opts DiskOptions) (*Disk, error) {
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = DefaultMaxRequests
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+
+	d := &Disk{
+		dir:   dir,
+		opts:  opts,
+		files: make(map[int]*os.File),
+		byID:  make(map[string]*diskEntry),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if err := d.load(); err != nil {
+		d.closeFiles()
+		return nil, err
+	}
+
+	d.applyRetention(time.Now())
+	if err := d.maintain(); err != nil {
+		d.closeFiles()
+		return nil, err
+	}
+
+	go d.retentionLoop()
+	return d, nil
+}
+
+// Add appends a captured request to the store, evicting the oldest ones to stay within limits
+func (d *Disk) Add(req *CapturedRequest) error {
+	payload, err := json.Marshal(diskRecord{Op: opPut, ID: req.ID, Request: req})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.put(req, payload)
+}
+
+// Update replaces a stored request with a new version of it
+func (d *Disk) Update(req *CapturedRequest) error {
+	payload, err := json.Marshal(diskRecord{Op: opPut, ID: req.ID, Request: req})
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.byID[req.ID]; !ok {
+		return ErrNotFound
+	}
+	return d.put(req, payload)
+}
+
+// put appends an encoded request and indexes it, callers must hold the lock
+func (d *Disk) put(req *CapturedRequest, payload []byte) error {
+	segment, offset, err := d.append(payload)
+	if err != nil {
+		return err
+	}
+
+	length := int64(recordHeaderSize + len(payload))
+	if old, ok := d.byID[req.ID]; ok {
+		// A request stored again replaces the previous version in place
+		d.liveBytes -= old.length
+		old.segment, old.offset, old.length = segment, offset, length
+	} else {
+		entry := &diskEntry{id: req.ID, segment: segment, offset: offset, length: length, receivedAt: req.ReceivedAt}
+		d.entries = append(d.entries, entry)
+		d.byID[req.ID] = entry
+	}
+	d.liveBytes += length
+
+	d.applyRetention(time.Now())
+	return d.maintain()
+}
+
+// Get returns the captured request with the given ID
+func (d *Disk) Get(id string) (*CapturedRequest, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entry, ok := d.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return d.read(entry)
+}
+
+// List returns the captured requests matching the filter, newest first
+func (d *Disk) List(f Filter) ([]*CapturedRequest, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var result []*CapturedRequest
+	for i := len(d.entries) - 1; i >= 0; i-- {
+		entry := d.entries[i]
+		if !f.Since.IsZero() && entry.receivedAt.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && entry.receivedAt.After(f.Until) {
+			continue
+		}
+
+		req, err := d.read(entry)
+		if err != nil {
+			return nil, err
+		}
+		if f.Match(req) {
+			result = append(result, req)
+		}
+	}
+	return result, nil
+}
+
+// Delete removes the captured request with the given ID
+func (d *Disk) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.byID[id]; !ok {
+		return ErrNotFound
+	}
+
+	payload, err := json.Marshal(diskRecord{Op: opDelete, ID: id})
+	if err != nil {
+		return fmt.Errorf("encode delete: %w", err)
+	}
+	if _, _, err := d.append(payload); err != nil {
+		return err
+	}
+
+	d.removeEntry(id)
+	return d.maintain()
+}
+
+// Clear removes all captured requests along with their segment files
+func (d *Disk) Clear() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Oldest first, so that an interrupted clear never keeps records whose deletion markers are gone
+	for _, id := range d.segments() {
+		_ = d.files[id].Close()
+		if err := os.Remove(d.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove segment: %w", err)
+		}
+	}
+	clear(d.files)
+	d.entries = nil
+	d.byID = make(map[string]*diskEntry)
+	d.liveBytes = 0
+	d.totalBytes = 0
+
+	return d.openSegment(d.active + 1)
+}
+
+// Len returns the number of captured requests
+func (d *Disk) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.entries)
+}
+
+// Close stops background retention and closes all segment files. It is safe to call more than once.
+func (d *Disk) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.stop)
+		<-d.done
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if f, ok := d.files[d.active]; ok {
+			err = f.Sync()
+		}
+		err = errors.Join(err, d.closeFiles())
+	})
+	return err
+}
+
+// Compact rewrites all live records into fresh segments and removes the old ones
+func (d *Disk) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.compact()
+}
+
+// load replays all segment files to rebuild the index
+func (d *Disk) load() error {
+	ids, err := d.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		last := i == len(ids)-1
+		if err := d.replaySegment(id, last); err != nil {
+			return err
+		}
+	}
+
+	if len(ids) == 0 {
+		return d.openSegment(1)
+	}
+	d.active = ids[len(ids)-1]
+	return nil
+}
+
+func (d *Disk) replaySegment(id int, last bool) error {
+	f, err := os.OpenFile(d.segmentPath(id), os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("open segment: %w", err)
+	}
+	d.files[id] = f
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		payload, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.Warn("Ignoring damaged tail of store segment",
+				"segment", d.segmentPath(id),
+				"offset", offset,
+				"error", err)
+			if last {
+				// Drop a partially written record so new records append cleanly
+				if err := f.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate segment: %w", err)
+				}
+			}
+			break
+		}
+
+		length := int64(recordHeaderSize + len(payload))
+		if err := d.replayRecord(payload, id, offset, length); err != nil {
+			return err
+		}
+		offset += length
+	}
+
+	if last {
+		d.activeSize = offset
+		d.totalBytes += offset
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("seek segment: %w", err)
+		}
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat segment: %w", err)
+	}
+	d.totalBytes += info.Size()
+	return nil
+}
+
+func (d *Disk) replayRecord(payload []byte, segment int, offset, length int64) error {
+	var rec diskRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return fmt.Errorf("decode record: %w", err)
+	}
+
+	switch rec.Op {
+	case opPut:
+		if rec.Request == nil {
+			return fmt.Errorf("record %s has no request", rec.ID)
+		}
+		if old, ok := d.byID[rec.ID]; ok {
+			d.liveBytes -= old.length
+			old.segment, old.offset, old.length = segment, offset, length
+		} else {
+			entry := &diskEntry{
+				id:         rec.ID,
+				segment:    segment,
+				offset:     offset,
+				length:     length,
+				receivedAt: rec.Request.ReceivedAt,
+			}
+			d.entries = append(d.entries, entry)
+			d.byID[rec.ID] = entry
+		}
+		d.liveBytes += length
+	case opDelete:
+		if _, ok := d.byID[rec.ID]; ok {
+			d.removeEntry(rec.ID)
+		}
+	}
+	return nil
+}
+
+// append writes a record to the active segment, rotating it when full
+func (d *Disk) append(payload []byte) (int, int64, error) {
+	if d.activeSize >= d.opts.SegmentSize {
+		if err := d.openSegment(d.active + 1); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload))) //nolint:gosec // records are far below 4 GiB
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	offset := d.activeSize
+	if _, err := d.files[d.active].Write(buf); err != nil {
+		return 0, 0, fmt.Errorf("write record: %w", err)
+	}
+	d.activeSize += int64(len(buf))
+	d.totalBytes += int64(len(buf))
+	return d.active, offset, nil
+}
+
+func (d *Disk) read(entry *diskEntry) (*CapturedRequest, error) {
+	buf := make([]byte, entry.length)
+	if _, err := d.files[entry.segment].ReadAt(buf, entry.offset); err != nil {
+		return nil, fmt.Errorf("read record: %w", err)
+	}
+
+	payload := buf[recordHeaderSize:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(buf[4:8]) {
+		return nil, ErrCorruptRecord
+	}
+
+	var rec diskRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, fmt.Errorf("decode record: %w", err)
+	}
+	return rec.Request, nil
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrCorruptRecord
+		}
+		return nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, ErrCorruptRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorruptRecord
+	}
+	return payload, nil
+}
+
+// applyRetention evicts the oldest requests exceeding the count, size or age limits
+func (d *Disk) applyRetention(now time.Time) {
+	for len(d.entries) > 0 {
+		oldest := d.entries[0]
+		expired := d.opts.MaxAge > 0 && now.Sub(oldest.receivedAt) > d.opts.MaxAge
+		overCount := len(d.entries) > d.opts.MaxRequests
+		overSize := d.liveBytes > d.opts.MaxBytes && len(d.entries) > 1
+		if !expired && !overCount && !overSize {
+			return
+		}
+		d.removeEntry(oldest.id)
+	}
+}
+
+func (d *Disk) removeEntry(id string) {
+	for i, entry := range d.entries {
+		if entry.id == id {
+			d.liveBytes -= entry.length
+			d.entries = append(d.entries[:i], d.entries[i+1:]...)
+			break
+		}
+	}
+	delete(d.byID, id)
+}
+
+// maintain removes segments that no longer hold live records and compacts when
+// more than half of the data on disk is dead
+func (d *Disk) maintain() error {
+	// Segments older than the oldest live record only hold dead data. Deletion
+	// markers in them refer to records in even older segments, so dropping them is safe.
+	oldestLive := d.active
+	if len(d.entries) > 0 {
+		oldestLive = d.entries[0].segment
+		for _, entry := range d.entries {
+			oldestLive = min(oldestLive, entry.segment)
+		}
+	}
+	for _, id := range d.segments() {
+		if id >= oldestLive || id == d.active {
+			break
+		}
+		if err := d.removeSegment(id); err != nil {
+			return err
+		}
+	}
+
+	dead := d.totalBytes - d.liveBytes
+	if dead > d.liveBytes && dead > d.opts.SegmentSize {
+		return d.compact()
+	}
+	return nil
+}
+
+func (d *Disk) compact() error {
+	old := d.segments()
+
+	if err := d.openSegment(d.active + 1); err != nil {
+		return err
+	}
+
+	for _, entry := range d.entries {
+		buf := make([]byte, entry.length)
+		if _, err := d.files[entry.segment].ReadAt(buf, entry.offset); err != nil {
+			return fmt.Errorf("read record: %w", err)
+		}
+		segment, offset, err := d.append(buf[recordHeaderSize:])
+		if err != nil {
+			return err
+		}
+		entry.segment, entry.offset = segment, offset
+	}
+
+	if err := d.files[d.active].Sync(); err != nil {
+		return fmt.Errorf("sync segment: %w", err)
+	}
+
+	for _, id := range old {
+		if err := d.removeSegment(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Disk) openSegment(id int) error {
+	f, err := os.OpenFile(d.segmentPath(id), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	d.files[id] = f
+	d.active = id
+	d.activeSize = 0
+	return nil
+}
+
+func (d *Disk) removeSegment(id int) error {
+	f := d.files[id]
+	info, err := f.Stat()
+	if err == nil {
+		d.totalBytes -= info.Size()
+	}
+	_ = f.Close()
+	delete(d.files, id)
+
+	if err := os.Remove(d.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove segment: %w", err)
+	}
+	return nil
+}
+
+// segments returns the IDs of the open segments, oldest first. Segments are always removed in this order, so that
+// an interrupted removal leaves the newest ones, whose deletion markers only refer to records in removed segments.
+func (d *Disk) segments() []int {
+	ids := slices.Collect(maps.Keys(d.files))
+	slices.Sort(ids)
+	return ids
+}
+
+func (d *Disk) segmentIDs() ([]int, error) {
+	dirEntries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read store directory: %w", err)
+	}
+
+	var ids []int
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (d *Disk) segmentPath(id int) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%08d%s", id, segmentExt))
+}
+
+func (d *Disk) closeFiles() error {
+	var errs []error
+	for id, f := range d.files {
+		errs = append(errs, f.Close())
+		delete(d.files, id)
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Disk) retentionLoop() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			d.mu.Lock()
+			d.applyRetention(now)
+			if err := d.maintain(); err != nil {
+				slog.Error("Store maintenance failed", "error", err)
+			}
+			d.mu.Unlock()
+		}
+	}
+}
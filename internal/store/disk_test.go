@@ -0,0 +1,261 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func openTestDisk(t *testing.T, dir string, opts DiskOptions) *Disk {
+	t.Helper()
+
+	d, err := NewDisk(dir, opts)
+	if err != nil {
+		t.Fatalf("NewDisk failed: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func segmentCount(t *testing.T, dir string) int {
+	t.Helper()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	return len(matches)
+}
+
+func TestDisk_PersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openTestDisk(t, dir, DiskOptions{})
+	for i := 0; i < 3; i++ {
+		req := newTestRequest("req-"+strconv.Itoa(i), 10)
+		req.ReceivedAt = time.Now()
+		if err := d.Add(req); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := d.Delete("req-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	d.Close()
+
+	reopened := openTestDisk(t, dir, DiskOptions{})
+	if reopened.Len() != 2 {
+		t.Fatalf("Expected 2 requests after reopen, got %d", reopened.Len())
+	}
+
+	list, err := reopened.List(Filter{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if list[0].ID != "req-2" || list[1].ID != "req-0" {
+		t.Errorf("Unexpected order after reopen: %s, %s", list[0].ID, list[1].ID)
+	}
+	if string(list[0].Body) != string(newTestRequest("", 10).Body) {
+		t.Errorf("Expected body to survive reopen, got %q", list[0].Body)
+	}
+	if _, err := reopened.Get("req-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted request to stay deleted, got %v", err)
+	}
+}
+
+func TestDisk_RetentionByCount(t *testing.T) {
+	d := openTestDisk(t, t.TempDir(), DiskOptions{MaxRequests: 2})
+
+	for i := 0; i < 4; i++ {
+		d.Add(newTestRequest("req-"+strconv.Itoa(i), 10))
+	}
+
+	if d.Len() != 2 {
+		t.Errorf("Expected 2 requests, got %d", d.Len())
+	}
+	if _, err := d.Get("req-0"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected oldest request to be evicted")
+	}
+}
+
+func TestDisk_RetentionBySize(t *testing.T) {
+	d := openTestDisk(t, t.TempDir(), DiskOptions{MaxBytes: 1000})
+
+	for i := 0; i < 5; i++ {
+		d.Add(newTestRequest("req-"+strconv.Itoa(i), 300))
+	}
+
+	if d.liveBytes > 1000 {
+		t.Errorf("Expected at most 1000 live bytes, got %d", d.liveBytes)
+	}
+	if _, err := d.Get("req-4"); err != nil {
+		t.Error("Expected newest request to be kept")
+	}
+}
+
+func TestDisk_RetentionByAge(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir, DiskOptions{MaxAge: time.Hour})
+
+	old := newTestRequest("old", 10)
+	old.ReceivedAt = time.Now().Add(-2 * time.Hour)
+	recent := newTestRequest("recent", 10)
+	recent.ReceivedAt = time.Now()
+	d.Add(old)
+	d.Add(recent)
+
+	if d.Len() != 1 {
+		t.Fatalf("Expected expired request to be evicted, got %d requests", d.Len())
+	}
+
+	d.mu.Lock()
+	d.applyRetention(time.Now().Add(2 * time.Hour))
+	d.mu.Unlock()
+	if d.Len() != 0 {
+		t.Errorf("Expected all requests to expire, got %d", d.Len())
+	}
+}
+
+func TestDisk_SegmentsRotateAndAreRemoved(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir, DiskOptions{MaxRequests: 2, SegmentSize: 500})
+
+	for i := 0; i < 20; i++ {
+		d.Add(newTestRequest("req-"+strconv.Itoa(i), 200))
+	}
+
+	if n := segmentCount(t, dir); n > 3 {
+		t.Errorf("Expected old segments to be removed, found %d", n)
+	}
+
+	d.Close()
+	reopened := openTestDisk(t, dir, DiskOptions{MaxRequests: 2, SegmentSize: 500})
+	list, _ := reopened.List(Filter{})
+	if len(list) != 2 || list[0].ID != "req-19" || list[1].ID != "req-18" {
+		t.Errorf("Unexpected requests after reopen: %v", list)
+	}
+}
+
+func TestDisk_Compact(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir, DiskOptions{SegmentSize: 1 << 20})
+
+	for i := 0; i < 10; i++ {
+		d.Add(newTestRequest("req-"+strconv.Itoa(i), 100))
+	}
+	for i := 0; i < 10; i += 2 {
+		d.Delete("req-" + strconv.Itoa(i))
+	}
+
+	before := d.totalBytes
+	if err := d.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if d.totalBytes >= before {
+		t.Errorf("Expected compaction to shrink data from %d bytes, got %d", before, d.totalBytes)
+	}
+	if d.totalBytes != d.liveBytes {
+		t.Errorf("Expected only live data after compaction, got %d total and %d live", d.totalBytes, d.liveBytes)
+	}
+	if n := segmentCount(t, dir); n != 1 {
+		t.Errorf("Expected 1 segment after compaction, found %d", n)
+	}
+
+	d.Add(newTestRequest("after", 10))
+	d.Close()
+
+	reopened := openTestDisk(t, dir, DiskOptions{})
+	list, _ := reopened.List(Filter{})
+	expected := []string{"after", "req-9", "req-7", "req-5", "req-3", "req-1"}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(list))
+	}
+	for i, id := range expected {
+		if list[i].ID != id {
+			t.Errorf("Expected request %d to be %s, got %s", i, id, list[i].ID)
+		}
+	}
+}
+
+func TestDisk_TruncatesDamagedTail(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir, DiskOptions{})
+	d.Add(newTestRequest("req-0", 10))
+	d.Add(newTestRequest("req-1", 10))
+	d.Close()
+
+	// Simulate a crash in the middle of writing a record
+	path := filepath.Join(dir, "00000001"+segmentExt)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	reopened := openTestDisk(t, dir, DiskOptions{})
+	if reopened.Len() != 2 {
+		t.Fatalf("Expected 2 intact requests, got %d", reopened.Len())
+	}
+
+	if err := reopened.Add(newTestRequest("req-2", 10)); err != nil {
+		t.Fatalf("Add after recovery failed: %v", err)
+	}
+	if _, err := reopened.Get("req-2"); err != nil {
+		t.Errorf("Expected request appended after recovery to be readable, got %v", err)
+	}
+}
+
+func TestDisk_Clear(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDisk(t, dir, DiskOptions{})
+	for i := 0; i < 3; i++ {
+		d.Add(newTestRequest("req-"+strconv.Itoa(i), 10))
+	}
+
+	if err := d.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if d.Len() != 0 {
+		t.Errorf("Expected empty store, got %d", d.Len())
+	}
+
+	d.Add(newTestRequest("after", 10))
+	d.Close()
+
+	reopened := openTestDisk(t, dir, DiskOptions{})
+	list, _ := reopened.List(Filter{})
+	if len(list) != 1 || list[0].ID != "after" {
+		t.Errorf("Expected only the request added after clear, got %v", list)
+	}
+}
+
+func TestDisk_Update(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openTestDisk(t, dir, DiskOptions{})
+	if err := d.Add(newTestRequest("req-1", 10)); err != nil {
+		t.Fatal(err)
+	}
+	updated := newTestRequest("req-1", 10)
+	updated.MockRule = "rule-1"
+	if err := d.Update(updated); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := d.Update(newTestRequest("missing", 1)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	d.Close()
+
+	reopened := openTestDisk(t, dir, DiskOptions{})
+	got, err := reopened.Get("req-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.MockRule != "rule-1" || reopened.Len() != 1 {
+		t.Errorf("Expected the update to survive reopen, got %+v", got)
+	}
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects captured requests. Zero-valued fields match everything.
+type Filter struct {
+	// Method matches the request method case-insensitively
+	Method string `json:"method,omitempty"`
+	// Path is a glob where * matches within a path segment, ** across segments and ? a single character
+	Path string `json:"path,omitempty"`
+	// PathPrefix is a prefix the request path must start with
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// Headers maps header names to a required value; an empty value only requires the header to be present
+	Headers map[string]string `json:"headers,omitempty"`
+	// Since and Until bound the time the request was received (inclusive)
+	Since time.Time `json:"since,omitzero"`
+	Until time.Time `json:"until,omitzero"`
+	// Body is a substring the request body, raw or decompressed, must contain
+	Body string `json:"body,omitempty"`
+	// Diff selects compared requests whose candidate response differed (true) or matched (false)
+	Diff *bool `json:"diff,omitempty"`
+	// Signature selects verified requests whose signature was valid (true) or invalid (false)
+	Signature *bool `json:"signature,omitempty"`
+	// Provider matches the webhook provider case-insensitively
+	Provider string `json:"provider,omitempty"`
+	// Event is a glob matching the webhook event type
+	Event string `json:"event,omitempty"`
+	// Duplicate selects requests that were (true) or were not (false) delivered before
+	Duplicate *bool `json:"duplicate,omitempty"`
+}
+
+// ParseFilter builds a filter from URL query parameters:
+// method, path, prefix, header (repeatable, "Name:value" or "Name"), since, until (RFC 3339), body, diff, signature,
+// provider, event and duplicate.
+func ParseFilter(q url.Values) (Filter, error) {
+	f := Filter{
+		Method:     q.Get("method"),
+		Path:       q.Get("path"),
+		PathPrefix: q.Get("prefix"),
+		Body:       q.Get("body"),
+		Provider:   q.Get("provider"),
+		Event:      q.Get("event"),
+	}
+
+	for _, h := range q["header"] {
+		name, value, _ := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return Filter{}, fmt.Errorf("invalid header filter %q", h)
+		}
+		if f.Headers == nil {
+			f.Headers = make(map[string]string)
+		}
+		f.Headers[name] = strings.TrimSpace(value)
+	}
+
+	var err error
+	if f.Since, err = parseTime(q.Get("since")); err != nil {
+		return Filter{}, fmt.Errorf("invalid since: %w", err)
+	}
+	if f.Until, err = parseTime(q.Get("until")); err != nil {
+		return Filter{}, fmt.Errorf("invalid until: %w", err)
+	}
+	if value := q.Get("diff"); value != "" {
+		diff, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid diff: %w", err)
+		}
+		f.Diff = &diff
+	}
+	if value := q.Get("signature"); value != "" {
+		valid, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid signature: %w", err)
+		}
+		f.Signature = &valid
+	}
+	if value := q.Get("duplicate"); value != "" {
+		duplicate, err := strconv.ParseBool(value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid duplicate: %w", err)
+		}
+		f.Duplicate = &duplicate
+	}
+	return f, nil
+}
+
+// Match reports whether the captured request satisfies the filter
+func (f *Filter) Match(req *CapturedRequest) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, req.Method) {
+		return false
+	}
+	if f.Path != "" && !MatchGlob(f.Path, req.Path) {
+		return false
+	}
+	if !strings.HasPrefix(req.Path, f.PathPrefix) {
+		return false
+	}
+	if !f.Since.IsZero() && req.ReceivedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && req.ReceivedAt.After(f.Until) {
+		return false
+	}
+	if f.Body != "" && !bytes.Contains(req.Body, []byte(f.Body)) && !bytes.Contains(req.DecodedBody, []byte(f.Body)) {
+		return false
+	}
+	if f.Diff != nil && (req.Diff == nil || req.Diff.Equal == *f.Diff) {
+		return false
+	}
+	if f.Signature != nil && (req.Signature == nil || req.Signature.Valid != *f.Signature) {
+		return false
+	}
+	if f.Duplicate != nil && (req.Duplicate != nil) != *f.Duplicate {
+		return false
+	}
+	if f.Provider != "" && (req.Webhook == nil || !strings.EqualFold(req.Webhook.Provider, f.Provider)) {
+		return false
+	}
+	if f.Event != "" && (req.Webhook == nil || !MatchGlob(f.Event, req.Webhook.Event)) {
+		return false
+	}
+	return matchHeaders(f.Headers, req.Headers)
+}
+
+func matchHeaders(want map[string]string, h http.Header) bool {
+	for name, value := range want {
+		values := h.Values(name)
+		if len(values) == 0 {
+			return false
+		}
+		if value == "" {
+			continue
+		}
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchGlob reports whether name matches the glob pattern.
+// * matches any run of characters except '/', ** matches any run including '/' and ? matches one character.
+func MatchGlob(pattern, name string) bool {
+	m := globMatcher{pattern: pattern, name: name}
+	return m.matchFrom(0, 0)
+}
+
+// globMatcher remembers whether each pattern offset matches each name offset, so that patterns with many stars
+// take polynomial instead of exponential time
+type globMatcher struct {
+	pattern string
+	name    string
+	// memo holds 1 for a match and 2 for a mismatch by pattern and name offset, 0 when not tried yet.
+	// It is allocated at the first star, since patterns without stars never backtrack.
+	memo []uint8
+}
+
+// match reports whether the pattern from offset p matches the name from offset n, trying each pair once
+func (m *globMatcher) match(p, n int) bool {
+	if m.memo == nil {
+		m.memo = make([]uint8, (len(m.pattern)+1)*(len(m.name)+1))
+	}
+	key := p*(len(m.name)+1) + n
+	if m.memo[key] == 0 {
+		m.memo[key] = 2
+		if m.matchFrom(p, n) {
+			m.memo[key] = 1
+		}
+	}
+	return m.memo[key] == 1
+}
+
+// matchFrom matches literals and ? directly and tries the rest of the pattern after a star at each name offset
+func (m *globMatcher) matchFrom(p, n int) bool {
+	pattern, name := m.pattern, m.name
+	for p < len(pattern) {
+		switch {
+		case strings.HasPrefix(pattern[p:], "**"):
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			for i := len(name); i >= n; i-- {
+				if m.match(p, i) {
+					return true
+				}
+			}
+			return false
+		case pattern[p] == '*':
+			for i := n; i <= len(name); i++ {
+				if m.match(p+1, i) {
+					return true
+				}
+				if i < len(name) && name[i] == '/' {
+					break
+				}
+			}
+			return false
+		case pattern[p] == '?':
+			if n == len(name) || name[n] == '/' {
+				return false
+			}
+		default:
+			if n == len(name) || pattern[p] != name[n] {
+				return false
+			}
+		}
+		p, n = p+1, n+1
+	}
+	return n == len(name)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
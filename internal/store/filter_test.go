@@ -0,0 +1,181 @@
+package store
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"/webhook", "/webhook", true},
+		{"/webhook", "/webhooks", false},
+		{"/webhooks/*", "/webhooks/github", true},
+		{"/webhooks/*", "/webhooks/github/push", false},
+		{"/webhooks/**", "/webhooks/github/push", true},
+		{"/**/push", "/webhooks/github/push", true},
+		{"/api/v?/users", "/api/v1/users", true},
+		{"/api/v?/users", "/api/v10/users", false},
+		{"*", "/anything", false},
+		{"**", "/anything/at/all", true},
+		{"/*/events", "/stripe/events", true},
+		{"/*.json", "/data.json", true},
+		{"/a*b*c", "/aXbYc", true},
+		{"/**/*.json", "/a/b/c.json", true},
+		{"/**/*.json", "/a/b/c.xml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if result := MatchGlob(tt.pattern, tt.name); result != tt.expected {
+				t.Errorf("MatchGlob(%q, %q) = %v, expected %v", tt.pattern, tt.name, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchGlob_ManyStars(t *testing.T) {
+	// Backtracking over every star would take exponential time for these
+	name := "/" + strings.Repeat("a", 100)
+	for _, pattern := range []string{
+		"/" + strings.Repeat("*a", 30) + "b",
+		"/" + strings.Repeat("**a", 30) + "b",
+	} {
+		done := make(chan bool, 1)
+		go func() {
+			done <- MatchGlob(pattern, name)
+		}()
+		select {
+		case matched := <-done:
+			if matched {
+				t.Errorf("Expected %q not to match", pattern)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("MatchGlob(%q) did not finish", pattern)
+		}
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	received := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	req := &CapturedRequest{
+		Method:     "POST",
+		Path:       "/webhooks/github",
+		Headers:    http.Header{"X-Github-Event": {"push"}, "Accept": {"a", "b"}},
+		Body:       []byte(`{"ref":"refs/heads/main"}`),
+		ReceivedAt: received,
+		Diff:       &Diff{Equal: false},
+		Signature:  &Signature{Provider: "github", Valid: true},
+		Webhook:    &Webhook{Provider: "github", Event: "pull_request", DeliveryID: "72d3162e"},
+	}
+	different, same := true, false
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"method case-insensitive", Filter{Method: "post"}, true},
+		{"method mismatch", Filter{Method: "GET"}, false},
+		{"path glob", Filter{Path: "/webhooks/*"}, true},
+		{"path prefix", Filter{PathPrefix: "/webhooks/"}, true},
+		{"path prefix mismatch", Filter{PathPrefix: "/api/"}, false},
+		{"header value", Filter{Headers: map[string]string{"X-GitHub-Event": "push"}}, true},
+		{"header second value", Filter{Headers: map[string]string{"Accept": "b"}}, true},
+		{"header value mismatch", Filter{Headers: map[string]string{"X-GitHub-Event": "issues"}}, false},
+		{"header presence", Filter{Headers: map[string]string{"X-GitHub-Event": ""}}, true},
+		{"header missing", Filter{Headers: map[string]string{"X-Missing": ""}}, false},
+		{"since before", Filter{Since: received.Add(-time.Second)}, true},
+		{"since after", Filter{Since: received.Add(time.Second)}, false},
+		{"until after", Filter{Until: received.Add(time.Second)}, true},
+		{"until before", Filter{Until: received.Add(-time.Second)}, false},
+		{"body substring", Filter{Body: "refs/heads/main"}, true},
+		{"body mismatch", Filter{Body: "refs/tags"}, false},
+		{"diff different", Filter{Diff: &different}, true},
+		{"diff equal", Filter{Diff: &same}, false},
+		{"signature valid", Filter{Signature: &different}, true},
+		{"signature invalid", Filter{Signature: &same}, false},
+		{"provider case-insensitive", Filter{Provider: "GitHub"}, true},
+		{"provider mismatch", Filter{Provider: "stripe"}, false},
+		{"event glob", Filter{Provider: "github", Event: "pull_*"}, true},
+		{"event mismatch", Filter{Event: "push"}, false},
+		{"not a duplicate", Filter{Duplicate: &same}, true},
+		{"duplicate", Filter{Duplicate: &different}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.filter.Match(req); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	q := url.Values{
+		"method": {"POST"},
+		"path":   {"/webhooks/*"},
+		"header": {"X-Event: push", "X-Delivery"},
+		"since":  {"2025-06-01T12:00:00Z"},
+		"body":   {"hello"},
+	}
+
+	f, err := ParseFilter(q)
+	if err != nil {
+		t.Fatalf("ParseFilter failed: %v", err)
+	}
+
+	if f.Method != "POST" || f.Path != "/webhooks/*" || f.Body != "hello" {
+		t.Errorf("Unexpected filter: %+v", f)
+	}
+	if f.Headers["X-Event"] != "push" {
+		t.Errorf("Expected header value push, got %q", f.Headers["X-Event"])
+	}
+	if v, ok := f.Headers["X-Delivery"]; !ok || v != "" {
+		t.Errorf("Expected presence-only header filter, got %q", v)
+	}
+	if !f.Since.Equal(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected since: %v", f.Since)
+	}
+
+	if _, err := ParseFilter(url.Values{"until": {"not-a-time"}}); err == nil {
+		t.Error("Expected error for invalid until")
+	}
+
+	f, err = ParseFilter(url.Values{"diff": {"true"}})
+	if err != nil || f.Diff == nil || !*f.Diff {
+		t.Errorf("Expected diff filter, got %+v (%v)", f, err)
+	}
+	if _, err := ParseFilter(url.Values{"diff": {"maybe"}}); err == nil {
+		t.Error("Expected error for invalid diff")
+	}
+
+	f, err = ParseFilter(url.Values{"signature": {"false"}})
+	if err != nil || f.Signature == nil || *f.Signature {
+		t.Errorf("Expected signature filter, got %+v (%v)", f, err)
+	}
+	if _, err := ParseFilter(url.Values{"signature": {"valid"}}); err == nil {
+		t.Error("Expected error for invalid signature")
+	}
+
+	f, err = ParseFilter(url.Values{"provider": {"stripe"}, "event": {"invoice.*"}})
+	if err != nil || f.Provider != "stripe" || f.Event != "invoice.*" {
+		t.Errorf("Expected provider and event filters, got %+v (%v)", f, err)
+	}
+
+	f, err = ParseFilter(url.Values{"duplicate": {"true"}})
+	if err != nil || f.Duplicate == nil || !*f.Duplicate {
+		t.Errorf("Expected duplicate filter, got %+v (%v)", f, err)
+	}
+	if _, err := ParseFilter(url.Values{"duplicate": {"again"}}); err == nil {
+		t.Error("Expected error for invalid duplicate")
+	}
+}
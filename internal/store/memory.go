@@ -0,0 +1,177 @@
+package store
+
+import "sync"
+
+// Default limits used when a memory store is created with non-positive limits
+const (
+	DefaultMaxRequests = 1000
+	DefaultMaxBytes    = 64 << 20
+)
+
+// Memory is a Store backed by a bounded in-memory ring buffer.
+// The oldest requests are evicted once either the count or the byte limit is exceeded.
+type Memory struct {
+	mu       sync.RWMutex
+	ring     []*CapturedRequest
+	head     int // index of the oldest entry
+	count    int
+	bytes    int64
+	maxBytes int64
+	byID     map[string]*CapturedRequest
+}
+
+// NewMemory creates a memory store holding at most maxRequests requests and maxBytes bytes
+func NewMemory(maxRequests int, maxBytes int64) *Memory {
+	if maxRequests <= 0 {
+		maxRequests = DefaultMaxRequests
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &Memory{
+		ring:     make([]*CapturedRequest, maxRequests),
+		maxBytes: maxBytes,
+		byID:     make(map[string]*CapturedRequest),
+	}
+}
+
+// Add stores a captured request, evicting the oldest ones to stay within limits
+func (m *Memory) Add(req *CapturedRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.count == len(m.ring) {
+		m.evictOldest()
+	}
+
+	m.ring[(m.head+m.count)%len(m.ring)] = req
+	m.count++
+	m.bytes += req.Size()
+	m.byID[req.ID] = req
+
+	// Always keep the newest request, even if it alone exceeds the byte limit
+	for m.bytes > m.maxBytes && m.count > 1 {
+		m.evictOldest()
+	}
+	return nil
+}
+
+// Update replaces a stored request with a new version of it
+func (m *Memory) Update(req *CapturedRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.byID[req.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	for i := 0; i < m.count; i++ {
+		idx := (m.head + i) % len(m.ring)
+		if m.ring[idx] == old {
+			m.ring[idx] = req
+			break
+		}
+	}
+	m.bytes += req.Size() - old.Size()
+	m.byID[req.ID] = req
+
+	for m.bytes > m.maxBytes && m.count > 1 {
+		m.evictOldest()
+	}
+	return nil
+}
+
+// Get returns the captured request with the given ID
+func (m *Memory) Get(id string) (*CapturedRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	req, ok := m.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return req, nil
+}
+
+// List returns the captured requests matching the filter, newest first
+func (m *Memory) List(f Filter) ([]*CapturedRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*CapturedRequest
+	for i := m.count - 1; i >= 0; i-- {
+		req := m.ring[(m.head+i)%len(m.ring)]
+		if f.Match(req) {
+			result = append(result, req)
+		}
+	}
+	return result, nil
+}
+
+// Delete removes the captured request with the given ID
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byID[id]; !ok {
+		return ErrNotFound
+	}
+
+	// Shift newer entries down to close the gap left by the deleted one
+	for i := 0; i < m.count; i++ {
+		idx := (m.head + i) % len(m.ring)
+		if m.ring[idx].ID != id {
+			continue
+		}
+		m.bytes -= m.ring[idx].Size()
+		for j := i; j < m.count-1; j++ {
+			m.ring[(m.head+j)%len(m.ring)] = m.ring[(m.head+j+1)%len(m.ring)]
+		}
+		m.ring[(m.head+m.count-1)%len(m.ring)] = nil
+		m.count--
+		break
+	}
+	delete(m.byID, id)
+	return nil
+}
+
+// Clear removes all captured requests
+func (m *Memory) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.ring)
+	m.head = 0
+	m.count = 0
+	m.bytes = 0
+	m.byID = make(map[string]*CapturedRequest)
+	return nil
+}
+
+// Len returns the number of captured requests
+func (m *Memory) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.count
+}
+
+// Bytes returns the approximate number of bytes held by the store
+func (m *Memory) Bytes() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bytes
+}
+
+// Close is a no-op for the memory store
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) evictOldest() {
+	oldest := m.ring[m.head]
+	m.ring[m.head] = nil
+	m.head = (m.head + 1) % len(m.ring)
+	m.count--
+	m.bytes -= oldest.Size()
+	delete(m.byID, oldest.ID)
+}
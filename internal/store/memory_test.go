@@ -0,0 +1,200 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestRequest(id string, bodySize int) *CapturedRequest {
+	return &CapturedRequest{
+		ID:     id,
+		Method: "POST",
+		URL:    "/test",
+		Path:   "/test",
+		Body:   []byte(strings.Repeat("a", bodySize)),
+	}
+}
+
+func TestMemory_AddAndGet(t *testing.T) {
+	m := NewMemory(10, 1024)
+
+	req := newTestRequest("req-1", 10)
+	if err := m.Add(req); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	got, err := m.Get("req-1")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != req {
+		t.Errorf("Expected stored request, got %+v", got)
+	}
+
+	if _, err := m.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemory_ListNewestFirst(t *testing.T) {
+	m := NewMemory(10, 1024)
+
+	for i := 0; i < 3; i++ {
+		m.Add(newTestRequest("req-"+strconv.Itoa(i), 1))
+	}
+
+	list, err := m.List(Filter{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	expected := []string{"req-2", "req-1", "req-0"}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(list))
+	}
+	for i, id := range expected {
+		if list[i].ID != id {
+			t.Errorf("Expected request %d to be %s, got %s", i, id, list[i].ID)
+		}
+	}
+}
+
+func TestMemory_EvictsByCount(t *testing.T) {
+	m := NewMemory(3, 1<<20)
+
+	for i := 0; i < 5; i++ {
+		m.Add(newTestRequest("req-"+strconv.Itoa(i), 1))
+	}
+
+	if m.Len() != 3 {
+		t.Errorf("Expected 3 requests, got %d", m.Len())
+	}
+	if _, err := m.Get("req-1"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected oldest requests to be evicted")
+	}
+	if _, err := m.Get("req-4"); err != nil {
+		t.Error("Expected newest request to be kept")
+	}
+}
+
+func TestMemory_EvictsByBytes(t *testing.T) {
+	req := newTestRequest("req-0", 100)
+	m := NewMemory(100, 2*req.Size()+1)
+
+	for i := 0; i < 4; i++ {
+		m.Add(newTestRequest("req-"+strconv.Itoa(i), 100))
+	}
+
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 requests, got %d", m.Len())
+	}
+	if m.Bytes() > 2*req.Size()+1 {
+		t.Errorf("Expected at most %d bytes, got %d", 2*req.Size()+1, m.Bytes())
+	}
+}
+
+func TestMemory_KeepsOversizedNewest(t *testing.T) {
+	m := NewMemory(10, 10)
+
+	m.Add(newTestRequest("small", 1))
+	m.Add(newTestRequest("huge", 1000))
+
+	if m.Len() != 1 {
+		t.Errorf("Expected 1 request, got %d", m.Len())
+	}
+	if _, err := m.Get("huge"); err != nil {
+		t.Error("Expected oversized newest request to be kept")
+	}
+}
+
+func TestNewMemory_Defaults(t *testing.T) {
+	m := NewMemory(0, 0)
+
+	if len(m.ring) != DefaultMaxRequests {
+		t.Errorf("Expected capacity %d, got %d", DefaultMaxRequests, len(m.ring))
+	}
+	if m.maxBytes != DefaultMaxBytes {
+		t.Errorf("Expected max bytes %d, got %d", DefaultMaxBytes, m.maxBytes)
+	}
+}
+
+func TestMemory_Delete(t *testing.T) {
+	m := NewMemory(3, 1<<20)
+
+	// Wrap around the ring so the deleted entry is not at index zero
+	for i := 0; i < 5; i++ {
+		m.Add(newTestRequest("req-"+strconv.Itoa(i), 10))
+	}
+
+	if err := m.Delete("req-3"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := m.Delete("req-3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for repeated delete, got %v", err)
+	}
+
+	list, _ := m.List(Filter{})
+	if len(list) != 2 || list[0].ID != "req-4" || list[1].ID != "req-2" {
+		t.Errorf("Unexpected requests after delete: %v", list)
+	}
+
+	// The freed slot is reused without evicting anything
+	m.Add(newTestRequest("req-5", 10))
+	if m.Len() != 3 {
+		t.Errorf("Expected 3 requests, got %d", m.Len())
+	}
+	if m.Bytes() != 3*newTestRequest("x", 10).Size() {
+		t.Errorf("Unexpected byte count %d", m.Bytes())
+	}
+}
+
+func TestMemory_Clear(t *testing.T) {
+	m := NewMemory(3, 1<<20)
+	for i := 0; i < 5; i++ {
+		m.Add(newTestRequest("req-"+strconv.Itoa(i), 10))
+	}
+
+	if err := m.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if m.Len() != 0 || m.Bytes() != 0 {
+		t.Errorf("Expected empty store, got %d requests and %d bytes", m.Len(), m.Bytes())
+	}
+	if _, err := m.Get("req-4"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected cleared request to be gone")
+	}
+
+	m.Add(newTestRequest("after", 1))
+	if list, _ := m.List(Filter{}); len(list) != 1 || list[0].ID != "after" {
+		t.Errorf("Unexpected requests after clear: %v", list)
+	}
+}
+
+func TestMemory_Update(t *testing.T) {
+	m := NewMemory(10, 1024)
+	_ = m.Add(newTestRequest("req-1", 10))
+	_ = m.Add(newTestRequest("req-2", 10))
+
+	updated := newTestRequest("req-1", 30)
+	if err := m.Update(updated); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	got, _ := m.Get("req-1")
+	if got != updated {
+		t.Error("Expected updated request to replace the stored one")
+	}
+	list, _ := m.List(Filter{})
+	if len(list) != 2 || list[1] != updated {
+		t.Error("Expected updated request to keep its position")
+	}
+	if m.Bytes() != updated.Size()+newTestRequest("req-2", 10).Size() {
+		t.Errorf("Expected byte accounting to follow the update, got %d", m.Bytes())
+	}
+
+	if err := m.Update(newTestRequest("missing", 1)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a captured request does not exist
+var ErrNotFound = errors.New("request not found")
+
+// CapturedRequest is the canonical record of a request received by the server
+type CapturedRequest struct {
+	ID            string       `json:"id"`
+	Method        string       `json:"method"`
+	URL           string       `json:"url"`
+	Path          string       `json:"path"`
+	Query         string       `json:"query"`
+	Host          string       `json:"host"`
+	Proto         string       `json:"proto"`
+	RemoteAddr    string       `json:"remote_addr"`
+	Headers       http.Header  `json:"headers"`
+	Body          []byte       `json:"body,omitempty"`
+	BodySize      int64        `json:"body_size"`
+	BodyTruncated bool         `json:"body_truncated,omitempty"`
+	BodySHA256    string       `json:"body_sha256,omitempty"`
+	DecodedBody   []byte       `json:"decoded_body,omitempty"`
+	DecodeError   string       `json:"decode_error,omitempty"`
+	Content       *Content     `json:"content,omitempty"`
+	TLS           *TLSInfo     `json:"tls,omitempty"`
+	ReceivedAt    time.Time    `json:"received_at"`
+	CompletedAt   time.Time    `json:"completed_at"`
+	Response      *Response    `json:"response,omitempty"`
+	MockRule      string       `json:"mock_rule,omitempty"`
+	Handshake     string       `json:"handshake,omitempty"`
+	Webhook       *Webhook     `json:"webhook,omitempty"`
+	Duplicate     *Duplicate   `json:"duplicate,omitempty"`
+	CloudEvents   []CloudEvent `json:"cloudevents,omitempty"`
+	Upstream      *Upstream    `json:"upstream,omitempty"`
+	Diff          *Diff        `json:"diff,omitempty"`
+	Signature     *Signature   `json:"signature,omitempty"`
+}
+
+// TLSInfo describes the TLS connection a request arrived on
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name,omitempty"`
+	Protocol    string `json:"negotiated_protocol,omitempty"`
+}
+
+// Response describes what the server answered to a captured request
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Size    int64       `json:"size"`
+}
+
+// Upstream describes the exchange with the upstream a request was forwarded to
+type Upstream struct {
+	URL     string      `json:"url"`
+	Status  int         `json:"status,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    []byte      `json:"body,omitempty"`
+	// BodyTruncated is set when the body exceeded the capture limit
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+	// Latency is the time until the upstream response headers arrived
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	// Attempts is the number of times the request was sent, including retries
+	Attempts int `json:"attempts,omitempty"`
+	// FailedAt is when the last attempt failed, zero when the upstream accepted the request
+	FailedAt time.Time `json:"failed_at,omitzero"`
+}
+
+// Webhook is the normalised metadata of a webhook from a known provider
+type Webhook struct {
+	Provider string `json:"provider"`
+	// Event is the provider's event type or topic, such as "push" or "invoice.paid"
+	Event      string `json:"event,omitempty"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	// Attempt is the delivery attempt starting at 1, when the provider reports it
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// CloudEvent holds the context attributes of a CloudEvent carried by a request
+type CloudEvent struct {
+	// Mode is the content mode the event arrived in: "binary", "structured" or "batch"
+	Mode            string            `json:"mode"`
+	SpecVersion     string            `json:"specversion,omitempty"`
+	ID              string            `json:"id,omitempty"`
+	Source          string            `json:"source,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            string            `json:"time,omitempty"`
+	DataContentType string            `json:"datacontenttype,omitempty"`
+	DataSchema      string            `json:"dataschema,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty"`
+	// Errors lists the violations of the CloudEvents specification
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Content describes a request body decoded by its media type
+type Content struct {
+	MediaType string `json:"media_type"`
+	// Format is how the body was decoded: "json", "form", "xml", "ndjson", "text" or "binary"
+	Format  string `json:"format"`
+	Charset string `json:"charset,omitempty"`
+	// Sniffed is the media type detected from the body when none was declared or the body is binary
+	Sniffed string              `json:"sniffed,omitempty"`
+	Form    map[string][]string `json:"form,omitempty"`
+	// Root is the root element of an XML body and Operation the first element in the body of a SOAP envelope
+	Root      string `json:"root,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	// Records is the number of records of an NDJSON body
+	Records int    `json:"records,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Duplicate describes a request that was delivered before
+type Duplicate struct {
+	// By is what identified the earlier delivery: "delivery_id", "idempotency_key" or "body"
+	By  string `json:"by"`
+	Key string `json:"key"`
+	// Count is the number of deliveries so far, including this one
+	Count      int           `json:"count"`
+	FirstID    string        `json:"first_id"`
+	FirstSeen  time.Time     `json:"first_seen"`
+	SinceFirst time.Duration `json:"since_first"`
+	// FirstStatus is the status the first delivery was answered with, zero if it had not completed yet
+	FirstStatus int `json:"first_status,omitempty"`
+}
+
+// Signature is the result of verifying the webhook signature of a request
+type Signature struct {
+	Provider string `json:"provider"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+	// Received is the sent signature when it differs from the computed one, which is never recorded
+	Received string `json:"received,omitempty"`
+}
+
+// Diff is the comparison of the upstream response with the response of a candidate upstream
+type Diff struct {
+	Candidate string `json:"candidate"`
+	// Status is the status of the candidate response, zero when the candidate failed
+	Status      int          `json:"status,omitempty"`
+	Equal       bool         `json:"equal"`
+	Differences []Difference `json:"differences,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	ComparedAt  time.Time    `json:"compared_at"`
+}
+
+// Difference is a single field whose value differs between the primary and the candidate response
+type Difference struct {
+	// Field is "status", "header:<Name>", "body" or a JSON path into the body such as "body:$.items[0].id"
+	Field     string `json:"field"`
+	Primary   any    `json:"primary,omitempty"`
+	Candidate any    `json:"candidate,omitempty"`
+}
+
+// Store keeps captured requests for later inspection
+type Store interface {
+	// Add stores a captured request, evicting older ones if needed
+	Add(req *CapturedRequest) error
+	// Update replaces a stored request with a new version of it, stored requests are never modified in place
+	Update(req *CapturedRequest) error
+	// Get returns the captured request with the given ID
+	Get(id string) (*CapturedRequest, error)
+	// List returns the captured requests matching the filter, newest first
+	List(f Filter) ([]*CapturedRequest, error)
+	// Delete removes the captured request with the given ID
+	Delete(id string) error
+	// Clear removes all captured requests
+	Clear() error
+	// Len returns the number of captured requests
+	Len() int
+	// Close releases resources held by the store
+	Close() error
+}
+
+// NewID returns a new unique, roughly time-ordered request ID
+func NewID() string {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + hex.EncodeToString(b[:])
+}
+
+// NewTLSInfo converts a connection state into TLSInfo, returning nil for plain connections
+func NewTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		Protocol:    state.NegotiatedProtocol,
+	}
+}
+
+// IsSensitiveHeader reports whether a header carries credentials that must not be exposed
+func IsSensitiveHeader(key string) bool {
+	sensitive := []string{
+		"authorization", "cookie", "set-cookie", "x-api-key", "x-auth-token",
+		"proxy-authorization", "www-authenticate", "proxy-authenticate",
+	}
+	lowerKey := strings.ToLower(key)
+	for _, s := range sensitive {
+		if lowerKey == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders returns a copy of h with the values of sensitive headers replaced
+func RedactHeaders(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		if IsSensitiveHeader(k) {
+			redacted[k] = []string{"[REDACTED]"}
+		} else {
+			redacted[k] = v
+		}
+	}
+	return redacted
+}
+
+// Redacted returns a shallow copy of the request with sensitive request and response headers redacted
+func (r *CapturedRequest) Redacted() *CapturedRequest {
+	cp := *r
+	cp.Headers = RedactHeaders(r.Headers)
+	if r.Response != nil {
+		resp := *r.Response
+		resp.Headers = RedactHeaders(r.Response.Headers)
+		cp.Response = &resp
+	}
+	if r.Upstream != nil {
+		upstream := *r.Upstream
+		upstream.Headers = RedactHeaders(r.Upstream.Headers)
+		cp.Upstream = &upstream
+	}
+	return &cp
+}
+
+// Size returns the approximate number of bytes the request occupies in a store
+func (r *CapturedRequest) Size() int64 {
+	size := int64(len(r.Method) + len(r.URL) + len(r.RemoteAddr) + len(r.Body) + len(r.DecodedBody))
+	size += headerSize(r.Headers)
+	if r.Response != nil {
+		size += headerSize(r.Response.Headers)
+	}
+	if r.Upstream != nil {
+		size += int64(len(r.Upstream.URL)+len(r.Upstream.Body)) + headerSize(r.Upstream.Headers)
+	}
+	if r.Diff != nil {
+		for _, d := range r.Diff.Differences {
+			size += int64(len(d.Field) + len(fmt.Sprint(d.Primary)) + len(fmt.Sprint(d.Candidate)))
+		}
+	}
+	return size
+}
+
+func headerSize(h http.Header) int64 {
+	var size int64
+	for k, v := range h {
+		for _, s := range v {
+			size += int64(len(k) + len(s))
+		}
+	}
+	return size
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"testing"
+)
+
+func TestNewID_Unique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := NewID()
+		if seen[id] {
+			t.Fatalf("Duplicate ID generated: %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewTLSInfo(t *testing.T) {
+	if info := NewTLSInfo(nil); info != nil {
+		t.Errorf("Expected nil TLS info for plain connection, got %+v", info)
+	}
+
+	info := NewTLSInfo(&tls.ConnectionState{
+		Version:     tls.VersionTLS13,
+		CipherSuite: tls.TLS_AES_128_GCM_SHA256,
+		ServerName:  "example.com",
+	})
+	if info.Version != "TLS 1.3" {
+		t.Errorf("Expected version TLS 1.3, got %s", info.Version)
+	}
+	if info.CipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("Expected cipher suite TLS_AES_128_GCM_SHA256, got %s", info.CipherSuite)
+	}
+	if info.ServerName != "example.com" {
+		t.Errorf("Expected server name example.com, got %s", info.ServerName)
+	}
+}
+
+func TestCapturedRequest_Size(t *testing.T) {
+	req := &CapturedRequest{
+		Method:  "POST",
+		URL:     "/a",
+		Headers: http.Header{"X-Test": {"abc"}},
+		Body:    []byte("hello"),
+	}
+
+	// 4 (method) + 2 (url) + 5 (body) + 6+3 (header)
+	if size := req.Size(); size != 20 {
+		t.Errorf("Expected size 20, got %d", size)
+	}
+
+	// + 5 (upstream url) + 2 (upstream body) + 1+1 (upstream header)
+	req.Upstream = &Upstream{URL: "http:", Body: []byte("ok"), Headers: http.Header{"A": {"b"}}}
+	if size := req.Size(); size != 29 {
+		t.Errorf("Expected size 29, got %d", size)
+	}
+}
+
+func TestCapturedRequest_Redacted(t *testing.T) {
+	req := &CapturedRequest{
+		Headers: http.Header{"Authorization": {"Bearer secret"}, "Accept": {"*/*"}},
+		Response: &Response{
+			Status:  200,
+			Headers: http.Header{"Set-Cookie": {"session=abc"}},
+		},
+		Upstream: &Upstream{
+			Status:  200,
+			Headers: http.Header{"Set-Cookie": {"upstream=abc"}},
+		},
+	}
+
+	redacted := req.Redacted()
+	if redacted.Headers.Get("Authorization") != "[REDACTED]" {
+		t.Errorf("Expected Authorization to be redacted, got %s", redacted.Headers.Get("Authorization"))
+	}
+	if redacted.Headers.Get("Accept") != "*/*" {
+		t.Errorf("Expected Accept to be kept, got %s", redacted.Headers.Get("Accept"))
+	}
+	if redacted.Response.Headers.Get("Set-Cookie") != "[REDACTED]" {
+		t.Error("Expected response Set-Cookie to be redacted")
+	}
+	if redacted.Upstream.Headers.Get("Set-Cookie") != "[REDACTED]" {
+		t.Error("Expected upstream Set-Cookie to be redacted")
+	}
+	if req.Headers.Get("Authorization") != "Bearer secret" {
+		t.Error("Expected original request to be left untouched")
+	}
+}
+
+func TestContext(t *testing.T) {
+	if req := FromContext(context.Background()); req != nil {
+		t.Errorf("Expected nil request from empty context, got %+v", req)
+	}
+
+	req := &CapturedRequest{ID: "ctx"}
+	if got := FromContext(NewContext(context.Background(), req)); got != req {
+		t.Errorf("Expected request from context, got %+v", got)
+	}
+}
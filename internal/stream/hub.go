@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before events are dropped
+const subscriberBuffer = 64
+
+// Hub fans captured requests out to live subscribers.
+type Hub struct {
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	closed  bool
+	origins []string
+}
+
+// Subscription receives the captured requests matching its filter.
+// C is closed when the subscription ends.
+type Subscription struct {
+	C       <-chan *store.CapturedRequest
+	ch      chan *store.CapturedRequest
+	filter  store.Filter
+	dropped int
+}
+
+// NewHub creates a new event hub.
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// AllowOrigins lets pages from other origins than the server itself connect to the WebSocket stream,
+// without raw output. It must be called before the hub serves requests.
+func (h *Hub) AllowOrigins(origins []string) {
+	h.origins = origins
+}
+
+// Subscribe registers a subscriber for captured requests matching the filter.
+func (h *Hub) Subscribe(f store.Filter) *Subscription {
+	ch := make(chan *store.CapturedRequest, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: f}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish delivers a captured request to all matching subscribers.
+// Slow subscribers miss events rather than blocking the request path.
+func (h *Hub) Publish(req *store.CapturedRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if !sub.filter.Match(req) {
+			continue
+		}
+		select {
+		case sub.ch <- req:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Close ends all subscriptions. Subscribing after Close yields closed subscriptions.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		close(sub.ch)
+	}
+	clear(h.subs)
+	h.closed = true
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Dropped returns the number of events the subscriber missed because it was too slow.
+func (h *Hub) Dropped(sub *Subscription) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return sub.dropped
+}
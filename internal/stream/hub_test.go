@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func TestHub_PublishMatchesFilter(t *testing.T) {
+	h := NewHub()
+	all := h.Subscribe(store.Filter{})
+	posts := h.Subscribe(store.Filter{Method: "POST", PathPrefix: "/webhooks/"})
+
+	h.Publish(&store.CapturedRequest{ID: "1", Method: "GET", Path: "/webhooks/a"})
+	h.Publish(&store.CapturedRequest{ID: "2", Method: "POST", Path: "/webhooks/b"})
+
+	if got := len(all.C); got != 2 {
+		t.Errorf("Expected 2 events for unfiltered subscriber, got %d", got)
+	}
+	if got := len(posts.C); got != 1 {
+		t.Fatalf("Expected 1 event for filtered subscriber, got %d", got)
+	}
+	if req := <-posts.C; req.ID != "2" {
+		t.Errorf("Expected event 2, got %s", req.ID)
+	}
+}
+
+func TestHub_DropsForSlowSubscribers(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(store.Filter{})
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		h.Publish(&store.CapturedRequest{ID: "x"})
+	}
+
+	if got := h.Dropped(sub); got != 5 {
+		t.Errorf("Expected 5 dropped events, got %d", got)
+	}
+}
+
+func TestHub_UnsubscribeAndClose(t *testing.T) {
+	h := NewHub()
+	a := h.Subscribe(store.Filter{})
+	b := h.Subscribe(store.Filter{})
+
+	h.Unsubscribe(a)
+	if _, ok := <-a.C; ok {
+		t.Error("Expected unsubscribed channel to be closed")
+	}
+	h.Unsubscribe(a) // must not panic
+
+	h.Close()
+	if _, ok := <-b.C; ok {
+		t.Error("Expected channel to be closed by Close")
+	}
+	if h.Subscribers() != 0 {
+		t.Errorf("Expected no subscribers after Close, got %d", h.Subscribers())
+	}
+
+	late := h.Subscribe(store.Filter{})
+	if _, ok := <-late.C; ok {
+		t.Error("Expected subscription after Close to be closed")
+	}
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// keepAliveInterval is how often idle streams send a keep-alive so proxies do not cut them
+const keepAliveInterval = 15 * time.Second
+
+// ServeSSE streams captured requests as Server-Sent Events.
+// The query string accepts the same filter parameters as the request list, plus raw=true.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	filter, raw, err := parseStreamQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Disable the server write timeout for this long-lived response
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// An initial comment lets clients know the stream is established
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		slog.Error("Streaming not supported by response writer", "error", err)
+		return
+	}
+
+	sub := h.Subscribe(filter)
+	defer h.Unsubscribe(sub)
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case req, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := encodeEvent(req, raw)
+			if err != nil {
+				slog.Error("Failed to encode event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: request\nid: %s\ndata: %s\n\n", req.ID, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func parseStreamQuery(r *http.Request) (store.Filter, bool, error) {
+	q := r.URL.Query()
+	filter, err := store.ParseFilter(q)
+	if err != nil {
+		return store.Filter{}, false, err
+	}
+	raw, _ := strconv.ParseBool(q.Get("raw"))
+	return filter, raw, nil
+}
+
+func encodeEvent(req *store.CapturedRequest, raw bool) ([]byte, error) {
+	if !raw {
+		req = req.Redacted()
+	}
+	return json.Marshal(req)
+}
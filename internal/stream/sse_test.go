@@ -0,0 +1,120 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// waitForSubscribers blocks until the hub has n subscribers
+func waitForSubscribers(t *testing.T, h *Hub, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for h.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d subscribers, have %d", n, h.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHub_ServeSSE(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeSSE))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?method=POST")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	waitForSubscribers(t, h, 1)
+	h.Publish(&store.CapturedRequest{ID: "skip", Method: "GET", Path: "/"})
+	h.Publish(&store.CapturedRequest{
+		ID:      "evt-1",
+		Method:  "POST",
+		Path:    "/webhook",
+		Headers: http.Header{"Authorization": {"Bearer secret"}},
+	})
+
+	reader := bufio.NewReader(resp.Body)
+	var event, id, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	if event != "request" || id != "evt-1" {
+		t.Errorf("Expected request event evt-1, got %s %s", event, id)
+	}
+
+	var req store.CapturedRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if req.Headers.Get("Authorization") != "[REDACTED]" {
+		t.Errorf("Expected sensitive headers to be redacted, got %s", req.Headers.Get("Authorization"))
+	}
+}
+
+func TestHub_ServeSSE_ClosedByHub(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeSSE))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	waitForSubscribers(t, h, 1)
+	h.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bufio.NewReader(resp.Body).ReadString(0)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected stream to end when the hub is closed")
+	}
+}
+
+func TestHub_ServeSSE_InvalidFilter(t *testing.T) {
+	h := NewHub()
+	req := httptest.NewRequest("GET", "/?since=yesterday", nil)
+	rr := httptest.NewRecorder()
+
+	h.ServeSSE(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
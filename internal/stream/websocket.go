@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by the WebSocket handshake (RFC 6455)
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket protocol constants from RFC 6455
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+
+	maxControlPayload = 125
+	writeTimeout      = 10 * time.Second
+)
+
+var errProtocol = errors.New("websocket protocol error")
+
+// ServeWebSocket streams captured requests as WebSocket text messages, one JSON document per message.
+// The query string accepts the same filter parameters as the request list, plus raw=true.
+func (h *Hub) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, raw, err := parseStreamQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Browsers do not apply CORS to WebSocket, so any page could read captured requests without this check
+	if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) {
+		if !slices.Contains(h.origins, origin) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if raw {
+			http.Error(w, "raw output is not allowed for other origins", http.StatusForbidden)
+			return
+		}
+	}
+
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	netConn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		slog.Error("Failed to hijack connection for WebSocket", "error", err)
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	defer netConn.Close()
+
+	conn := &wsConn{conn: netConn, reader: brw.Reader}
+	if err := conn.handshake(key); err != nil {
+		return
+	}
+
+	sub := h.Subscribe(filter)
+	defer h.Unsubscribe(sub)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.readLoop()
+	}()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-keepAlive.C:
+			if err := conn.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		case req, ok := <-sub.C:
+			if !ok {
+				_ = conn.writeFrame(opClose, closePayload(1001))
+				return
+			}
+			data, err := encodeEvent(req, raw)
+			if err != nil {
+				slog.Error("Failed to encode event", "error", err)
+				continue
+			}
+			if err := conn.writeFrame(opText, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsConn is a minimal server side WebSocket connection that only sends messages
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) handshake(key string) error {
+	sum := sha1.Sum([]byte(key + websocketGUID)) //nolint:gosec // required by RFC 6455
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := fmt.Fprintf(c.conn,
+		"HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		accept)
+	return err
+}
+
+// readLoop answers control frames and discards data frames until the client closes the connection
+func (c *wsConn) readLoop() {
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(3 * keepAliveInterval))
+
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case opClose:
+			_ = c.writeFrame(opClose, payload)
+			return
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	// Clients must mask their frames and control frames must be small
+	if !masked || (opcode >= opClose && length > maxControlPayload) {
+		return 0, nil, errProtocol
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	// Data frames are not used by this endpoint, skip them without buffering
+	if opcode < opClose {
+		if _, err := io.CopyN(io.Discard, c.reader, int64(length)); err != nil { //nolint:gosec // bounded by the reader
+			return 0, nil, err
+		}
+		return opcode, nil, nil
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func closePayload(code uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, code)
+}
+
+// sameOrigin reports whether an Origin header names the host a request was sent to
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// dialWebSocket performs a client handshake and returns the raw connection
+func dialWebSocket(t *testing.T, serverURL, query string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	_, err = io.WriteString(conn, "GET /?"+query+" HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+	// Example key and accept value from RFC 6455 section 1.3
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected Sec-WebSocket-Accept %s", accept)
+	}
+	return conn, reader
+}
+
+// readServerFrame reads a single unmasked frame sent by the server
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("Read frame header failed: %v", err)
+	}
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("Read frame payload failed: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// writeClientFrame writes a masked frame as a client would
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write frame failed: %v", err)
+	}
+}
+
+func TestHub_ServeWebSocket(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWebSocket))
+	defer srv.Close()
+
+	conn, reader := dialWebSocket(t, srv.URL, "prefix=/webhooks/")
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	waitForSubscribers(t, h, 1)
+	h.Publish(&store.CapturedRequest{ID: "skip", Method: "GET", Path: "/other"})
+	h.Publish(&store.CapturedRequest{ID: "ws-1", Method: "POST", Path: "/webhooks/github"})
+
+	opcode, payload := readServerFrame(t, reader)
+	if opcode != opText {
+		t.Fatalf("Expected text frame, got opcode %d", opcode)
+	}
+	var req store.CapturedRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if req.ID != "ws-1" {
+		t.Errorf("Expected request ws-1, got %s", req.ID)
+	}
+
+	// Pings are answered with pongs carrying the same payload
+	writeClientFrame(t, conn, opPing, []byte("hi"))
+	opcode, payload = readServerFrame(t, reader)
+	if opcode != opPong || string(payload) != "hi" {
+		t.Errorf("Expected pong with payload hi, got opcode %d payload %q", opcode, payload)
+	}
+
+	// A close frame is echoed and the subscription ends
+	writeClientFrame(t, conn, opClose, closePayload(1000))
+	opcode, _ = readServerFrame(t, reader)
+	if opcode != opClose {
+		t.Errorf("Expected close frame, got opcode %d", opcode)
+	}
+	waitForSubscribers(t, h, 0)
+}
+
+func TestHub_ServeWebSocket_RequiresUpgrade(t *testing.T) {
+	h := NewHub()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	h.ServeWebSocket(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	rr = httptest.NewRecorder()
+	h.ServeWebSocket(rr, req)
+	if rr.Code != http.StatusUpgradeRequired {
+		t.Errorf("Expected status %d, got %d", http.StatusUpgradeRequired, rr.Code)
+	}
+}
+
+func TestHub_ServeWebSocket_ChecksOrigin(t *testing.T) {
+	h := NewHub()
+	h.AllowOrigins([]string{"https://dashboard.example.com"})
+
+	tests := []struct {
+		name   string
+		origin string
+		query  string
+		status int
+	}{
+		{"foreign origin", "https://evil.example.com", "", http.StatusForbidden},
+		{"foreign origin with raw output", "https://evil.example.com", "raw=true", http.StatusForbidden},
+		{"allowed origin", "https://dashboard.example.com", "", http.StatusBadRequest},
+		{"allowed origin with raw output", "https://dashboard.example.com", "raw=true", http.StatusForbidden},
+		{"same origin with raw output", "http://localhost:8080", "raw=true", http.StatusBadRequest},
+		{"no origin", "", "raw=true", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Requests passing the origin check fail later for lacking the upgrade headers
+			req := httptest.NewRequest("GET", "http://localhost:8080/?"+tt.query, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeWebSocket(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package vcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBody_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body Body
+		want string
+	}{
+		{"text", Body(`{"id":1}`), `"{\"id\":1}"`},
+		{"empty", Body(""), `""`},
+		{"binary", Body{0xff, 0x00, 0x01}, `{"base64":"/wAB"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, data)
+			}
+
+			var decoded Body
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.body) {
+				t.Errorf("Expected %q after round trip, got %q", tt.body, decoded)
+			}
+		})
+	}
+
+	var b Body
+	if err := json.Unmarshal([]byte(`{"base64":"***"}`), &b); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+	if err := json.Unmarshal([]byte(`42`), &b); err == nil {
+		t.Error("Expected error for a number")
+	}
+}
+
+func TestCassette_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	c := &Cassette{Interactions: []Interaction{{
+		Request:  Request{Method: "GET", Path: "/users", BodySHA256: BodyHash(nil)},
+		Response: Response{Status: 200, Body: Body(`[]`)},
+	}}}
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette failed: %v", err)
+	}
+	if len(loaded.Interactions) != 1 || loaded.Interactions[0].Request.Path != "/users" ||
+		string(loaded.Interactions[0].Response.Body) != "[]" {
+		t.Errorf("Unexpected cassette %+v", loaded)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to remain, got %d entries", len(entries))
+	}
+
+	if _, err := LoadCassette(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing cassette")
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCassette(path); err == nil {
+		t.Error("Expected error for invalid cassette")
+	}
+}
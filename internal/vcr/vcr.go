@@ -0,0 +1,326 @@
+package vcr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czechbol/request-raccoon/internal/api"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Modes of operation
+const (
+	ModeRecord   = "record"
+	ModePlayback = "playback"
+)
+
+// Request keys interactions can be matched by
+const (
+	KeyMethod = "method"
+	KeyPath   = "path"
+	KeyQuery  = "query"
+	KeyBody   = "body"
+)
+
+// DefaultKeys are the request keys used when none are configured
+var DefaultKeys = []string{KeyMethod, KeyPath, KeyQuery}
+
+// ErrInvalidKey is returned for an unknown request key
+var ErrInvalidKey = errors.New("invalid match key")
+
+// flushInterval is how long recorded exchanges are collected before the cassette file is written
+const flushInterval = time.Second
+
+// Recorder appends the exchanges of forwarded requests to a cassette file.
+// Exchanges are written in batches, at most a second after they were recorded, and on Close.
+// The cassette is replaced by the first batch, so every recording starts empty.
+type Recorder struct {
+	path string
+
+	mu       sync.Mutex
+	cassette Cassette
+	// flush is the pending write of exchanges recorded since the last one, nil when there are none
+	flush *time.Timer
+}
+
+// NewRecorder creates a recorder writing to the cassette file at path.
+func NewRecorder(path string) *Recorder {
+	return &Recorder{
+		path: path,
+	}
+}
+
+// Close writes the exchanges that are not in the cassette file yet.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.save()
+}
+
+// Handler passes requests to next, usually the upstream proxy, and records the upstream responses.
+// Failed exchanges and responses larger than the capture limit are not recorded.
+func (r *Recorder) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req)
+
+		rec := store.FromContext(req.Context())
+		if rec == nil || rec.Upstream == nil {
+			return
+		}
+		if rec.Upstream.Error != "" || rec.Upstream.BodyTruncated {
+			slog.Warn("Exchange not recorded to cassette",
+				"request_id", rec.ID,
+				"error", rec.Upstream.Error,
+				"body_truncated", rec.Upstream.BodyTruncated)
+			return
+		}
+
+		if err := r.record(rec); err != nil {
+			slog.Error("Failed to record exchange", "error", err, "cassette", r.path, "request_id", rec.ID)
+		}
+	})
+}
+
+func (r *Recorder) record(rec *store.CapturedRequest) error {
+	// The captured body stops at the capture limit, while players hash the whole body they receive
+	bodyHash := rec.BodySHA256
+	if bodyHash == "" {
+		bodyHash = BodyHash(rec.Body)
+	}
+
+	interaction := Interaction{
+		Request: Request{
+			Method:     rec.Method,
+			Path:       rec.Path,
+			Query:      rec.Query,
+			Headers:    store.RedactHeaders(rec.Headers),
+			BodySHA256: bodyHash,
+		},
+		Response: Response{
+			Status:  rec.Upstream.Status,
+			Headers: store.RedactHeaders(rec.Upstream.Headers),
+			Body:    rec.Upstream.Body,
+		},
+		RecordedAt: time.Now().UTC(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	if r.flush == nil {
+		r.flush = time.AfterFunc(flushInterval, r.flushLater)
+	}
+	slog.Debug("Recorded exchange",
+		"cassette", r.path,
+		"request_id", rec.ID,
+		"interactions", len(r.cassette.Interactions))
+	return nil
+}
+
+func (r *Recorder) flushLater() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.save(); err != nil {
+		slog.Error("Failed to write cassette", "error", err, "cassette", r.path)
+		// Try again with the next batch
+		r.flush = time.AfterFunc(flushInterval, r.flushLater)
+	}
+}
+
+// save writes the cassette file if exchanges were recorded since the last write. The caller holds mu.
+func (r *Recorder) save() error {
+	if r.flush == nil {
+		return nil
+	}
+	r.flush.Stop()
+	r.flush = nil
+	if err := r.cassette.Save(r.path); err != nil {
+		return err
+	}
+	slog.Debug("Wrote cassette", "cassette", r.path, "interactions", len(r.cassette.Interactions))
+	return nil
+}
+
+// Player answers requests with the recorded responses of a cassette.
+type Player struct {
+	keys   []string
+	strict bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	// played counts how often each interaction was served
+	played []int
+}
+
+// NewPlayer creates a player for the cassette file at path, matching requests by the given keys.
+// In strict mode requests without a recorded interaction fail instead of being passed on.
+func NewPlayer(path string, keys []string, strict bool) (*Player, error) {
+	if len(keys) == 0 {
+		keys = DefaultKeys
+	}
+	for _, key := range keys {
+		switch key {
+		case KeyMethod, KeyPath, KeyQuery, KeyBody:
+		default:
+			return nil, fmt.Errorf("%w %q, expected %s, %s, %s or %s",
+				ErrInvalidKey, key, KeyMethod, KeyPath, KeyQuery, KeyBody)
+		}
+	}
+
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Player{
+		keys:         keys,
+		strict:       strict,
+		interactions: c.Interactions,
+		played:       make([]int, len(c.Interactions)),
+	}, nil
+}
+
+// Handler answers requests with a recorded response. Requests matching several interactions get them
+// in recording order, then the last one again. Unmatched requests are passed to fallback, or answered
+// with 502 in strict mode.
+func (p *Player) Handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var bodyHash string
+		if slices.Contains(p.keys, KeyBody) {
+			var err error
+			if bodyHash, err = requestBodyHash(r); err != nil {
+				api.WriteError(w, http.StatusBadRequest, "failed to read request body")
+				return
+			}
+		}
+
+		interaction, ok := p.match(r, bodyHash)
+		if !ok {
+			if p.strict {
+				slog.Warn("No recorded interaction matches request", "method", r.Method, "path", r.URL.Path)
+				message := "no recorded interaction matches " + r.Method + " " + r.URL.RequestURI()
+				api.WriteError(w, http.StatusBadGateway, message)
+				return
+			}
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		for name, values := range interaction.Response.Headers {
+			w.Header()[name] = values
+		}
+		// The body may have been edited since it was recorded
+		w.Header().Set("Content-Length", strconv.Itoa(len(interaction.Response.Body)))
+		status := interaction.Response.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(interaction.Response.Body)
+	})
+}
+
+// match returns the next interaction recorded for the request
+func (p *Player) match(r *http.Request, bodyHash string) (Interaction, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last := -1
+	for i, interaction := range p.interactions {
+		if !p.matches(interaction.Request, r, bodyHash) {
+			continue
+		}
+		if p.played[i] == 0 {
+			p.played[i]++
+			return interaction, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return Interaction{}, false
+	}
+	p.played[last]++
+	return p.interactions[last], true
+}
+
+func (p *Player) matches(recorded Request, r *http.Request, bodyHash string) bool {
+	for _, key := range p.keys {
+		switch key {
+		case KeyMethod:
+			if !strings.EqualFold(recorded.Method, r.Method) {
+				return false
+			}
+		case KeyPath:
+			if recorded.Path != r.URL.Path {
+				return false
+			}
+		case KeyQuery:
+			if normalizeQuery(recorded.Query) != normalizeQuery(r.URL.RawQuery) {
+				return false
+			}
+		case KeyBody:
+			if recorded.BodySHA256 != bodyHash {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// normalizeQuery sorts query parameters so their order does not matter
+func normalizeQuery(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	return values.Encode()
+}
+
+// requestBodyHash returns the hash of the whole request body. The hash of the captured request is used when
+// there is one, otherwise the body is streamed through the hash, from GetBody when the logging middleware spooled
+// it. Only requests with neither are read into memory, and restored for the fallback.
+func requestBodyHash(r *http.Request) (string, error) {
+	if rec := store.FromContext(r.Context()); rec != nil {
+		switch {
+		case rec.BodySHA256 != "":
+			return rec.BodySHA256, nil
+		case rec.BodySize == 0:
+			return BodyHash(nil), nil
+		}
+	}
+
+	h := sha256.New()
+	switch {
+	case r.GetBody != nil:
+		body, err := r.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		if _, err = io.Copy(h, body); err != nil {
+			return "", err
+		}
+	case r.Body != nil && r.Body != http.NoBody:
+		var body bytes.Buffer
+		if _, err := io.Copy(h, io.TeeReader(r.Body, &body)); err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(&body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,274 @@
+package vcr
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// upstream stands in for the proxy, answering and recording the exchange on the captured request
+func upstream(status int, body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+
+		if rec := store.FromContext(r.Context()); rec != nil {
+			rec.Upstream = &store.Upstream{
+				URL:     "http://upstream" + r.URL.Path,
+				Status:  status,
+				Headers: w.Header().Clone(),
+				Body:    []byte(body),
+			}
+		}
+	})
+}
+
+// capture serves a request the way the logging middleware does, with a captured request in the context
+func capture(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := &store.CapturedRequest{
+		ID:       store.NewID(),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Headers:  r.Header.Clone(),
+		Body:     []byte(body),
+		BodySize: int64(len(body)),
+	}
+	if body != "" {
+		rec.BodySHA256 = BodyHash([]byte(body))
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+	return rr
+}
+
+func writeCassette(t *testing.T, interactions ...Interaction) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := (&Cassette{Interactions: interactions}).Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return path
+}
+
+func interaction(method, path, query, body string, status int, response string) Interaction {
+	return Interaction{
+		Request:  Request{Method: method, Path: path, Query: query, BodySHA256: BodyHash([]byte(body))},
+		Response: Response{Status: status, Headers: http.Header{"X-Recorded": {"true"}}, Body: Body(response)},
+	}
+}
+
+var notRecorded = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusTeapot)
+})
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	r := NewRecorder(path)
+
+	rr := capture(r.Handler(upstream(http.StatusCreated, `{"id":1}`)), "POST", "/users?team=a", `{"name":"a"}`)
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id":1}` {
+		t.Errorf("Expected the upstream response, got %d %s", rr.Code, rr.Body.String())
+	}
+	capture(r.Handler(upstream(http.StatusOK, `[]`)), "GET", "/users", "")
+
+	// Exchanges are written in batches, the last one on Close
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the cassette to be written later, got %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	c, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette failed: %v", err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("Expected 2 interactions, got %d", len(c.Interactions))
+	}
+
+	got := c.Interactions[0]
+	if got.Request.Method != "POST" || got.Request.Path != "/users" || got.Request.Query != "team=a" ||
+		got.Request.BodySHA256 != BodyHash([]byte(`{"name":"a"}`)) {
+		t.Errorf("Unexpected recorded request %+v", got.Request)
+	}
+	if got.Response.Status != http.StatusCreated || string(got.Response.Body) != `{"id":1}` ||
+		got.Response.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected recorded response %+v", got.Response)
+	}
+	if got.Request.Headers.Get("Authorization") != "[REDACTED]" || got.Response.Headers.Get("Set-Cookie") != "[REDACTED]" {
+		t.Error("Expected sensitive headers to be redacted in the cassette")
+	}
+	if got.RecordedAt.IsZero() {
+		t.Error("Expected recording time to be set")
+	}
+}
+
+func TestRecorder_TruncatedBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	r := NewRecorder(path)
+
+	// The middleware keeps the head of a body over the capture limit, with the hash of the whole body
+	body := strings.Repeat(`{"name":"a"}`, 1000)
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+	rec := &store.CapturedRequest{
+		ID:            store.NewID(),
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Body:          []byte(body[:1024]),
+		BodySize:      int64(len(body)),
+		BodyTruncated: true,
+		BodySHA256:    BodyHash([]byte(body)),
+	}
+	r.Handler(upstream(http.StatusCreated, `{"id":1}`)).ServeHTTP(httptest.NewRecorder(), req.WithContext(store.NewContext(req.Context(), rec)))
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	p, err := NewPlayer(path, []string{KeyMethod, KeyPath, KeyBody}, true)
+	if err != nil {
+		t.Fatalf("NewPlayer failed: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	p.Handler(notRecorded).ServeHTTP(rr, httptest.NewRequest("POST", "/users", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id":1}` {
+		t.Errorf("Expected the whole body to match the recording, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRecorder_SkipsFailedExchanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	r := NewRecorder(path)
+
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store.FromContext(r.Context()).Upstream = &store.Upstream{Error: "connection refused"}
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	capture(r.Handler(failing), "GET", "/users", "")
+	capture(r.Handler(notRecorded), "GET", "/users", "")
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := LoadCassette(path); err == nil {
+		t.Error("Expected no cassette to be written")
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	path := writeCassette(t,
+		interaction("GET", "/users", "page=1&size=10", "", http.StatusOK, `["first"]`),
+		interaction("GET", "/users", "page=1&size=10", "", http.StatusOK, `["second"]`),
+		interaction("POST", "/users", "", `{"name":"a"}`, http.StatusCreated, `{"id":1}`),
+	)
+	p, err := NewPlayer(path, []string{KeyMethod, KeyPath, KeyQuery, KeyBody}, false)
+	if err != nil {
+		t.Fatalf("NewPlayer failed: %v", err)
+	}
+	h := p.Handler(notRecorded)
+
+	// Repeated requests get the recorded responses in order, then the last one again
+	for _, want := range []string{`["first"]`, `["second"]`, `["second"]`} {
+		rr := capture(h, "GET", "/users?size=10&page=1", "")
+		if rr.Code != http.StatusOK || rr.Body.String() != want || rr.Header().Get("X-Recorded") != "true" {
+			t.Errorf("Expected %s, got %d %s", want, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := capture(h, "POST", "/users", `{"name":"a"}`); rr.Code != http.StatusCreated || rr.Header().Get("Content-Length") != "8" {
+		t.Errorf("Expected recorded POST response, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := capture(h, "POST", "/users", `{"name":"b"}`); rr.Code != http.StatusTeapot {
+		t.Errorf("Expected a different body to fall through, got %d", rr.Code)
+	}
+	if rr := capture(h, "GET", "/users?page=2", ""); rr.Code != http.StatusTeapot {
+		t.Errorf("Expected a different query to fall through, got %d", rr.Code)
+	}
+}
+
+func TestPlayer_Keys(t *testing.T) {
+	path := writeCassette(t, interaction("POST", "/search", "q=a", `{"a":1}`, http.StatusOK, `found`))
+	p, err := NewPlayer(path, []string{KeyMethod, KeyPath}, false)
+	if err != nil {
+		t.Fatalf("NewPlayer failed: %v", err)
+	}
+
+	if rr := capture(p.Handler(notRecorded), "POST", "/search?q=b", `{"b":2}`); rr.Body.String() != "found" {
+		t.Errorf("Expected query and body to be ignored, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if _, err := NewPlayer(path, []string{"host"}, false); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if _, err := NewPlayer(filepath.Join(t.TempDir(), "missing.json"), nil, false); err == nil {
+		t.Error("Expected error for missing cassette")
+	}
+}
+
+func TestPlayer_Strict(t *testing.T) {
+	path := writeCassette(t, interaction("GET", "/users", "", "", 0, `[]`))
+	p, err := NewPlayer(path, nil, true)
+	if err != nil {
+		t.Fatalf("NewPlayer failed: %v", err)
+	}
+	h := p.Handler(notRecorded)
+
+	if rr := capture(h, "GET", "/users", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected recorded response with default status, got %d", rr.Code)
+	}
+	rr := capture(h, "GET", "/orders", "")
+	if rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "no recorded interaction matches GET /orders") {
+		t.Errorf("Expected unmatched request to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPlayer_BodyHash(t *testing.T) {
+	body := strings.Repeat(`{"name":"a"}`, 1000)
+	path := writeCassette(t, interaction("POST", "/users", "", body, http.StatusCreated, `{"id":1}`))
+	p, err := NewPlayer(path, []string{KeyMethod, KeyPath, KeyBody}, true)
+	if err != nil {
+		t.Fatalf("NewPlayer failed: %v", err)
+	}
+	h := p.Handler(notRecorded)
+
+	// The hash of a captured request covers the whole body, also beyond the captured part
+	r := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+	rec := &store.CapturedRequest{
+		ID:            store.NewID(),
+		Body:          []byte(body[:10]),
+		BodySize:      int64(len(body)),
+		BodyTruncated: true,
+		BodySHA256:    BodyHash([]byte(body)),
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r.WithContext(store.NewContext(r.Context(), rec)))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected the captured hash to match, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Without one the body is hashed through GetBody, leaving the request body to the handlers
+	r = httptest.NewRequest("POST", "/users", strings.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	original := r.Body
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+	if rr.Code != http.StatusCreated || r.Body != original {
+		t.Errorf("Expected the body to be hashed through GetBody, got %d %s", rr.Code, rr.Body.String())
+	}
+}
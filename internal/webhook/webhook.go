@@ -0,0 +1,154 @@
+// Package webhook recognises the sender of webhook requests and extracts normalised metadata about them.
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/czechbol/request-raccoon/internal/cloudevents"
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+// Providers recognised by Detect
+const (
+	GitHub      = "github"
+	GitLab      = "gitlab"
+	Stripe      = "stripe"
+	Shopify     = "shopify"
+	Slack       = "slack"
+	CloudEvents = "cloudevents"
+)
+
+// detectors are tried in order, the first one recognising the request wins
+var detectors = []func(http.Header, []byte) *store.Webhook{
+	github,
+	gitlab,
+	shopify,
+	stripe,
+	slack,
+	cloudEvents,
+}
+
+// Detect returns the metadata of the webhook a request carries, or nil when no known provider sent it.
+func Detect(header http.Header, body []byte) *store.Webhook {
+	for _, detect := range detectors {
+		if hook := detect(header, body); hook != nil {
+			return hook
+		}
+	}
+	return nil
+}
+
+// LogFields returns the webhook metadata as structured log attributes.
+func LogFields(hook *store.Webhook) []any {
+	if hook == nil {
+		return nil
+	}
+
+	fields := []any{"webhook_provider", hook.Provider}
+	if hook.Event != "" {
+		fields = append(fields, "webhook_event", hook.Event)
+	}
+	if hook.DeliveryID != "" {
+		fields = append(fields, "delivery_id", hook.DeliveryID)
+	}
+	if hook.Attempt > 0 {
+		fields = append(fields, "attempt", hook.Attempt)
+	}
+	return fields
+}
+
+func github(header http.Header, _ []byte) *store.Webhook {
+	event := header.Get("X-GitHub-Event")
+	if event == "" {
+		return nil
+	}
+	return &store.Webhook{
+		Provider:   GitHub,
+		Event:      event,
+		DeliveryID: header.Get("X-GitHub-Delivery"),
+	}
+}
+
+func gitlab(header http.Header, _ []byte) *store.Webhook {
+	event := header.Get("X-Gitlab-Event")
+	if event == "" {
+		return nil
+	}
+	return &store.Webhook{
+		Provider:   GitLab,
+		Event:      event,
+		DeliveryID: header.Get("X-Gitlab-Event-UUID"),
+	}
+}
+
+func shopify(header http.Header, _ []byte) *store.Webhook {
+	topic := header.Get("X-Shopify-Topic")
+	if topic == "" {
+		return nil
+	}
+	return &store.Webhook{
+		Provider:   Shopify,
+		Event:      topic,
+		DeliveryID: header.Get("X-Shopify-Webhook-Id"),
+	}
+}
+
+// stripe recognises signed Stripe event objects, whose type and ID are only in the body
+func stripe(header http.Header, body []byte) *store.Webhook {
+	if header.Get("Stripe-Signature") == "" {
+		return nil
+	}
+
+	var event struct {
+		ID     string `json:"id"`
+		Object string `json:"object"`
+		Type   string `json:"type"`
+	}
+	if json.Unmarshal(body, &event) != nil || event.Object != "event" {
+		return &store.Webhook{Provider: Stripe}
+	}
+	return &store.Webhook{
+		Provider:   Stripe,
+		Event:      event.Type,
+		DeliveryID: event.ID,
+	}
+}
+
+// slack recognises Events API callbacks, retries carry the retry number in X-Slack-Retry-Num
+func slack(header http.Header, body []byte) *store.Webhook {
+	if header.Get("X-Slack-Signature") == "" {
+		return nil
+	}
+
+	hook := &store.Webhook{Provider: Slack}
+	if retry, err := strconv.Atoi(header.Get("X-Slack-Retry-Num")); err == nil {
+		hook.Attempt = retry + 1
+	}
+
+	var callback struct {
+		EventID string `json:"event_id"`
+		Event   struct {
+			Type string `json:"type"`
+		} `json:"event"`
+	}
+	if json.Unmarshal(body, &callback) == nil {
+		hook.Event = callback.Event.Type
+		hook.DeliveryID = callback.EventID
+	}
+	return hook
+}
+
+// cloudEvents recognises single CloudEvents in binary and structured mode, batches have no single event type
+func cloudEvents(header http.Header, body []byte) *store.Webhook {
+	events := cloudevents.Parse(header, body)
+	if len(events) != 1 || events[0].Mode == cloudevents.ModeBatch {
+		return nil
+	}
+	return &store.Webhook{
+		Provider:   CloudEvents,
+		Event:      events[0].Type,
+		DeliveryID: events[0].ID,
+	}
+}
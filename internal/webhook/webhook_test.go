@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czechbol/request-raccoon/internal/store"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		body     string
+		expected *store.Webhook
+	}{
+		{
+			name: "github",
+			header: http.Header{
+				"X-Github-Event":    {"pull_request"},
+				"X-Github-Delivery": {"72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+			},
+			body:     `{"action":"opened"}`,
+			expected: &store.Webhook{Provider: GitHub, Event: "pull_request", DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+		},
+		{
+			name:     "gitlab",
+			header:   http.Header{"X-Gitlab-Event": {"Push Hook"}, "X-Gitlab-Event-Uuid": {"13792a34-cac6-4fda-95a8-c58e00a3954e"}},
+			expected: &store.Webhook{Provider: GitLab, Event: "Push Hook", DeliveryID: "13792a34-cac6-4fda-95a8-c58e00a3954e"},
+		},
+		{
+			name:     "shopify",
+			header:   http.Header{"X-Shopify-Topic": {"orders/create"}, "X-Shopify-Webhook-Id": {"b54557e4-bdd9-4b37-8a5f-bf7d70bcd043"}},
+			expected: &store.Webhook{Provider: Shopify, Event: "orders/create", DeliveryID: "b54557e4-bdd9-4b37-8a5f-bf7d70bcd043"},
+		},
+		{
+			name:     "stripe",
+			header:   http.Header{"Stripe-Signature": {"t=1,v1=abc"}},
+			body:     `{"id":"evt_1NG8Du2eZvKYlo2CUI79vXWy","object":"event","type":"invoice.paid"}`,
+			expected: &store.Webhook{Provider: Stripe, Event: "invoice.paid", DeliveryID: "evt_1NG8Du2eZvKYlo2CUI79vXWy"},
+		},
+		{
+			name:     "stripe without event body",
+			header:   http.Header{"Stripe-Signature": {"t=1,v1=abc"}},
+			body:     `not json`,
+			expected: &store.Webhook{Provider: Stripe},
+		},
+		{
+			name:     "slack retry",
+			header:   http.Header{"X-Slack-Signature": {"v0=abc"}, "X-Slack-Retry-Num": {"2"}},
+			body:     `{"type":"event_callback","event_id":"Ev9UQ52YNA","event":{"type":"app_mention"}}`,
+			expected: &store.Webhook{Provider: Slack, Event: "app_mention", DeliveryID: "Ev9UQ52YNA", Attempt: 3},
+		},
+		{
+			name:     "cloudevents binary",
+			header:   http.Header{"Ce-Specversion": {"1.0"}, "Ce-Type": {"com.example.order.created"}, "Ce-Id": {"A234-1234-1234"}},
+			expected: &store.Webhook{Provider: CloudEvents, Event: "com.example.order.created", DeliveryID: "A234-1234-1234"},
+		},
+		{
+			name:     "cloudevents structured",
+			header:   http.Header{"Content-Type": {"application/cloudevents+json; charset=utf-8"}},
+			body:     `{"specversion":"1.0","type":"com.example.order.created","id":"A234","source":"/orders"}`,
+			expected: &store.Webhook{Provider: CloudEvents, Event: "com.example.order.created", DeliveryID: "A234"},
+		},
+		{
+			name:   "plain request",
+			header: http.Header{"Content-Type": {"application/json"}},
+			body:   `{"type":"invoice.paid"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := Detect(tt.header, []byte(tt.body))
+			if (hook == nil) != (tt.expected == nil) || (hook != nil && *hook != *tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, hook)
+			}
+		})
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	if fields := LogFields(nil); fields != nil {
+		t.Errorf("Expected no fields without a webhook, got %v", fields)
+	}
+
+	fields := LogFields(&store.Webhook{Provider: Slack, Event: "message", Attempt: 2})
+	expected := []any{"webhook_provider", Slack, "webhook_event", "message", "attempt", 2}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fields)
+	}
+	for i := range fields {
+		if fields[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, fields)
+		}
+	}
+}